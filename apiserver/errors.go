@@ -0,0 +1,209 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/grpasr/common/configloader"
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/observability/logging"
+)
+
+const (
+	CorrelationIDHeader = "X-Correlation-ID"
+	// CorrelationIDKey is the payload entry of the correlation ID, it is never hidden
+	CorrelationIDKey = "correlation_id"
+)
+
+// DefaultRetryAfter is the Retry-After of the retryable errors when the handler did not set it
+var DefaultRetryAfter = 5 * time.Second
+
+var lf = logging.NewLoggingFacade()
+
+// WriteError writes err with the status of the IError, a non IError is a 500.
+// The body is application/problem+json when the request accepts it rather than
+// application/json, the {code, description, ...} document otherwise.
+// A copy of the errors without a trace gets the one of the request and the 5xx are logged with their stack.
+// The stacks are written only when exposed by the handler and never in production, where the comment
+// and the payload of the 5xx errors are hidden too, the retryable errors get a Retry-After
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var ierr e.IError
+	if !errors.As(err, &ierr) {
+		ierr = e.WrapHTTPStatus(err, e.StatusInternalServerError)
+	}
+	if len(e.TraceID(ierr)) == 0 {
+		ierr = e.CustomError{IError: ierr}.WithContext(r.Context())
+	}
+
+	status, retryable := errorStatus(ierr)
+	if status >= 500 {
+		lh := lf.NewLogHandler(lf.LLHError(), r.Context()).
+			Str("instance_id", e.InstanceID(ierr)).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Err(ierr)
+		if stack := e.Stack(ierr); len(stack) > 0 {
+			lh.Str("stack", strings.Join(stack, "\n"))
+		}
+		lh.Msg("request failed")
+	}
+	if configloader.IsProductionEnv("") {
+		ierr = hideDetails(ierr, status >= 500)
+	}
+
+	if retryable && len(w.Header().Get("Retry-After")) == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(DefaultRetryAfter.Seconds())))
+	}
+
+	var body []byte
+	var merr error
+	if acceptsProblem(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", e.MediaTypeProblem)
+		body, merr = e.MarshalProblem(ierr)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		body, merr = json.Marshal(ierr)
+	}
+	if merr != nil {
+		body = []byte(fmt.Sprintf(`{"code":%d,"description":%q}`, status, e.HTTPCodeDescriptions[e.StatusCode(status)]))
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// RecoveryMiddleware turns the panics of the handlers into a 500 carrying a correlation ID,
+// the one of the X-Correlation-ID request header or a new one, and logs the stack with it.
+// http.ErrAbortHandler is panicked again to abort the response as net/http does
+func RecoveryMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &headerWatcher{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				id := r.Header.Get(CorrelationIDHeader)
+				if len(id) == 0 {
+					id = newCorrelationID()
+				}
+				lf.NewLogHandler(lf.LLHError(), r.Context()).
+					Str(CorrelationIDKey, id).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Str("panic", fmt.Sprint(v)).
+					Str("stack", string(debug.Stack())).
+					Msg("panic recovered")
+
+				if rw.wroteHeader {
+					// the status is sent, the response can only be cut
+					panic(http.ErrAbortHandler)
+				}
+				ierr := e.NewCustomHTTPStatus(e.StatusInternalServerError, r.URL.Path, "the request failed unexpectedly")
+				ierr.SetPayload(map[string]interface{}{CorrelationIDKey: id})
+				w.Header().Set(CorrelationIDHeader, id)
+				WriteError(w, r, ierr)
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// errorStatus is the HTTP status of ierr and whether it is retryable
+func errorStatus(ierr e.IError) (int, bool) {
+	var c *e.CodeError
+	if errors.As(ierr, &c) {
+		code := e.ErrorCode(c.Code)
+		return int(code.HTTPStatus()), code.Retryable()
+	}
+	status := ierr.GetCode()
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	return status, status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests
+}
+
+// hideDetails copies ierr without its stack, and without its comment, payload and cause when all,
+// the instance, trace and correlation IDs are kept
+func hideDetails(ierr e.IError, all bool) e.IError {
+	if all {
+		return e.Redact(ierr, CorrelationIDKey)
+	}
+	var c *e.CodeError
+	var h *e.HTTPStatus
+	switch {
+	case errors.As(ierr, &c):
+		hidden := *c
+		hidden.Stack = nil
+		return e.CustomError{IError: &hidden}
+	case errors.As(ierr, &h):
+		hidden := *h
+		hidden.Stack = nil
+		return e.CustomError{IError: &hidden}
+	}
+	return ierr
+}
+
+// acceptsProblem tells whether accept prefers application/problem+json to application/json
+func acceptsProblem(accept string) bool {
+	problemQ, jsonQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case e.MediaTypeProblem:
+			problemQ = max(problemQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// headerWatcher records whether the handler sent the status
+type headerWatcher struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (hw *headerWatcher) WriteHeader(code int) {
+	hw.wroteHeader = true
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerWatcher) Write(b []byte) (int, error) {
+	hw.wroteHeader = true
+	return hw.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer
+func (hw *headerWatcher) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
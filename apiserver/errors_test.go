@@ -0,0 +1,122 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/configloader"
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/tests"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func writeError(err error, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/items/42", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	WriteError(w, r, err)
+	return w
+}
+
+func Test_write_error_negotiates_the_format(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	t.Setenv("GOENV", configloader.DevelopmentENV)
+
+	notFound := e.NewCustomHTTPStatus(e.StatusNotFound, "/items/42", "no item 42")
+	id := e.InstanceID(notFound)
+	plain := writeError(notFound, "")
+	problem := writeError(notFound, "application/problem+json, application/json;q=0.9")
+	preferJSON := writeError(notFound, "application/json, application/problem+json;q=0.5")
+	denied := writeError(e.NewCustomCodeError(e.ErrAccessDenied, "items"), "application/json")
+	unavailable := writeError(e.NewCustomCodeError(e.ErrTemporarilyUnavailable), "")
+	throttled := writeError(e.NewCustomHTTPStatus(e.StatusTooManyRequests), "")
+	plainErr := writeError(errors.New("disk full"), "")
+
+	tests.MaybeFail("write_error_negotiates_the_format",
+		tests.Expect(plain.Code, http.StatusNotFound),
+		tests.Expect(plain.Header().Get("Content-Type"), "application/json"),
+		tests.Expect(plain.Body.String(), fmt.Sprintf(`{"code":404,"description":"Resource not found","uri":"/items/42","comment":"no item 42","instance_id":"%s"}`, id)),
+		tests.Expect(problem.Header().Get("Content-Type"), e.MediaTypeProblem),
+		tests.Expect(problem.Body.String(), fmt.Sprintf(`{"detail":"no item 42","instance":"/items/42","instance_id":"%s","status":404,"title":"Resource not found","type":"about:blank"}`, id)),
+		tests.Expect(preferJSON.Header().Get("Content-Type"), "application/json"),
+		tests.Expect(denied.Code, http.StatusForbidden),
+		tests.Expect(denied.Header().Get("Retry-After"), ""),
+		tests.Expect(unavailable.Code, http.StatusServiceUnavailable),
+		tests.Expect(unavailable.Header().Get("Retry-After"), "5"),
+		tests.Expect(throttled.Header().Get("Retry-After"), "5"),
+		tests.Expect(plainErr.Code, http.StatusInternalServerError),
+		tests.Expect(strings.HasPrefix(plainErr.Body.String(), `{"code":500,"description":"Server error","instance_id":"`), true))
+}
+
+func Test_write_error_hides_the_5xx_details_in_production(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	t.Setenv("GOENV", configloader.ProductionENV)
+
+	e.SetStackSampleRate(1)
+	defer e.SetStackSampleRate(0)
+
+	failure := e.NewCustomHTTPStatus(e.StatusInternalServerError, "/items/42", "mongo: connection refused")
+	failure.SetPayload(map[string]interface{}{"host": "10.0.0.3", CorrelationIDKey: "abc"})
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tid, _ := trace.TraceIDFromHex(traceID)
+	sid, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	r := httptest.NewRequest("GET", "/items/42", nil)
+	r = r.WithContext(trace.ContextWithSpanContext(r.Context(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid})))
+	hidden := httptest.NewRecorder()
+	WriteError(hidden, r, failure)
+
+	serverError := e.NewCustomCodeError(e.ErrServerError, "items", "stack overflow")
+	hiddenProblem := writeError(serverError, e.MediaTypeProblem)
+
+	invalid := e.NewCustomHTTPStatus(e.StatusBadRequest, "", "name is required")
+	shown := writeError(invalid, "")
+
+	tests.MaybeFail("write_error_hides_the_5xx_details_in_production",
+		tests.Expect(len(e.Stack(failure)) > 0, true),
+		tests.Expect(e.TraceID(failure), ""),
+		tests.Expect(hidden.Body.String(), fmt.Sprintf(`{"code":500,"description":"Server error","uri":"/items/42","payload":{"correlation_id":"abc"},"instance_id":"%s","trace_id":"%s"}`, e.InstanceID(failure), traceID)),
+		tests.Expect(hiddenProblem.Body.String(), fmt.Sprintf(`{"code":1003,"instance_id":"%s","service":"items","status":500,"title":"The server encountered an internal error while processing the request","type":"about:blank"}`, e.InstanceID(serverError))),
+		tests.Expect(shown.Body.String(), fmt.Sprintf(`{"code":400,"description":"Invalid request","comment":"name is required","instance_id":"%s"}`, e.InstanceID(invalid))))
+}
+
+func Test_recovery_middleware(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	t.Setenv("GOENV", configloader.ProductionENV)
+
+	h := RecoveryMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			w.Write([]byte("ok"))
+			return
+		}
+		var items map[string]int
+		items[r.URL.Path] = 1
+	}))
+
+	ok := httptest.NewRecorder()
+	h.ServeHTTP(ok, httptest.NewRequest("GET", "/ok", nil))
+
+	generated := httptest.NewRecorder()
+	h.ServeHTTP(generated, httptest.NewRequest("POST", "/items", nil))
+	var body e.HTTPStatus
+	uerr := json.Unmarshal(generated.Body.Bytes(), &body)
+
+	forwarded := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/items", nil)
+	r.Header.Set(CorrelationIDHeader, "req-1")
+	h.ServeHTTP(forwarded, r)
+
+	tests.MaybeFail("recovery_middleware", uerr,
+		tests.Expect(ok.Body.String(), "ok"),
+		tests.Expect(generated.Code, http.StatusInternalServerError),
+		tests.Expect(len(generated.Header().Get(CorrelationIDHeader)), 32),
+		tests.Expect(body.Payload[CorrelationIDKey], generated.Header().Get(CorrelationIDHeader)),
+		tests.Expect(body.Comment, ""),
+		tests.Expect(forwarded.Header().Get(CorrelationIDHeader), "req-1"))
+}
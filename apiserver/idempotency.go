@@ -0,0 +1,265 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/idempotency"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	defaultIdempotencyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLength  = 255
+)
+
+// IdempotencyLease is how long a key stays locked by its request in progress, the lease is renewed
+// while the handler runs so the key of a request lost with its process is freed once it expires
+var IdempotencyLease = 30 * time.Second
+
+// IdempotencyMaxBodySize is the largest body read to fingerprint a request, a larger one is refused with 413
+var IdempotencyMaxBodySize int64 = 1 << 20
+
+// IdempotencyPrincipal identifies the caller of a request, the keys of two callers never share a stored response.
+// It defaults to the Authorization header, a service identifying its callers otherwise sets its own
+var IdempotencyPrincipal = func(r *http.Request) string {
+	return r.Header.Get("Authorization")
+}
+
+// IdempotencyMiddleware replays the stored response of the POST and PATCH requests
+// sent again with the same Idempotency-Key within ttl. A key reused with another
+// payload is refused with 422, a key whose first request is in progress with 409,
+// the lock of a request in progress lasts IdempotencyLease unless renewed.
+// The keys are scoped by IdempotencyPrincipal and the bodies limited to IdempotencyMaxBodySize.
+// The 5xx responses are not stored so the client can retry them.
+func IdempotencyMiddleware(store idempotency.Store, ttl time.Duration) func(http.Handler) http.Handler {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if len(key) == 0 || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				WriteError(w, r, e.NewCustomHTTPStatus(e.StatusBadRequest, "", "Idempotency-Key is too long"))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, IdempotencyMaxBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					WriteError(w, r, e.NewCustomHTTPStatus(e.StatusRequestEntityTooLarge, "", fmt.Sprintf("the body exceeds %d bytes", tooLarge.Limit)))
+					return
+				}
+				WriteError(w, r, e.WrapHTTPStatus(err, e.StatusBadRequest))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key = idempotencyStoreKey(r, key)
+			fingerprint := requestFingerprint(r, body)
+			lease := IdempotencyLease
+			stored, reserved, err := store.Reserve(r.Context(), key, fingerprint, lease)
+			if err != nil {
+				WriteError(w, r, e.WrapHTTPStatus(err, e.StatusServiceUnavailable))
+				return
+			}
+			if !reserved {
+				switch {
+				case stored.Fingerprint != fingerprint:
+					WriteError(w, r, e.NewCustomHTTPStatus(e.StatusUnprocessableEntity, "", "Idempotency-Key already used for another request"))
+				case stored.InProgress():
+					WriteError(w, r, e.NewCustomHTTPStatus(e.StatusConflict, "", "a request with this Idempotency-Key is in progress"))
+				default:
+					replayIdempotentResponse(w, stored)
+				}
+				return
+			}
+
+			stopRenewal := renewLease(r, store, key, lease)
+			rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			defer func() {
+				// the key is not kept when the handler panics
+				if p := recover(); p != nil {
+					stopRenewal()
+					logStoreError(r, key, "release", store.Release(context.Background(), key))
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			stopRenewal()
+
+			// the request context may be canceled once the response is written
+			ctx := context.Background()
+			if rec.statusCode >= 500 {
+				logStoreError(r, key, "release", store.Release(ctx, key))
+				return
+			}
+			logStoreError(r, key, "complete", store.Complete(ctx, key, &idempotency.Response{
+				Fingerprint: fingerprint,
+				StatusCode:  rec.statusCode,
+				Header:      w.Header().Clone(),
+				Body:        rec.body.Bytes(),
+				ExpiresAt:   time.Now().Add(ttl),
+			}))
+		})
+	}
+}
+
+// renewLease renews the lease of key every third of its duration until the returned func is called
+func renewLease(r *http.Request, store idempotency.Store, key string, lease time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := store.Renew(ctx, key, lease); ctx.Err() == nil {
+					logStoreError(r, key, "renew", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// logStoreError logs the failure of the store operation op, the response is already written
+func logStoreError(r *http.Request, key, op string, err error) {
+	if err == nil {
+		return
+	}
+	lf.NewLogHandler(lf.LLHError(), r.Context()).
+		Str("idempotency_key", key).
+		Str("operation", op).
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Err(err).
+		Msg("idempotency store failed")
+}
+
+// idempotencyStoreKey scopes the key of the request by its principal
+func idempotencyStoreKey(r *http.Request, key string) string {
+	h := sha256.New()
+	h.Write([]byte(IdempotencyPrincipal(r) + "\n" + key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// requestFingerprint identifies the request sent with a key
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, stored *idempotency.Response) {
+	for k, v := range stored.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// responseRecorder copies the response written by the handler
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.statusCode = code
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore is an in process idempotency.Store, for the single instance services and the tests
+var _ idempotency.Store = (*MemoryIdempotencyStore)(nil)
+
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*idempotency.Response
+	now       func() time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		responses: make(map[string]*idempotency.Response),
+		now:       time.Now,
+	}
+}
+
+func (m *MemoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, lease time.Duration) (*idempotency.Response, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if stored, ok := m.responses[key]; ok && now.Before(stored.ExpiresAt) {
+		cp := *stored
+		return &cp, false, nil
+	}
+	// evicts the expired keys on the way
+	for k, v := range m.responses {
+		if !now.Before(v.ExpiresAt) {
+			delete(m.responses, k)
+		}
+	}
+	m.responses[key] = &idempotency.Response{Fingerprint: fingerprint, ExpiresAt: now.Add(lease)}
+	return nil, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Renew(_ context.Context, key string, lease time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.responses[key]; ok && stored.InProgress() {
+		stored.ExpiresAt = m.now().Add(lease)
+	}
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Complete(_ context.Context, key string, resp *idempotency.Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[key] = resp
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.responses, key)
+	return nil
+}
@@ -0,0 +1,190 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/idempotency"
+	"gitlab.com/grpasr/common/tests"
+)
+
+func sendIdempotent(h http.Handler, method, key, body string, authorization ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if len(authorization) > 0 {
+		r.Header.Set("Authorization", authorization[0])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func Test_idempotency_middleware_replays_duplicates(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	orders := 0
+	failing := true
+	store := NewMemoryIdempotencyStore()
+	h := IdempotencyMiddleware(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get(IdempotencyKeyHeader), "flaky") && failing {
+			failing = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		orders++
+		w.Header().Set("Location", "/orders/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	first := sendIdempotent(h, "POST", "k1", `{"item":"a"}`)
+	duplicate := sendIdempotent(h, "POST", "k1", `{"item":"a"}`)
+	otherPayload := sendIdempotent(h, "POST", "k1", `{"item":"b"}`)
+	noKey := sendIdempotent(h, "POST", "", `{"item":"a"}`)
+
+	flaky := sendIdempotent(h, "POST", "flaky", `{}`)
+	flakyRetry := sendIdempotent(h, "POST", "flaky", `{}`)
+
+	tests.MaybeFail("idempotency_middleware_replays_duplicates",
+		tests.Expect(first.Code, http.StatusCreated),
+		tests.Expect(duplicate.Code, http.StatusCreated),
+		tests.Expect(duplicate.Body.String(), `{"id":1}`),
+		tests.Expect(duplicate.Header().Get("Location"), "/orders/1"),
+		tests.Expect(duplicate.Header().Get(IdempotentReplayedHeader), "true"),
+		tests.Expect(otherPayload.Code, http.StatusUnprocessableEntity),
+		tests.Expect(noKey.Code, http.StatusCreated),
+		tests.Expect(flaky.Code, http.StatusServiceUnavailable),
+		tests.Expect(flakyRetry.Code, http.StatusCreated),
+		tests.Expect(orders, 3))
+}
+
+func Test_memory_idempotency_store_in_progress_and_ttl(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	h := IdempotencyMiddleware(store, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	r := httptest.NewRequest("POST", "/orders", nil)
+	_, reserved, err := store.Reserve(ctx, idempotencyStoreKey(r, "k"), requestFingerprint(r, nil), time.Minute)
+	inProgress := sendIdempotent(h, "POST", "k", "")
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, reservedAfterTTL, errTTL := store.Reserve(ctx, "k", "other", time.Minute)
+
+	tests.MaybeFail("memory_idempotency_store_in_progress_and_ttl", err, errTTL,
+		tests.Expect(reserved, true),
+		tests.Expect(inProgress.Code, http.StatusConflict),
+		tests.Expect(reservedAfterTTL, true))
+}
+
+func Test_idempotency_lease_expires_and_is_renewed(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	lease := IdempotencyLease
+	IdempotencyLease = 30 * time.Millisecond
+	defer func() { IdempotencyLease = lease }()
+
+	// the reservation of a request lost with its process
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	r := httptest.NewRequest("POST", "/orders", nil)
+	_, _, err := store.Reserve(ctx, idempotencyStoreKey(r, "lost"), requestFingerprint(r, nil), IdempotencyLease)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	h := IdempotencyMiddleware(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(IdempotencyKeyHeader) == "slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	lostInProgress := sendIdempotent(h, "POST", "lost", "")
+	time.Sleep(2 * IdempotencyLease)
+	lostRetry := sendIdempotent(h, "POST", "lost", "")
+
+	slow := make(chan *httptest.ResponseRecorder)
+	go func() {
+		slow <- sendIdempotent(h, "POST", "slow", "")
+	}()
+	<-started
+	// the lease is renewed while the handler runs
+	time.Sleep(3 * IdempotencyLease)
+	slowInProgress := sendIdempotent(h, "POST", "slow", "")
+	close(release)
+	slowFirst := <-slow
+	slowReplay := sendIdempotent(h, "POST", "slow", "")
+
+	tests.MaybeFail("idempotency_lease_expires_and_is_renewed", err,
+		tests.Expect(lostInProgress.Code, http.StatusConflict),
+		tests.Expect(lostRetry.Code, http.StatusCreated),
+		tests.Expect(slowInProgress.Code, http.StatusConflict),
+		tests.Expect(slowFirst.Code, http.StatusCreated),
+		tests.Expect(slowReplay.Header().Get(IdempotentReplayedHeader), "true"))
+}
+
+// failingStore fails to store the responses
+type failingStore struct {
+	*MemoryIdempotencyStore
+}
+
+func (failingStore) Complete(context.Context, string, *idempotency.Response) error {
+	return errors.New("connection reset by the store")
+}
+
+func Test_idempotency_middleware_scopes_limits_and_logs(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	maxBody := IdempotencyMaxBodySize
+	IdempotencyMaxBodySize = 16
+	defer func() { IdempotencyMaxBodySize = maxBody }()
+
+	orders := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orders++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"owner":%q}`, orders, r.Header.Get("Authorization"))
+	})
+	h := IdempotencyMiddleware(NewMemoryIdempotencyStore(), time.Hour)(handler)
+
+	// the same key and body sent by two callers
+	alice := sendIdempotent(h, "POST", "k1", `{"item":"a"}`, "Bearer alice")
+	bob := sendIdempotent(h, "POST", "k1", `{"item":"a"}`, "Bearer bob")
+	aliceAgain := sendIdempotent(h, "POST", "k1", `{"item":"a"}`, "Bearer alice")
+	tooLarge := sendIdempotent(h, "POST", "k2", `{"item":"a very long description"}`, "Bearer alice")
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	failing := IdempotencyMiddleware(failingStore{NewMemoryIdempotencyStore()}, time.Hour)(handler)
+	notStored := sendIdempotent(failing, "POST", "k3", `{}`)
+	w.Close()
+	os.Stdout = old
+	var logs bytes.Buffer
+	io.Copy(&logs, r)
+
+	tests.MaybeFail("idempotency_middleware_scopes_limits_and_logs",
+		tests.Expect(alice.Body.String(), `{"id":1,"owner":"Bearer alice"}`),
+		tests.Expect(bob.Body.String(), `{"id":2,"owner":"Bearer bob"}`),
+		tests.Expect(aliceAgain.Body.String(), `{"id":1,"owner":"Bearer alice"}`),
+		tests.Expect(aliceAgain.Header().Get(IdempotentReplayedHeader), "true"),
+		tests.Expect(tooLarge.Code, http.StatusRequestEntityTooLarge),
+		tests.Expect(notStored.Code, http.StatusCreated),
+		tests.Expect(strings.Contains(logs.String(), "idempotency store failed"), true),
+		tests.Expect(strings.Contains(logs.String(), "connection reset by the store"), true),
+		tests.Expect(orders, 3))
+}
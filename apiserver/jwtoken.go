@@ -86,7 +86,7 @@ func (a APIserverAuth) Run(ctx context.Context, retry, d int8) e.IError {
 		select {
 		case <-time.After(delay):
 		case <-ctx.Done():
-			return e.NewCustomHTTPStatus(e.StatusBadRequest, "", err.Error())
+			return e.WrapHTTPStatus(err, e.StatusBadRequest)
 		}
 	}
 }
@@ -95,7 +95,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	u, err := url.Parse(fmt.Sprintf("%s/%s", a.authServerURL, a.path))
 	if err != nil {
 		log.Println("Error parsing URL:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	// Add the form data to the existing query parameters
@@ -106,7 +106,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	appParams, err := url.ParseQuery(a.authCredentials.AppUrlParams)
 	if err != nil {
 		log.Println("Error parsing query string:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	for key, values := range appParams {
@@ -126,7 +126,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	)
 	if err != nil {
 		log.Println("Error request the token: ", err)
-		return e.NewCustomHTTPStatus(e.StatusBadRequest, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusBadRequest)
 	}
 
 	defer resp.Body.Close()
@@ -142,7 +142,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Println("Error reading response body:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	// Parse the response body into CodeStruct
@@ -150,7 +150,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	err = json.Unmarshal(body, a.codeStruct)
 	if err != nil {
 		log.Println("Error parsing response body:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	// Define the request parameters
@@ -173,7 +173,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	req, err := http.NewRequest(a.method, a.urlOauthToken, bodyByt)
 	if err != nil {
 		fmt.Println("Error creating request:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	// Set request headers
@@ -185,7 +185,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		fmt.Println("Error executing request:", err)
-		return e.NewCustomHTTPStatus(e.StatusBadRequest, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusBadRequest)
 	}
 	defer resp.Body.Close()
 
@@ -193,7 +193,7 @@ func (a APIserverAuth) QueryToken() e.IError {
 	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Println("Error reading response body:", err)
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	// fmt.Println("order.go see the bodyyyyyy: ", string(body))
@@ -223,7 +223,7 @@ func (a APIserverAuth) SetURLAndCreateCodeChallenge() e.IError {
 
 	parsedURL, err := url.Parse(settedURL)
 	if err != nil {
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatus(err, e.StatusInternalServerError)
 	}
 
 	a.authCredentials.AppUrlParams = parsedURL.RawQuery
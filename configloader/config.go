@@ -2,6 +2,7 @@ package configloader
 
 import (
 	"fmt"
+	"os"
 )
 
 type TConfigType string
@@ -14,6 +15,12 @@ const (
 	ProductionENV              = "production"
 )
 
+// IsProductionEnv tells whether goenv or the GOENV variable of the process is ProductionENV,
+// a config built for another environment never lifts the production restrictions of the process
+func IsProductionEnv(goenv string) bool {
+	return goenv == ProductionENV || os.Getenv("GOENV") == ProductionENV
+}
+
 type Config struct {
 	*loaderConfig
 	GOENV string
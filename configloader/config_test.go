@@ -34,3 +34,18 @@ func Test_create_config_with_invalid_instance(t *testing.T) {
 		tests.Expect(c == nil, true),
 		tests.Expect(err.Error(), "unknown ConfigType"))
 }
+
+func Test_is_production_env(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	t.Setenv("GOENV", DevelopmentENV)
+	fromConfig := IsProductionEnv(ProductionENV)
+	development := IsProductionEnv(LocalhostENV)
+
+	t.Setenv("GOENV", ProductionENV)
+	tests.MaybeFail("is_production_env",
+		tests.Expect(fromConfig, true),
+		tests.Expect(development, false),
+		tests.Expect(IsProductionEnv(LocalhostENV), true),
+		tests.Expect(IsProductionEnv(""), true))
+}
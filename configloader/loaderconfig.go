@@ -131,6 +131,19 @@ func (lc *loaderConfig) LDRGetGOENV() string {
 	return lc.GOENV
 }
 
+// LDRUnmarshalKey decodes a section of the loaded file into out, following its mapstructure tags,
+// the section under the GOENV one takes precedence, e.g. production.restclient over restclient
+func (lc *loaderConfig) LDRUnmarshalKey(key string, out interface{}) error {
+	envKey := fmt.Sprintf("%s.%s", lc.LDRGetGOENV(), key)
+	if viper.IsSet(envKey) {
+		return viper.UnmarshalKey(envKey, out)
+	}
+	if viper.IsSet(key) {
+		return viper.UnmarshalKey(key, out)
+	}
+	return nil
+}
+
 func (lc *loaderConfig) LDRGetGrpcTypes() []string {
 	return lc.grpcTypes
 }
@@ -85,3 +85,31 @@ func Test_load_config_production(t *testing.T) {
 // 		tests.Expect(err.Error(), "registryPort is invalid"))
 //
 // }
+
+func Test_unmarshal_key_by_environment(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	type restClientConf struct {
+		RequestTimeoutMs int    `mapstructure:"request_timeout_ms"`
+		ProxyURL         string `mapstructure:"proxy_url"`
+		UnixSocket       string `mapstructure:"unix_socket"`
+	}
+
+	lc := NewLoaderConfig("localhost")
+	err := lc.LDRLoadConfigs("configTests", "yaml", "./tests/loaderConfig/")
+	var local restClientConf
+	errLocal := lc.LDRUnmarshalKey("restclient", &local)
+
+	lcProd := NewLoaderConfig("production")
+	errProdLoad := lcProd.LDRLoadConfigs("configTests", "yaml", "./tests/loaderConfig/")
+	var prod restClientConf
+	errProd := lcProd.LDRUnmarshalKey("restclient", &prod)
+
+	missing := restClientConf{RequestTimeoutMs: 1}
+	errMissing := lc.LDRUnmarshalKey("missing", &missing)
+
+	tests.MaybeFail("unmarshal_key_by_environment", err, errLocal, errProdLoad, errProd, errMissing,
+		tests.Expect(local, restClientConf{RequestTimeoutMs: 5000, ProxyURL: "socks5://proxy.internal:1080"}),
+		tests.Expect(prod, restClientConf{RequestTimeoutMs: 2000, UnixSocket: "/var/run/envoy.sock"}),
+		tests.Expect(missing.RequestTimeoutMs, 1))
+}
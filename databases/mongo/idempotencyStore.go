@@ -0,0 +1,112 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/grpasr/common/idempotency"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const idempotencyCollectionDefault = "idempotency_keys"
+
+var _ idempotency.Store = (*IdempotencyStore)(nil)
+
+// idempotencyDocument is the stored form of an idempotency.Response
+type idempotencyDocument struct {
+	Key                  string `bson:"_id"`
+	idempotency.Response `bson:",inline"`
+}
+
+// IdempotencyStore is an idempotency.Store shared by the instances of a service,
+// the expired keys and leases are removed by a TTL index
+type IdempotencyStore struct {
+	collection     *mongo.Collection
+	requestTimeout time.Duration
+}
+
+// NewIdempotencyStore returns a store on the collection of the service database,
+// collection default to idempotency_keys
+func NewIdempotencyStore(client *mongo.Client, storeCfg *StoreConfig, collection string) (*IdempotencyStore, error) {
+	if len(collection) == 0 {
+		collection = idempotencyCollectionDefault
+	}
+	s := &IdempotencyStore{
+		collection:     client.Database(storeCfg.GetDatabaseName()).Collection(collection),
+		requestTimeout: time.Duration(storeCfg.GetRequestTimeout()) * time.Second,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.requestTimeout)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, lease time.Duration) (*idempotency.Response, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	now := time.Now()
+	doc := idempotencyDocument{
+		Key: key,
+		Response: idempotency.Response{
+			Fingerprint: fingerprint,
+			ExpiresAt:   now.Add(lease),
+		},
+	}
+
+	// the TTL monitor runs every minute, an expired document may still be there
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = s.collection.InsertOne(ctx, doc)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	var stored idempotencyDocument
+	if err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&stored); err != nil {
+		return nil, false, err
+	}
+	return &stored.Response, false, nil
+}
+
+// Renew extends the lease of the key while no response is stored
+func (s *IdempotencyStore) Renew(ctx context.Context, key string, lease time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": key, "status_code": idempotency.InProgressCode},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(lease)}})
+	return err
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, resp *idempotency.Response) error {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": key}, idempotencyDocument{Key: key, Response: *resp})
+	return err
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,136 @@
+package mongo
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/idempotency"
+	"gitlab.com/grpasr/common/tests"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func newMockIdempotencyStore(mt *mtest.T) *IdempotencyStore {
+	mt.AddMockResponses(mtest.CreateSuccessResponse())
+	store, err := NewIdempotencyStore(mt.Client, &StoreConfig{databaseName: mt.DB.Name(), requestTimeout: 5}, "")
+	if err != nil {
+		mt.Fatalf("new_idempotency_store failed: %v", err)
+	}
+	mt.ClearEvents()
+	return store
+}
+
+// lastCommand returns the latest command sent by the store
+func lastCommand(mt *mtest.T, name string) bson.Raw {
+	for {
+		evt := mt.GetStartedEvent()
+		if evt == nil {
+			mt.Fatalf("no %s command sent", name)
+		}
+		if evt.CommandName == name {
+			return evt.Command
+		}
+	}
+}
+
+func Test_idempotency_store_reserve(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("reserved", func(mt *mtest.T) {
+		tests.MaybeFail = tests.InitFailFunc(mt.T)
+		store := newMockIdempotencyStore(mt)
+
+		// the expired document removal then the insertion
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		before := time.Now()
+		stored, reserved, err := store.Reserve(context.Background(), "k1", "fp", time.Minute)
+
+		doc := lastCommand(mt, "insert").Lookup("documents").Array().Index(0).Value().Document()
+		expiresAt := doc.Lookup("expires_at").Time()
+
+		tests.MaybeFail("idempotency_store_reserved", err,
+			tests.Expect(stored == nil, true),
+			tests.Expect(reserved, true),
+			tests.Expect(doc.Lookup("_id").StringValue(), "k1"),
+			tests.Expect(doc.Lookup("fingerprint").StringValue(), "fp"),
+			tests.Expect(doc.Lookup("status_code").AsInt64(), int64(0)),
+			tests.Expect(!expiresAt.Before(before.Add(time.Minute).Truncate(time.Millisecond)), true))
+	})
+
+	mt.Run("conflict", func(mt *mtest.T) {
+		tests.MaybeFail = tests.InitFailFunc(mt.T)
+		store := newMockIdempotencyStore(mt)
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+idempotencyCollectionDefault, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "k1"},
+				{Key: "fingerprint", Value: "fp"},
+				{Key: "status_code", Value: http.StatusCreated},
+				{Key: "body", Value: []byte(`{"id":1}`)},
+			}))
+		stored, reserved, err := store.Reserve(context.Background(), "k1", "fp", time.Minute)
+
+		tests.MaybeFail("idempotency_store_conflict", err,
+			tests.Expect(reserved, false),
+			tests.Expect(stored.Fingerprint, "fp"),
+			tests.Expect(stored.StatusCode, http.StatusCreated),
+			tests.Expect(string(stored.Body), `{"id":1}`))
+	})
+
+	mt.Run("failure", func(mt *mtest.T) {
+		tests.MaybeFail = tests.InitFailFunc(mt.T)
+		store := newMockIdempotencyStore(mt)
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 2, Message: "bad value"}))
+		stored, reserved, err := store.Reserve(context.Background(), "k1", "fp", time.Minute)
+
+		tests.MaybeFail("idempotency_store_failure",
+			tests.Expect(err != nil, true),
+			tests.Expect(stored == nil, true),
+			tests.Expect(reserved, false))
+	})
+}
+
+func Test_idempotency_store_renew_and_complete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("renew", func(mt *mtest.T) {
+		tests.MaybeFail = tests.InitFailFunc(mt.T)
+		store := newMockIdempotencyStore(mt)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		err := store.Renew(context.Background(), "k1", time.Minute)
+		update := lastCommand(mt, "update").Lookup("updates").Array().Index(0).Value().Document()
+
+		// only the lease of a request in progress is renewed
+		tests.MaybeFail("idempotency_store_renew", err,
+			tests.Expect(update.Lookup("q", "_id").StringValue(), "k1"),
+			tests.Expect(update.Lookup("q", "status_code").AsInt64(), int64(0)),
+			tests.Expect(update.Lookup("u", "$set", "expires_at").Type.String(), "UTC datetime"))
+	})
+
+	mt.Run("complete", func(mt *mtest.T) {
+		tests.MaybeFail = tests.InitFailFunc(mt.T)
+		store := newMockIdempotencyStore(mt)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		err := store.Complete(context.Background(), "k1", &idempotency.Response{
+			Fingerprint: "fp",
+			StatusCode:  http.StatusCreated,
+			Body:        []byte(`{"id":1}`),
+			ExpiresAt:   time.Now().Add(time.Hour),
+		})
+		update := lastCommand(mt, "update").Lookup("updates").Array().Index(0).Value().Document()
+
+		tests.MaybeFail("idempotency_store_complete", err,
+			tests.Expect(update.Lookup("q", "_id").StringValue(), "k1"),
+			tests.Expect(update.Lookup("u", "_id").StringValue(), "k1"),
+			tests.Expect(update.Lookup("u", "status_code").AsInt64(), int64(http.StatusCreated)))
+	})
+}
@@ -181,7 +181,7 @@ func ClientProvider(storeCfg *StoreConfig, retry, d int8) (*mongo.Client, e.IErr
 		// obs.Logging.NewLogHandler(obs.Logging.LLHError()).
 		// 	Err(err).
 		// 	Msg("error creating mongoDB client")
-		return nil, e.NewCustomHTTPStatus(e.StatusBadRequest, "", err.Error())
+		return nil, e.WrapHTTPStatus(err, e.StatusBadRequest)
 	}
 
 	retryPing := Retry(ClientPing, retry, d, ctx)
@@ -190,7 +190,7 @@ func ClientProvider(storeCfg *StoreConfig, retry, d int8) (*mongo.Client, e.IErr
 		// obs.Logging.NewLogHandler(obs.Logging.LLHError()).
 		// 	Err(err).
 		// 	Msg("error ping mongoDB client")
-		return nil, e.NewCustomHTTPStatus(e.StatusBadRequest, "", err.Error())
+		return nil, e.WrapHTTPStatus(err, e.StatusBadRequest)
 	}
 
 	return client, nil
@@ -0,0 +1,297 @@
+// Package grpcstatus converts the errors/json errors to gRPC statuses and back,
+// so an IError returned by a gRPC service reaches its clients with its code, service, comment and payload.
+package grpcstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/grpasr/common/configloader"
+	e "gitlab.com/grpasr/common/errors/json"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the ErrorInfo domain of the statuses carrying an IError
+const Domain = "grpasr.gitlab.com"
+
+const (
+	codeReasonPrefix = "E"
+	httpReasonPrefix = "HTTP_"
+)
+
+// HTTPToCode is the canonical gRPC code of a HTTP status
+func HTTPToCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return codes.OutOfRange
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	switch {
+	case httpStatus >= 200 && httpStatus < 300:
+		return codes.OK
+	case httpStatus >= 400 && httpStatus < 500:
+		return codes.FailedPrecondition
+	case httpStatus >= 500 && httpStatus < 600:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// CodeToHTTP is the canonical HTTP status of a gRPC code
+func CodeToHTTP(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// ToStatus converts err to a status, an IError is carried as an ErrorInfo detail with its
+// instance and trace IDs, its cause only when exposed, and its string payload entries as BadRequest field violations when the code is InvalidArgument.
+// In production the comment, the payload and the cause of the errors mapped to a 5xx are hidden as apiserver.WriteError does.
+// A status error is returned as is, the context errors get their gRPC code, the other errors are Unknown
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	var ierr e.IError
+	if !errors.As(err, &ierr) {
+		if st, ok := status.FromError(err); ok {
+			return st
+		}
+		return status.FromContextError(err)
+	}
+	if configloader.IsProductionEnv("") && httpStatus(ierr) >= 500 {
+		ierr = e.Redact(ierr)
+	}
+
+	metadata := map[string]string{}
+	var c *e.CodeError
+	var h *e.HTTPStatus
+	var code codes.Code
+	var reason, message string
+	switch {
+	case errors.As(ierr, &c):
+		code = HTTPToCode(int(e.ErrorCode(c.Code).HTTPStatus()))
+		reason = codeReasonPrefix + strconv.Itoa(c.Code)
+		message = firstNonEmpty(c.Comment, c.Description)
+		setMetadata(metadata, "description", c.Description)
+		setMetadata(metadata, "service", c.Service)
+		setMetadata(metadata, "comment", c.Comment)
+		if c.CauseExposed && c.Cause != nil {
+			metadata["cause"] = c.Cause.Error()
+		}
+	case errors.As(ierr, &h):
+		code = HTTPToCode(h.Code)
+		reason = httpReasonPrefix + strconv.Itoa(h.Code)
+		message = firstNonEmpty(h.Comment, h.Description)
+		setMetadata(metadata, "description", h.Description)
+		setMetadata(metadata, "uri", h.URI)
+		setMetadata(metadata, "comment", h.Comment)
+		if h.CauseExposed && h.Cause != nil {
+			metadata["cause"] = h.Cause.Error()
+		}
+	default:
+		code = HTTPToCode(ierr.GetCode())
+		reason = httpReasonPrefix + strconv.Itoa(ierr.GetCode())
+		message = ierr.Error()
+	}
+	if code == codes.OK {
+		// an error never converts to a successful status
+		code = codes.Unknown
+	}
+	setMetadata(metadata, "instance_id", e.InstanceID(ierr))
+	setMetadata(metadata, "trace_id", e.TraceID(ierr))
+	if payload := ierr.GetPayload(); len(payload) > 0 {
+		if b, err := json.Marshal(payload); err == nil {
+			metadata["payload"] = string(b)
+		}
+	}
+
+	st := status.New(code, message)
+	info := &errdetails.ErrorInfo{Reason: reason, Domain: Domain, Metadata: metadata}
+	withDetails, derr := st.WithDetails(info)
+	if br := badRequest(ierr.GetPayload()); code == codes.InvalidArgument && br != nil {
+		withDetails, derr = st.WithDetails(info, br)
+	}
+	if derr != nil {
+		return st
+	}
+	return withDetails
+}
+
+// FromStatus converts st to an IError, nil when st is OK.
+// The ErrorInfo of Domain gives back the original error, the other statuses
+// are HTTPStatus of the canonical HTTP status with the message as comment
+// and the BadRequest field violations in the payload
+func FromStatus(st *status.Status) e.IError {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+
+	var violations map[string]interface{}
+	for _, d := range st.Details() {
+		switch detail := d.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.GetDomain() == Domain {
+				if ierr := fromErrorInfo(detail); ierr != nil {
+					return ierr
+				}
+			}
+		case *errdetails.BadRequest:
+			violations = map[string]interface{}{}
+			for _, v := range detail.GetFieldViolations() {
+				violations[v.GetField()] = v.GetDescription()
+			}
+		}
+	}
+
+	he := e.NewHTTPStatus(e.StatusCode(CodeToHTTP(st.Code())), "", st.Message())
+	he.SetPayload(violations)
+	return e.CustomError{IError: he}
+}
+
+// FromError converts a status error to an IError, the other errors are returned as is
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		return FromStatus(st)
+	}
+	return err
+}
+
+func fromErrorInfo(info *errdetails.ErrorInfo) e.IError {
+	md := info.GetMetadata()
+	var payload map[string]interface{}
+	if p, ok := md["payload"]; ok {
+		_ = json.Unmarshal([]byte(p), &payload)
+	}
+
+	reason := info.GetReason()
+	switch {
+	case strings.HasPrefix(reason, codeReasonPrefix):
+		code, err := strconv.Atoi(strings.TrimPrefix(reason, codeReasonPrefix))
+		if err != nil {
+			return nil
+		}
+		ce := e.NewCodeError(e.ErrorCode(code), md["service"], md["comment"])
+		if len(ce.Description) == 0 {
+			ce.Description = md["description"]
+		}
+		ce.SetPayload(payload)
+		ce.InstanceID, ce.TraceID = md["instance_id"], md["trace_id"]
+		if cause, ok := md["cause"]; ok {
+			ce.Cause, ce.CauseExposed = errors.New(cause), true
+		}
+		return e.CustomError{IError: ce}
+	case strings.HasPrefix(reason, httpReasonPrefix):
+		code, err := strconv.Atoi(strings.TrimPrefix(reason, httpReasonPrefix))
+		if err != nil {
+			return nil
+		}
+		he := e.NewHTTPStatus(e.StatusCode(code), md["uri"], md["comment"])
+		if len(he.Description) == 0 {
+			he.Description = md["description"]
+		}
+		he.SetPayload(payload)
+		he.InstanceID, he.TraceID = md["instance_id"], md["trace_id"]
+		if cause, ok := md["cause"]; ok {
+			he.Cause, he.CauseExposed = errors.New(cause), true
+		}
+		return e.CustomError{IError: he}
+	}
+	return nil
+}
+
+// badRequest lists the string payload entries as field violations
+func badRequest(payload map[string]interface{}) *errdetails.BadRequest {
+	br := &errdetails.BadRequest{}
+	for field, v := range payload {
+		if description, ok := v.(string); ok {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+		}
+	}
+	if len(br.FieldViolations) == 0 {
+		return nil
+	}
+	sort.Slice(br.FieldViolations, func(i, j int) bool {
+		return br.FieldViolations[i].Field < br.FieldViolations[j].Field
+	})
+	return br
+}
+
+// httpStatus is the HTTP status of ierr, a status out of the error range is a 500
+func httpStatus(ierr e.IError) int {
+	var c *e.CodeError
+	if errors.As(ierr, &c) {
+		return int(e.ErrorCode(c.Code).HTTPStatus())
+	}
+	if status := ierr.GetCode(); status >= 400 && status <= 599 {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func setMetadata(md map[string]string, key, value string) {
+	if len(value) > 0 {
+		md[key] = value
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package grpcstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/tests"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_to_status_and_back(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	invalid := e.NewCustomCodeError(e.ErrInvalidRequest, "items", "missing name")
+	invalid.SetPayload(map[string]interface{}{"name": "is required", "max": float64(3)})
+	st := ToStatus(fmt.Errorf("creating: %w", invalid))
+
+	var violations []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				violations = append(violations, v.GetField()+": "+v.GetDescription())
+			}
+		}
+	}
+	back := FromStatus(st)
+
+	notFound := e.WrapHTTPStatus(errors.New("no document"), e.StatusNotFound, "/items/42")
+	notFoundBack := FromStatus(ToStatus(notFound))
+
+	foreign := FromStatus(status.New(codes.Unavailable, "connection refused"))
+
+	tests.MaybeFail("to_status_and_back",
+		tests.Expect(st.Code(), codes.InvalidArgument),
+		tests.Expect(st.Message(), "missing name"),
+		tests.Expect(violations, []string{"name: is required"}),
+		tests.Expect(back.Error(), invalid.Error()),
+		tests.Expect(errors.Is(back, invalid), true),
+		tests.Expect(back.GetPayload()["max"], float64(3)),
+		tests.Expect(e.InstanceID(back), e.InstanceID(invalid)),
+		tests.Expect(ToStatus(notFound).Code(), codes.NotFound),
+		tests.Expect(ToStatus(notFound).Message(), "Resource not found"),
+		tests.Expect(notFoundBack.Error(), "404 : Resource not found, Uri: /items/42"),
+		tests.Expect(foreign.GetCode(), 503),
+		tests.Expect(foreign.Error(), "503 : Service unavailable, Comment: connection refused"),
+		tests.Expect(ToStatus(context.DeadlineExceeded).Code(), codes.DeadlineExceeded),
+		tests.Expect(ToStatus(errors.New("boom")).Code(), codes.Unknown),
+		tests.Expect(ToStatus(e.NewCustomHTTPStatus(e.StatusOK)).Code(), codes.Unknown),
+		tests.Expect(FromStatus(status.New(codes.OK, "")), nil))
+}
+
+func Test_code_mapping(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	tests.MaybeFail("code_mapping",
+		tests.Expect(HTTPToCode(401), codes.Unauthenticated),
+		tests.Expect(HTTPToCode(429), codes.ResourceExhausted),
+		tests.Expect(HTTPToCode(418), codes.FailedPrecondition),
+		tests.Expect(HTTPToCode(502), codes.Internal),
+		tests.Expect(CodeToHTTP(codes.PermissionDenied), 403),
+		tests.Expect(CodeToHTTP(codes.AlreadyExists), 409),
+		tests.Expect(CodeToHTTP(codes.DataLoss), 500))
+}
+
+func Test_details_are_hidden_in_production(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	t.Setenv("GOENV", "production")
+
+	failed := e.WrapCodeError(errors.New("dial tcp 10.0.0.7:5432"), e.ErrServerError, "items", "the database is down").ExposeCause()
+	failed.SetPayload(map[string]interface{}{"table": "items"})
+	st := ToStatus(failed)
+	info := errorInfo(st)
+
+	unavailable := e.NewCustomHTTPStatus(e.StatusServiceUnavailable, "/items", "the pool is exhausted")
+	unavailableInfo := errorInfo(ToStatus(unavailable))
+
+	invalid := e.NewCustomCodeError(e.ErrInvalidRequest, "items", "missing name")
+	invalid.SetPayload(map[string]interface{}{"name": "is required"})
+	invalidInfo := errorInfo(ToStatus(invalid))
+
+	// the 5xx keep their code and IDs, the 4xx keep their details
+	tests.MaybeFail("details_are_hidden_in_production",
+		tests.Expect(st.Code(), codes.Internal),
+		tests.Expect(st.Message(), e.ErrServerError.Description()),
+		tests.Expect(info.GetReason(), "E1003"),
+		tests.Expect(info.GetMetadata()["comment"], ""),
+		tests.Expect(info.GetMetadata()["cause"], ""),
+		tests.Expect(info.GetMetadata()["payload"], ""),
+		tests.Expect(info.GetMetadata()["instance_id"], e.InstanceID(failed)),
+		tests.Expect(info.GetMetadata()["service"], "items"),
+		tests.Expect(unavailableInfo.GetMetadata()["comment"], ""),
+		tests.Expect(unavailableInfo.GetMetadata()["uri"], "/items"),
+		tests.Expect(invalidInfo.GetMetadata()["comment"], "missing name"),
+		tests.Expect(invalidInfo.GetMetadata()["payload"], `{"name":"is required"}`))
+}
+
+func errorInfo(st *status.Status) *errdetails.ErrorInfo {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+// healthServer fails its calls with err
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	err error
+}
+
+func (h *healthServer) Check(context.Context, *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	return nil, h.err
+}
+
+func (h *healthServer) Watch(_ *grpc_health_v1.HealthCheckRequest, ws grpc_health_v1.Health_WatchServer) error {
+	if err := ws.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}); err != nil {
+		return err
+	}
+	return h.err
+}
+
+func Test_interceptors(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	denied := e.NewCustomCodeError(e.ErrAccessDenied, "health", "no scope")
+	denied.SetPayload(map[string]interface{}{"scope": "health:read"})
+
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor()),
+		grpc.StreamInterceptor(StreamServerInterceptor()))
+	grpc_health_v1.RegisterHealthServer(srv, &healthServer{err: denied})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()))
+	tests.MaybeFail("dial", err)
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	ctx := context.Background()
+
+	_, checkErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	tests.MaybeFail("watch", err)
+	first, firstErr := stream.Recv()
+	_, watchErr := stream.Recv()
+
+	var ce *e.CodeError
+	tests.MaybeFail("interceptors", firstErr,
+		tests.Expect(errors.Is(checkErr, denied), true),
+		tests.Expect(errors.As(checkErr, &ce), true),
+		tests.Expect(ce.Error(), "1002 : Access to the requested resource is denied, Service: health, Comment: no scope"),
+		tests.Expect(ce.GetPayload()["scope"], "health:read"),
+		tests.Expect(first.GetStatus(), grpc_health_v1.HealthCheckResponse_SERVING),
+		tests.Expect(errors.Is(watchErr, denied), true),
+		tests.Expect(watchErr != io.EOF, true))
+}
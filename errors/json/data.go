@@ -6,6 +6,7 @@ import (
 
 type ErrorCode int
 
+// the common codes, services register their own ranges with RegisterErrorCodes
 const (
 	// Code Error
 	ErrInvalidRequest         ErrorCode = 1000 // E1000
@@ -18,6 +19,8 @@ const (
 	ErrUnsupportedGrantType   ErrorCode = 1007 // E1007
 )
 
+// ErrorCodeDescriptions maps the common error codes to their description, it is read only.
+// The codes registered with RegisterErrorCodes are not added, ErrorCode.Description covers them all
 var ErrorCodeDescriptions = map[ErrorCode]string{
 	ErrInvalidRequest:         "The request is invalid",
 	ErrUnauthorizedClient:     "The client is not authorized to access the requested resource",
@@ -32,41 +35,145 @@ var ErrorCodeDescriptions = map[ErrorCode]string{
 type StatusCode int
 
 const (
-	// Status Code
-	StatusOK                  StatusCode = http.StatusOK                  // 200 OK
-	StatusCreated             StatusCode = http.StatusCreated             // 201 Created
-	StatusAccepted            StatusCode = http.StatusAccepted            // 202 Accepted
-	StatusNoContent           StatusCode = http.StatusNoContent           // 204 No Content
-	StatusMovedPermanently    StatusCode = http.StatusMovedPermanently    // 301 Moved Permanently
-	StatusFound               StatusCode = http.StatusFound               // 302 Found
-	StatusSeeOther            StatusCode = http.StatusSeeOther            // 303 See Other
-	StatusNotModified         StatusCode = http.StatusNotModified         // 304 Not Modified
-	StatusTemporaryRedirect   StatusCode = http.StatusTemporaryRedirect   // 307 Temporary Redirect
-	StatusBadRequest          StatusCode = http.StatusBadRequest          // 400 Bad Request
-	StatusUnauthorized        StatusCode = http.StatusUnauthorized        // 401 Unauthorized
-	StatusForbidden           StatusCode = http.StatusForbidden           // 403 Forbidden
-	StatusNotFound            StatusCode = http.StatusNotFound            // 404 Not Found
-	StatusMethodNotAllowed    StatusCode = http.StatusMethodNotAllowed    // 405 Method Not Allowed
-	StatusInternalServerError StatusCode = http.StatusInternalServerError // 500 Internal Server Error
-	StatusServiceUnavailable  StatusCode = http.StatusServiceUnavailable  // 503 Service Unavailable
+	// Informational
+	StatusContinue           StatusCode = http.StatusContinue           // 100 Continue
+	StatusSwitchingProtocols StatusCode = http.StatusSwitchingProtocols // 101 Switching Protocols
+	StatusProcessing         StatusCode = http.StatusProcessing         // 102 Processing
+	StatusEarlyHints         StatusCode = http.StatusEarlyHints         // 103 Early Hints
+
+	// Success
+	StatusOK                   StatusCode = http.StatusOK                   // 200 OK
+	StatusCreated              StatusCode = http.StatusCreated              // 201 Created
+	StatusAccepted             StatusCode = http.StatusAccepted             // 202 Accepted
+	StatusNonAuthoritativeInfo StatusCode = http.StatusNonAuthoritativeInfo // 203 Non-Authoritative Information
+	StatusNoContent            StatusCode = http.StatusNoContent            // 204 No Content
+	StatusResetContent         StatusCode = http.StatusResetContent         // 205 Reset Content
+	StatusPartialContent       StatusCode = http.StatusPartialContent       // 206 Partial Content
+	StatusMultiStatus          StatusCode = http.StatusMultiStatus          // 207 Multi-Status
+	StatusAlreadyReported      StatusCode = http.StatusAlreadyReported      // 208 Already Reported
+	StatusIMUsed               StatusCode = http.StatusIMUsed               // 226 IM Used
+
+	// Redirection
+	StatusMultipleChoices   StatusCode = http.StatusMultipleChoices   // 300 Multiple Choices
+	StatusMovedPermanently  StatusCode = http.StatusMovedPermanently  // 301 Moved Permanently
+	StatusFound             StatusCode = http.StatusFound             // 302 Found
+	StatusSeeOther          StatusCode = http.StatusSeeOther          // 303 See Other
+	StatusNotModified       StatusCode = http.StatusNotModified       // 304 Not Modified
+	StatusUseProxy          StatusCode = http.StatusUseProxy          // 305 Use Proxy
+	StatusTemporaryRedirect StatusCode = http.StatusTemporaryRedirect // 307 Temporary Redirect
+	StatusPermanentRedirect StatusCode = http.StatusPermanentRedirect // 308 Permanent Redirect
+
+	// Client Error
+	StatusBadRequest                   StatusCode = http.StatusBadRequest                   // 400 Bad Request
+	StatusUnauthorized                 StatusCode = http.StatusUnauthorized                 // 401 Unauthorized
+	StatusPaymentRequired              StatusCode = http.StatusPaymentRequired              // 402 Payment Required
+	StatusForbidden                    StatusCode = http.StatusForbidden                    // 403 Forbidden
+	StatusNotFound                     StatusCode = http.StatusNotFound                     // 404 Not Found
+	StatusMethodNotAllowed             StatusCode = http.StatusMethodNotAllowed             // 405 Method Not Allowed
+	StatusNotAcceptable                StatusCode = http.StatusNotAcceptable                // 406 Not Acceptable
+	StatusProxyAuthRequired            StatusCode = http.StatusProxyAuthRequired            // 407 Proxy Authentication Required
+	StatusRequestTimeout               StatusCode = http.StatusRequestTimeout               // 408 Request Timeout
+	StatusConflict                     StatusCode = http.StatusConflict                     // 409 Conflict
+	StatusGone                         StatusCode = http.StatusGone                         // 410 Gone
+	StatusLengthRequired               StatusCode = http.StatusLengthRequired               // 411 Length Required
+	StatusPreconditionFailed           StatusCode = http.StatusPreconditionFailed           // 412 Precondition Failed
+	StatusRequestEntityTooLarge        StatusCode = http.StatusRequestEntityTooLarge        // 413 Request Entity Too Large
+	StatusRequestURITooLong            StatusCode = http.StatusRequestURITooLong            // 414 Request URI Too Long
+	StatusUnsupportedMediaType         StatusCode = http.StatusUnsupportedMediaType         // 415 Unsupported Media Type
+	StatusRequestedRangeNotSatisfiable StatusCode = http.StatusRequestedRangeNotSatisfiable // 416 Requested Range Not Satisfiable
+	StatusExpectationFailed            StatusCode = http.StatusExpectationFailed            // 417 Expectation Failed
+	StatusTeapot                       StatusCode = http.StatusTeapot                       // 418 I'm a teapot
+	StatusMisdirectedRequest           StatusCode = http.StatusMisdirectedRequest           // 421 Misdirected Request
+	StatusUnprocessableEntity          StatusCode = http.StatusUnprocessableEntity          // 422 Unprocessable Entity
+	StatusLocked                       StatusCode = http.StatusLocked                       // 423 Locked
+	StatusFailedDependency             StatusCode = http.StatusFailedDependency             // 424 Failed Dependency
+	StatusTooEarly                     StatusCode = http.StatusTooEarly                     // 425 Too Early
+	StatusUpgradeRequired              StatusCode = http.StatusUpgradeRequired              // 426 Upgrade Required
+	StatusPreconditionRequired         StatusCode = http.StatusPreconditionRequired         // 428 Precondition Required
+	StatusTooManyRequests              StatusCode = http.StatusTooManyRequests              // 429 Too Many Requests
+	StatusRequestHeaderFieldsTooLarge  StatusCode = http.StatusRequestHeaderFieldsTooLarge  // 431 Request Header Fields Too Large
+	StatusUnavailableForLegalReasons   StatusCode = http.StatusUnavailableForLegalReasons   // 451 Unavailable For Legal Reasons
+
+	// Server Error
+	StatusInternalServerError           StatusCode = http.StatusInternalServerError           // 500 Internal Server Error
+	StatusNotImplemented                StatusCode = http.StatusNotImplemented                // 501 Not Implemented
+	StatusBadGateway                    StatusCode = http.StatusBadGateway                    // 502 Bad Gateway
+	StatusServiceUnavailable            StatusCode = http.StatusServiceUnavailable            // 503 Service Unavailable
+	StatusGatewayTimeout                StatusCode = http.StatusGatewayTimeout                // 504 Gateway Timeout
+	StatusHTTPVersionNotSupported       StatusCode = http.StatusHTTPVersionNotSupported       // 505 HTTP Version Not Supported
+	StatusVariantAlsoNegotiates         StatusCode = http.StatusVariantAlsoNegotiates         // 506 Variant Also Negotiates
+	StatusInsufficientStorage           StatusCode = http.StatusInsufficientStorage           // 507 Insufficient Storage
+	StatusLoopDetected                  StatusCode = http.StatusLoopDetected                  // 508 Loop Detected
+	StatusNotExtended                   StatusCode = http.StatusNotExtended                   // 510 Not Extended
+	StatusNetworkAuthenticationRequired StatusCode = http.StatusNetworkAuthenticationRequired // 511 Network Authentication Required
 )
 
 // HTTPCodeDescriptions maps HTTP status codes to brief descriptions.
 var HTTPCodeDescriptions = map[StatusCode]string{
-	StatusOK:                  "Request successful",
-	StatusCreated:             "Resource created",
-	StatusAccepted:            "Request accepted",
-	StatusNoContent:           "No content to return",
-	StatusMovedPermanently:    "Resource moved permanently",
-	StatusFound:               "Resource temporarily moved",
-	StatusSeeOther:            "Response at a different URL",
-	StatusNotModified:         "Resource not modified",
-	StatusTemporaryRedirect:   "Temporarily redirected",
-	StatusBadRequest:          "Invalid request",
-	StatusUnauthorized:        "Authentication required",
-	StatusForbidden:           "Request forbidden",
-	StatusNotFound:            "Resource not found",
-	StatusMethodNotAllowed:    "Method not allowed",
-	StatusInternalServerError: "Server error",
-	StatusServiceUnavailable:  "Service unavailable",
+	StatusContinue:           "Continue the request",
+	StatusSwitchingProtocols: "Switching protocols",
+	StatusProcessing:         "Request being processed",
+	StatusEarlyHints:         "Early hints",
+
+	StatusOK:                   "Request successful",
+	StatusCreated:              "Resource created",
+	StatusAccepted:             "Request accepted",
+	StatusNonAuthoritativeInfo: "Response modified by a proxy",
+	StatusNoContent:            "No content to return",
+	StatusResetContent:         "Reset the document view",
+	StatusPartialContent:       "Partial content returned",
+	StatusMultiStatus:          "Multiple statuses returned",
+	StatusAlreadyReported:      "Members already reported",
+	StatusIMUsed:               "Instance manipulations applied",
+
+	StatusMultipleChoices:   "Multiple representations available",
+	StatusMovedPermanently:  "Resource moved permanently",
+	StatusFound:             "Resource temporarily moved",
+	StatusSeeOther:          "Response at a different URL",
+	StatusNotModified:       "Resource not modified",
+	StatusUseProxy:          "Use the proxy",
+	StatusTemporaryRedirect: "Temporarily redirected",
+	StatusPermanentRedirect: "Permanently redirected",
+
+	StatusBadRequest:                   "Invalid request",
+	StatusUnauthorized:                 "Authentication required",
+	StatusPaymentRequired:              "Payment required",
+	StatusForbidden:                    "Request forbidden",
+	StatusNotFound:                     "Resource not found",
+	StatusMethodNotAllowed:             "Method not allowed",
+	StatusNotAcceptable:                "No acceptable representation",
+	StatusProxyAuthRequired:            "Proxy authentication required",
+	StatusRequestTimeout:               "Request timed out",
+	StatusConflict:                     "Conflict with the resource state",
+	StatusGone:                         "Resource permanently gone",
+	StatusLengthRequired:               "Content length required",
+	StatusPreconditionFailed:           "Precondition failed",
+	StatusRequestEntityTooLarge:        "Request body too large",
+	StatusRequestURITooLong:            "Request URI too long",
+	StatusUnsupportedMediaType:         "Unsupported media type",
+	StatusRequestedRangeNotSatisfiable: "Range not satisfiable",
+	StatusExpectationFailed:            "Expectation failed",
+	StatusTeapot:                       "I'm a teapot",
+	StatusMisdirectedRequest:           "Request misdirected",
+	StatusUnprocessableEntity:          "Unprocessable content",
+	StatusLocked:                       "Resource locked",
+	StatusFailedDependency:             "Failed dependency",
+	StatusTooEarly:                     "Request too early",
+	StatusUpgradeRequired:              "Protocol upgrade required",
+	StatusPreconditionRequired:         "Precondition required",
+	StatusTooManyRequests:              "Too many requests",
+	StatusRequestHeaderFieldsTooLarge:  "Request headers too large",
+	StatusUnavailableForLegalReasons:   "Unavailable for legal reasons",
+
+	StatusInternalServerError:           "Server error",
+	StatusNotImplemented:                "Not implemented",
+	StatusBadGateway:                    "Bad gateway",
+	StatusServiceUnavailable:            "Service unavailable",
+	StatusGatewayTimeout:                "Gateway timeout",
+	StatusHTTPVersionNotSupported:       "HTTP version not supported",
+	StatusVariantAlsoNegotiates:         "Variant also negotiates",
+	StatusInsufficientStorage:           "Insufficient storage",
+	StatusLoopDetected:                  "Loop detected",
+	StatusNotExtended:                   "Further extensions required",
+	StatusNetworkAuthenticationRequired: "Network authentication required",
 }
@@ -0,0 +1,204 @@
+package json
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	mrand "math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ProductionStackSampleRate is the share of the errors capturing their stack in production
+	ProductionStackSampleRate = 0.01
+	maxStackDepth             = 32
+	// callersSkip skips runtime.Callers, captureStack, newDiagnostics, the private and the public constructors
+	callersSkip = 5
+)
+
+var stackSampleRate atomic.Uint64
+
+func init() {
+	// the stacks are captured in development and sampled in production
+	switch os.Getenv("GOENV") {
+	case "development":
+		SetStackSampleRate(1)
+	case "production":
+		SetStackSampleRate(ProductionStackSampleRate)
+	}
+}
+
+// SetStackSampleRate sets the share of the errors capturing their creation stack, from 0 to 1
+func SetStackSampleRate(rate float64) {
+	stackSampleRate.Store(math.Float64bits(math.Max(0, math.Min(1, rate))))
+}
+
+// Diagnostics lead from an error report to the trace and the log line of the error
+type Diagnostics struct {
+	// InstanceID identifies the occurrence of the error
+	InstanceID string `json:"instance_id,omitempty"`
+	// TraceID is the trace active where the error was created, see the Context constructors
+	TraceID string `json:"trace_id,omitempty"`
+	// Stack is the creation stack, captured according to SetStackSampleRate,
+	// it is marshalled only when StackExposed: the function names and source paths it lists
+	// reveal the internals and the build layout of the service to any client reading the
+	// error, so it goes to the logs by default and to the JSON only by opt-in
+	Stack        []string `json:"-"`
+	StackExposed bool     `json:"-"`
+}
+
+func (d *Diagnostics) diagnostics() *Diagnostics {
+	return d
+}
+
+// diagnosed is implemented by the errors embedding Diagnostics
+type diagnosed interface {
+	diagnostics() *Diagnostics
+}
+
+func newDiagnostics() Diagnostics {
+	d := Diagnostics{InstanceID: newInstanceID()}
+	if rate := math.Float64frombits(stackSampleRate.Load()); rate > 0 && mrand.Float64() < rate {
+		d.Stack = captureStack()
+	}
+	return d
+}
+
+// WithContext returns a copy of ce carrying the trace ID of the span active in ctx,
+// ce is returned as is when ctx has no trace
+func (ce CustomError) WithContext(ctx context.Context) CustomError {
+	id := traceID(ctx)
+	if len(id) == 0 {
+		return ce
+	}
+	return ce.withDiagnostics(func(d *Diagnostics) { d.TraceID = id })
+}
+
+// ExposeStack returns a copy of ce marshalling its creation stack, it is kept internal by default
+// since it discloses the internals of the service, expose it only to trusted callers
+func (ce CustomError) ExposeStack() CustomError {
+	return ce.withDiagnostics(func(d *Diagnostics) { d.StackExposed = true })
+}
+
+// withDiagnostics copies the *CodeError or the *HTTPStatus of ce and applies set to the copy
+func (ce CustomError) withDiagnostics(set func(*Diagnostics)) CustomError {
+	var c *CodeError
+	var h *HTTPStatus
+	switch {
+	case errors.As(ce.IError, &c):
+		cp := *c
+		set(&cp.Diagnostics)
+		return CustomError{&cp}
+	case errors.As(ce.IError, &h):
+		cp := *h
+		set(&cp.Diagnostics)
+		return CustomError{&cp}
+	}
+	return ce
+}
+
+// traceID is the trace ID of the span active in ctx, empty when there is none
+func traceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// InstanceID returns the instance ID of err, empty if it is not an errors/json error
+func InstanceID(err error) string {
+	var d diagnosed
+	if errors.As(err, &d) {
+		return d.diagnostics().InstanceID
+	}
+	return ""
+}
+
+// TraceID returns the trace ID of err, empty if it has none
+func TraceID(err error) string {
+	var d diagnosed
+	if errors.As(err, &d) {
+		return d.diagnostics().TraceID
+	}
+	return ""
+}
+
+// Stack returns the creation stack of err, nil when it was not captured, for the logs
+func Stack(err error) []string {
+	var d diagnosed
+	if errors.As(err, &d) {
+		return d.diagnostics().Stack
+	}
+	return nil
+}
+
+func newInstanceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// captureStack lists the callers of the public constructor, the runtime frames excluded
+func captureStack() []string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(callersSkip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []string
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			stack = append(stack, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+// addTo sets the diagnostics as members of a problem document
+func (d Diagnostics) addTo(members map[string]interface{}) {
+	if len(d.InstanceID) > 0 {
+		members["instance_id"] = d.InstanceID
+	}
+	if len(d.TraceID) > 0 {
+		members["trace_id"] = d.TraceID
+	}
+	if stack := d.exposedStack(); len(stack) > 0 {
+		members["stack"] = stack
+	}
+}
+
+// exposedStack is the marshalled stack, nil unless exposed
+func (d Diagnostics) exposedStack() []string {
+	if !d.StackExposed {
+		return nil
+	}
+	return d.Stack
+}
+
+// takeDiagnostics removes the diagnostics members of a decoded problem document
+func takeDiagnostics(members map[string]interface{}) Diagnostics {
+	var d Diagnostics
+	d.InstanceID, _ = members["instance_id"].(string)
+	d.TraceID, _ = members["trace_id"].(string)
+	if frames, ok := members["stack"].([]interface{}); ok {
+		for _, f := range frames {
+			if s, ok := f.(string); ok {
+				d.Stack = append(d.Stack, s)
+			}
+		}
+		d.StackExposed = len(d.Stack) > 0
+	}
+	delete(members, "instance_id")
+	delete(members, "trace_id")
+	delete(members, "stack")
+	return d
+}
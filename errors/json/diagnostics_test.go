@@ -0,0 +1,70 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newDiagnosedError() CustomError {
+	return NewCustomHTTPStatus(StatusBadGateway, "/upstream")
+}
+
+func TestErrorDiagnostics(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	SetStackSampleRate(1)
+	captured := newDiagnosedError()
+	wrapped := WrapCodeError(errors.New("boom"), ErrServerError)
+	wrappedInCtx := WrapHTTPStatusContext(ctx, errors.New("boom"), StatusBadGateway)
+	SetStackSampleRate(0)
+	notCaptured := newDiagnosedError()
+
+	untracedOriginal := NewCustomCodeError(ErrAccessDenied)
+	traced := untracedOriginal.WithContext(ctx)
+	untraced := NewCustomCodeError(ErrAccessDenied).WithContext(context.Background())
+
+	b, merr := json.Marshal(traced)
+	var back CodeError
+	uerr := json.Unmarshal(b, &back)
+	exposed, _ := json.Marshal(captured.ExposeStack())
+	internal, _ := json.Marshal(captured)
+	internalProblem, _ := MarshalProblem(captured)
+	var exposedBack HTTPStatus
+	eerr := json.Unmarshal(exposed, &exposedBack)
+	problem, _ := MarshalProblem(captured.ExposeStack())
+	fromProblem, perr := ParseProblem(problem)
+
+	// the stack is marshalled only when exposed, WithContext and ExposeStack leave the error unchanged
+	tests.MaybeFail("error_diagnostics", merr, uerr, eerr, perr,
+		tests.Expect(len(InstanceID(captured)), 32),
+		tests.Expect(InstanceID(captured) != InstanceID(notCaptured), true),
+		tests.Expect(strings.HasPrefix(Stack(captured)[0], "gitlab.com/grpasr/common/errors/json.newDiagnosedError "), true),
+		tests.Expect(strings.HasPrefix(Stack(captured)[1], "gitlab.com/grpasr/common/errors/json.TestErrorDiagnostics "), true),
+		tests.Expect(strings.HasPrefix(Stack(wrapped)[0], "gitlab.com/grpasr/common/errors/json.TestErrorDiagnostics "), true),
+		tests.Expect(Stack(notCaptured), []string(nil)),
+		tests.Expect(strings.HasPrefix(Stack(wrappedInCtx)[0], "gitlab.com/grpasr/common/errors/json.TestErrorDiagnostics "), true),
+		tests.Expect(TraceID(wrappedInCtx), "4bf92f3577b34da6a3ce929d0e0e4736"),
+		tests.Expect(TraceID(NewCustomCodeErrorContext(context.Background(), ErrAccessDenied)), ""),
+		tests.Expect(TraceID(untracedOriginal), ""),
+		tests.Expect(TraceID(traced), "4bf92f3577b34da6a3ce929d0e0e4736"),
+		tests.Expect(TraceID(untraced), ""),
+		tests.Expect(TraceID(fmt.Errorf("calling: %w", traced)), "4bf92f3577b34da6a3ce929d0e0e4736"),
+		tests.Expect(InstanceID(errors.New("plain")), ""),
+		tests.Expect(back.Diagnostics, Diagnostics{InstanceID: InstanceID(traced), TraceID: TraceID(traced)}),
+		tests.Expect(strings.Contains(string(internal), `"stack"`), false),
+		tests.Expect(strings.Contains(string(internalProblem), `"stack"`), false),
+		tests.Expect(exposedBack.Stack, Stack(captured)),
+		tests.Expect(InstanceID(fromProblem), InstanceID(captured)),
+		tests.Expect(Stack(fromProblem), Stack(captured)))
+}
@@ -1,7 +1,9 @@
 package json
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -20,11 +22,124 @@ type CustomError struct {
 }
 
 func NewCustomCodeError(code ErrorCode, infos ...string) CustomError {
-	return CustomError{NewCodeError(code, infos...)}
+	return CustomError{newCodeError(code, infos...)}
 }
 
 func NewCustomHTTPStatus(code StatusCode, uri ...string) CustomError {
-	return CustomError{NewHTTPStatus(code, uri...)}
+	return CustomError{newHTTPStatus(code, uri...)}
+}
+
+// WrapCodeError keeps err as the cause, errors.Is and errors.As reach it through the CustomError
+func WrapCodeError(err error, code ErrorCode, infos ...string) CustomError {
+	ce := newCodeError(code, infos...)
+	ce.Cause = err
+	return CustomError{ce}
+}
+
+// WrapHTTPStatus keeps err as the cause, errors.Is and errors.As reach it through the CustomError
+func WrapHTTPStatus(err error, code StatusCode, uri ...string) CustomError {
+	he := newHTTPStatus(code, uri...)
+	he.Cause = err
+	return CustomError{he}
+}
+
+// NewCustomCodeErrorContext is NewCustomCodeError carrying the trace of the span active in ctx
+func NewCustomCodeErrorContext(ctx context.Context, code ErrorCode, infos ...string) CustomError {
+	ce := newCodeError(code, infos...)
+	ce.TraceID = traceID(ctx)
+	return CustomError{ce}
+}
+
+// NewCustomHTTPStatusContext is NewCustomHTTPStatus carrying the trace of the span active in ctx
+func NewCustomHTTPStatusContext(ctx context.Context, code StatusCode, uri ...string) CustomError {
+	he := newHTTPStatus(code, uri...)
+	he.TraceID = traceID(ctx)
+	return CustomError{he}
+}
+
+// WrapCodeErrorContext is WrapCodeError carrying the trace of the span active in ctx
+func WrapCodeErrorContext(ctx context.Context, err error, code ErrorCode, infos ...string) CustomError {
+	ce := newCodeError(code, infos...)
+	ce.Cause, ce.TraceID = err, traceID(ctx)
+	return CustomError{ce}
+}
+
+// WrapHTTPStatusContext is WrapHTTPStatus carrying the trace of the span active in ctx
+func WrapHTTPStatusContext(ctx context.Context, err error, code StatusCode, uri ...string) CustomError {
+	he := newHTTPStatus(code, uri...)
+	he.Cause, he.TraceID = err, traceID(ctx)
+	return CustomError{he}
+}
+
+// Unwrap gives errors.As access to the *CodeError or the *HTTPStatus
+func (ce CustomError) Unwrap() error {
+	return ce.IError
+}
+
+// ExposeCause marshals the message of the cause, it is kept internal by default
+func (ce CustomError) ExposeCause() CustomError {
+	var c *CodeError
+	var h *HTTPStatus
+	if errors.As(ce.IError, &c) {
+		c.CauseExposed = true
+	} else if errors.As(ce.IError, &h) {
+		h.CauseExposed = true
+	}
+	return ce
+}
+
+// causeMessage is the marshalled cause, empty unless exposed
+func causeMessage(cause error, exposed bool) string {
+	if cause == nil || !exposed {
+		return ""
+	}
+	return cause.Error()
+}
+
+// Redact copies ierr without its comment, cause, stack and payload, the keep entries of the payload excepted.
+// The code, the description and the instance and trace IDs are kept, an IError of another type becomes a 500
+func Redact(ierr IError, keep ...string) IError {
+	var c *CodeError
+	var h *HTTPStatus
+	switch {
+	case errors.As(ierr, &c):
+		redacted := *c
+		redacted.Comment, redacted.Payload, redacted.Stack = "", keptPayload(c.Payload, keep), nil
+		redacted.Cause, redacted.CauseExposed = nil, false
+		return CustomError{&redacted}
+	case errors.As(ierr, &h):
+		redacted := *h
+		redacted.Comment, redacted.Payload, redacted.Stack = "", keptPayload(h.Payload, keep), nil
+		redacted.Cause, redacted.CauseExposed = nil, false
+		return CustomError{&redacted}
+	}
+	return NewCustomHTTPStatus(StatusInternalServerError)
+}
+
+func keptPayload(payload map[string]interface{}, keep []string) map[string]interface{} {
+	var kept map[string]interface{}
+	for _, k := range keep {
+		if v, ok := payload[k]; ok {
+			if kept == nil {
+				kept = map[string]interface{}{}
+			}
+			kept[k] = v
+		}
+	}
+	return kept
+}
+
+// sameCode matches target when it is, or wraps, an IError of the same type and code
+func sameCode[T IError](code int, target error) bool {
+	if ce, ok := target.(CustomError); ok {
+		target = ce.IError
+	}
+	var nilT T
+	t, ok := target.(T)
+	if !ok || any(t) == any(nilT) {
+		return false
+	}
+	return t.GetCode() == code
 }
 
 func (ce CustomError) Error() string {
@@ -61,14 +176,24 @@ type CodeError struct {
 	Service string                 `json:"service,omitempty"`
 	Comment string                 `json:"comment,omitempty"`
 	Payload map[string]interface{} `json:"payload,omitempty"`
+	// Cause is the wrapped error, it is marshalled only when CauseExposed
+	Cause        error `json:"-"`
+	CauseExposed bool  `json:"-"`
+	Diagnostics
 }
 
 func NewCodeError(code ErrorCode, srv ...string) *CodeError {
+	return newCodeError(code, srv...)
+}
+
+// newCodeError is called by every constructor, the stack capture relies on it
+func newCodeError(code ErrorCode, srv ...string) *CodeError {
 	ce := &CodeError{
 		BaseError: BaseError{
 			Code:        int(code),
-			Description: ErrorCodeDescriptions[code],
+			Description: code.Description(),
 		},
+		Diagnostics: newDiagnostics(),
 	}
 	if len(srv) == 1 {
 		ce.Service = srv[0]
@@ -80,8 +205,15 @@ func NewCodeError(code ErrorCode, srv ...string) *CodeError {
 	return ce
 }
 
-// Error implements the error.Error interface
+// Error implements the error.Error interface, the cause is appended
 func (c *CodeError) Error() string {
+	if c.Cause != nil {
+		return fmt.Sprintf("%s, Cause: %v", c.message(), c.Cause)
+	}
+	return c.message()
+}
+
+func (c *CodeError) message() string {
 	if len(c.Service) > 0 && len(c.Comment) == 0 {
 		return fmt.Sprintf("%v : %v, Service: %s", c.Code, c.Description, c.Service)
 	} else if len(c.Service) > 0 && len(c.Comment) > 0 {
@@ -100,12 +232,18 @@ func (c *CodeError) MarshalJSON() ([]byte, error) {
 		Service string                 `json:"service,omitempty"`
 		Comment string                 `json:"comment,omitempty"`
 		Payload map[string]interface{} `json:"payload,omitempty"`
+		Cause   string                 `json:"cause,omitempty"`
+		Diagnostics
+		Stack []string `json:"stack,omitempty"`
 	}{
 
 		c.BaseError,
 		c.Service,
 		c.Comment,
 		c.Payload,
+		causeMessage(c.Cause, c.CauseExposed),
+		c.Diagnostics,
+		c.exposedStack(),
 	})
 }
 
@@ -116,6 +254,9 @@ func (c *CodeError) UnmarshalJSON(payload []byte) error {
 		Service string                 `json:"service,omitempty"`
 		Comment string                 `json:"comment,omitempty"`
 		Payload map[string]interface{} `json:"payload,omitempty"`
+		Cause   string                 `json:"cause,omitempty"`
+		Diagnostics
+		Stack []string `json:"stack,omitempty"`
 	}
 
 	var err error
@@ -125,10 +266,26 @@ func (c *CodeError) UnmarshalJSON(payload []byte) error {
 	c.Service = tmp.Service
 	c.Comment = tmp.Comment
 	c.Payload = tmp.Payload
+	c.Diagnostics = tmp.Diagnostics
+	c.Stack, c.StackExposed = tmp.Stack, len(tmp.Stack) > 0
+	c.Cause, c.CauseExposed = nil, false
+	if len(tmp.Cause) > 0 {
+		c.Cause, c.CauseExposed = errors.New(tmp.Cause), true
+	}
 
 	return err
 }
 
+// Unwrap returns the cause
+func (c *CodeError) Unwrap() error {
+	return c.Cause
+}
+
+// Is matches the *CodeError of the same code, wrapped in a CustomError or not
+func (c *CodeError) Is(target error) bool {
+	return sameCode[*CodeError](c.Code, target)
+}
+
 func (c *CodeError) GetCode() int {
 	return c.Code
 }
@@ -151,14 +308,24 @@ type HTTPStatus struct {
 	URI     string                 `json:"uri,omitempty"`
 	Comment string                 `json:"comment,omitempty"`
 	Payload map[string]interface{} `json:"payload,omitempty"`
+	// Cause is the wrapped error, it is marshalled only when CauseExposed
+	Cause        error `json:"-"`
+	CauseExposed bool  `json:"-"`
+	Diagnostics
 }
 
 func NewHTTPStatus(code StatusCode, infos ...string) *HTTPStatus {
+	return newHTTPStatus(code, infos...)
+}
+
+// newHTTPStatus is called by every constructor, the stack capture relies on it
+func newHTTPStatus(code StatusCode, infos ...string) *HTTPStatus {
 	he := &HTTPStatus{
 		BaseError: BaseError{
 			Code:        int(code),
 			Description: HTTPCodeDescriptions[code],
 		},
+		Diagnostics: newDiagnostics(),
 	}
 	if len(infos) > 0 {
 		he.URI = infos[0]
@@ -171,8 +338,15 @@ func NewHTTPStatus(code StatusCode, infos ...string) *HTTPStatus {
 	return he
 }
 
-// Error implements the error.Error interface
+// Error implements the error.Error interface, the cause is appended
 func (h *HTTPStatus) Error() string {
+	if h.Cause != nil {
+		return fmt.Sprintf("%s, Cause: %v", h.message(), h.Cause)
+	}
+	return h.message()
+}
+
+func (h *HTTPStatus) message() string {
 	if len(h.URI) > 0 && len(h.Comment) == 0 {
 		return fmt.Sprintf("%v : %v, Uri: %v", h.Code, h.Description, h.URI)
 	} else if len(h.URI) == 0 && len(h.Comment) > 0 {
@@ -191,11 +365,17 @@ func (h *HTTPStatus) MarshalJSON() ([]byte, error) {
 		URI     string                 `json:"uri,omitempty"`
 		Comment string                 `json:"comment,omitempty"`
 		Payload map[string]interface{} `json:"payload,omitempty"`
+		Cause   string                 `json:"cause,omitempty"`
+		Diagnostics
+		Stack []string `json:"stack,omitempty"`
 	}{
 		h.BaseError,
 		h.URI,
 		h.Comment,
 		h.Payload,
+		causeMessage(h.Cause, h.CauseExposed),
+		h.Diagnostics,
+		h.exposedStack(),
 	})
 }
 
@@ -207,6 +387,9 @@ func (h *HTTPStatus) UnmarshalJSON(payload []byte) error {
 		URI     string                 `json:"uri,omitempty"`
 		Comment string                 `json:"comment,omitempty"`
 		Payload map[string]interface{} `json:"payload,omitempty"`
+		Cause   string                 `json:"cause,omitempty"`
+		Diagnostics
+		Stack []string `json:"stack,omitempty"`
 	}
 
 	err = json.Unmarshal(payload, &tmp)
@@ -215,10 +398,26 @@ func (h *HTTPStatus) UnmarshalJSON(payload []byte) error {
 	h.URI = tmp.URI
 	h.Comment = tmp.Comment
 	h.Payload = tmp.Payload
+	h.Diagnostics = tmp.Diagnostics
+	h.Stack, h.StackExposed = tmp.Stack, len(tmp.Stack) > 0
+	h.Cause, h.CauseExposed = nil, false
+	if len(tmp.Cause) > 0 {
+		h.Cause, h.CauseExposed = errors.New(tmp.Cause), true
+	}
 
 	return err
 }
 
+// Unwrap returns the cause
+func (h *HTTPStatus) Unwrap() error {
+	return h.Cause
+}
+
+// Is matches the *HTTPStatus of the same code, wrapped in a CustomError or not
+func (h *HTTPStatus) Is(target error) bool {
+	return sameCode[*HTTPStatus](h.Code, target)
+}
+
 func (h *HTTPStatus) GetCode() int {
 	return h.Code
 }
@@ -1,8 +1,13 @@
 package json
 
 import (
-	"gitlab.com/grpasr/common/tests"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"testing"
+
+	"gitlab.com/grpasr/common/tests"
 )
 
 // CodeError
@@ -53,7 +58,7 @@ func TestCreateNewCodeErrorMarshalJSON(t *testing.T) {
 
 	res, err := nec.MarshalJSON()
 
-	tests.MaybeFail("Marshal_json", err, tests.Expect(string(res), `{"code":1003,"description":"The server encountered an internal error while processing the request","comment":"A specific comment"}`))
+	tests.MaybeFail("Marshal_json", err, tests.Expect(string(res), fmt.Sprintf(`{"code":1003,"description":"The server encountered an internal error while processing the request","comment":"A specific comment","instance_id":"%s"}`, InstanceID(nec))))
 }
 
 func TestCreateNewCodeErrorUnmarshalJSONBasic(t *testing.T) {
@@ -171,7 +176,7 @@ func TestCreateHTTPStatusErrorMarshalJSON(t *testing.T) {
 
 	res, err := nec.MarshalJSON()
 
-	tests.MaybeFail("Create_new_HTTPStatus_marshalJSON", err, tests.Expect(string(res), `{"code":400,"description":"Invalid request","comment":"A specific comment"}`))
+	tests.MaybeFail("Create_new_HTTPStatus_marshalJSON", err, tests.Expect(string(res), fmt.Sprintf(`{"code":400,"description":"Invalid request","comment":"A specific comment","instance_id":"%s"}`, InstanceID(nec))))
 }
 
 func TestCreateNewHTTPStatusUnmarshalJSONBasic(t *testing.T) {
@@ -243,3 +248,62 @@ func TestCreateNewHTTPStatusWithPayloadUnmarshalJSONWithService(t *testing.T) {
 		tests.Expect(nce.GetPayload()["string"], "a string"),
 		tests.Expect(nce.GetPayload()["int"].(float64), float64(34)))
 }
+
+// wrapping
+func TestWrapHTTPStatusKeepsTheCause(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	cause := fmt.Errorf("calling items: %w", context.DeadlineExceeded)
+	var err error = WrapHTTPStatus(cause, StatusServiceUnavailable, "/items")
+
+	var he *HTTPStatus
+	var ce *CodeError
+	asHTTPStatus := errors.As(err, &he)
+	asCodeError := errors.As(err, &ce)
+
+	tests.MaybeFail("wrap_http_status_keeps_the_cause",
+		tests.Expect(err.Error(), "503 : Service unavailable, Uri: /items, Cause: calling items: context deadline exceeded"),
+		tests.Expect(errors.Is(err, context.DeadlineExceeded), true),
+		tests.Expect(errors.Is(err, context.Canceled), false),
+		tests.Expect(asHTTPStatus, true),
+		tests.Expect(he.URI, "/items"),
+		tests.Expect(asCodeError, false),
+		tests.Expect(errors.Unwrap(he), cause))
+}
+
+func TestWrapCodeErrorMatchesByCode(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var err error = WrapCodeError(fs.ErrNotExist, ErrAccessDenied, "serviceX", "no key")
+	wrapped := fmt.Errorf("loading: %w", err)
+
+	var ce *CodeError
+	tests.MaybeFail("wrap_code_error_matches_by_code",
+		tests.Expect(err.Error(), "1002 : Access to the requested resource is denied, Service: serviceX, Comment: no key, Cause: file does not exist"),
+		tests.Expect(errors.Is(wrapped, NewCustomCodeError(ErrAccessDenied)), true),
+		tests.Expect(errors.Is(wrapped, NewCodeError(ErrAccessDenied, "another")), true),
+		tests.Expect(errors.Is(wrapped, NewCustomCodeError(ErrInvalidClient)), false),
+		tests.Expect(errors.Is(wrapped, NewCustomHTTPStatus(StatusCode(ErrAccessDenied))), false),
+		tests.Expect(errors.Is(wrapped, fs.ErrNotExist), true),
+		tests.Expect(errors.As(wrapped, &ce), true),
+		tests.Expect(ce.Service, "serviceX"))
+}
+
+func TestWrappedCauseIsNotMarshalledByDefault(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	err := WrapHTTPStatus(errors.New("dial tcp 10.0.0.3:5432: connection refused"), StatusInternalServerError)
+	internal, merr := err.MarshalJSON()
+	tests.MaybeFail("marshal_internal", merr)
+	exposed, merr := err.ExposeCause().MarshalJSON()
+	tests.MaybeFail("marshal_exposed", merr)
+
+	he := NewHTTPStatus(StatusOK)
+	uerr := he.UnmarshalJSON(exposed)
+
+	tests.MaybeFail("wrapped_cause_is_not_marshalled_by_default", uerr,
+		tests.Expect(string(internal), fmt.Sprintf(`{"code":500,"description":"Server error","instance_id":"%s"}`, InstanceID(err))),
+		tests.Expect(string(exposed), fmt.Sprintf(`{"code":500,"description":"Server error","cause":"dial tcp 10.0.0.3:5432: connection refused","instance_id":"%s"}`, InstanceID(err))),
+		tests.Expect(he.Cause.Error(), "dial tcp 10.0.0.3:5432: connection refused"),
+		tests.Expect(he.CauseExposed, true))
+}
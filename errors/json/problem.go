@@ -0,0 +1,230 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// MediaTypeProblem is the media type of the RFC 9457 problem documents
+const MediaTypeProblem = "application/problem+json"
+
+// ProblemTypeBaseURI prefixes the code of the error to build the problem type,
+// the type is about:blank while it is empty
+var ProblemTypeBaseURI = ""
+
+// problemMembers are the members of a problem document which are not extensions
+var problemMembers = map[string]bool{
+	"type": true, "title": true, "status": true, "detail": true, "instance": true,
+}
+
+// problemExtensions are the extensions NewProblem sets from the error itself,
+// payloadMember nests the payload entries named as one of them or as a problem member
+var problemExtensions = map[string]bool{
+	"code": true, "service": true, "cause": true, "instance_id": true, "trace_id": true, "stack": true,
+	payloadMember: true,
+}
+
+const payloadMember = "payload"
+
+// Problem is a RFC 9457 problem document, the Extensions are marshalled as top level members
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// NewProblem renders err as a problem document:
+// the comment is the detail, the URI the instance, the payload, the service,
+// the code of a CodeError, the exposed cause and the diagnostics are extensions.
+// The payload entries named as a member or as one of these extensions are nested
+// under the payload extension so that they override nothing
+func NewProblem(err IError) *Problem {
+	p := &Problem{Extensions: map[string]interface{}{}}
+	reserved := map[string]interface{}{}
+	for k, v := range err.GetPayload() {
+		if problemMembers[k] || problemExtensions[k] {
+			reserved[k] = v
+		} else {
+			p.Extensions[k] = v
+		}
+	}
+	if len(reserved) > 0 {
+		p.Extensions[payloadMember] = reserved
+	}
+
+	var c *CodeError
+	var h *HTTPStatus
+	switch {
+	case errors.As(err, &c):
+		p.Status = int(ErrorCode(c.Code).HTTPStatus())
+		p.Title = c.Description
+		p.Detail = c.Comment
+		p.Extensions["code"] = c.Code
+		if len(c.Service) > 0 {
+			p.Extensions["service"] = c.Service
+		}
+		if cause := causeMessage(c.Cause, c.CauseExposed); len(cause) > 0 {
+			p.Extensions["cause"] = cause
+		}
+		c.Diagnostics.addTo(p.Extensions)
+	case errors.As(err, &h):
+		p.Status = h.Code
+		p.Title = h.Description
+		p.Detail = h.Comment
+		p.Instance = h.URI
+		if cause := causeMessage(h.Cause, h.CauseExposed); len(cause) > 0 {
+			p.Extensions["cause"] = cause
+		}
+		h.Diagnostics.addTo(p.Extensions)
+	default:
+		p.Status = err.GetCode()
+		p.Detail = err.Error()
+	}
+
+	if p.Status < 100 || p.Status > 599 {
+		p.Status = int(StatusInternalServerError)
+	}
+	if len(p.Title) == 0 {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Type = "about:blank"
+	if len(ProblemTypeBaseURI) > 0 {
+		p.Type = fmt.Sprintf("%s/%d", ProblemTypeBaseURI, err.GetCode())
+	}
+	return p
+}
+
+// MarshalProblem renders err as an application/problem+json document
+func MarshalProblem(err IError) ([]byte, error) {
+	return NewProblem(err).MarshalJSON()
+}
+
+// IsProblem tells whether contentType is application/problem+json
+func IsProblem(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == MediaTypeProblem
+}
+
+// ParseProblem reads a problem document back into an IError,
+// a CodeError when it has the code extension of a known ErrorCode, a HTTPStatus otherwise
+func ParseProblem(b []byte) (IError, error) {
+	var p Problem
+	if err := p.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return p.IError(), nil
+}
+
+// IError converts the problem, the unknown extensions and the entries nested under
+// the payload extension are the payload
+func (p *Problem) IError() IError {
+	payload := make(map[string]interface{}, len(p.Extensions))
+	for k, v := range p.Extensions {
+		payload[k] = v
+	}
+	cause, _ := payload["cause"].(string)
+	delete(payload, "cause")
+	diagnostics := takeDiagnostics(payload)
+
+	if code, ok := payload["code"].(float64); ok {
+		if _, known := LookupErrorCode(ErrorCode(code)); known {
+			service, _ := payload["service"].(string)
+			delete(payload, "code")
+			delete(payload, "service")
+			unnestPayload(payload)
+			ce := NewCodeError(ErrorCode(code), service, p.Detail)
+			ce.Diagnostics = diagnostics
+			ce.SetPayload(payload)
+			if len(cause) > 0 {
+				ce.Cause, ce.CauseExposed = errors.New(cause), true
+			}
+			return CustomError{ce}
+		}
+	}
+
+	status := p.Status
+	if status == 0 {
+		status = int(StatusInternalServerError)
+	}
+	he := NewHTTPStatus(StatusCode(status), p.Instance, p.Detail)
+	if len(he.Description) == 0 {
+		he.Description = p.Title
+	}
+	he.Diagnostics = diagnostics
+	unnestPayload(payload)
+	he.SetPayload(payload)
+	if len(cause) > 0 {
+		he.Cause, he.CauseExposed = errors.New(cause), true
+	}
+	return CustomError{he}
+}
+
+// unnestPayload moves the entries of the payload extension back into payload
+func unnestPayload(payload map[string]interface{}) {
+	nested, ok := payload[payloadMember].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(payload, payloadMember)
+	for k, v := range nested {
+		payload[k] = v
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		if !problemMembers[k] {
+			doc[k] = v
+		}
+	}
+	doc["type"] = p.Type
+	doc["title"] = p.Title
+	doc["status"] = p.Status
+	if len(p.Detail) > 0 {
+		doc["detail"] = p.Detail
+	}
+	if len(p.Instance) > 0 {
+		doc["instance"] = p.Instance
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON implements the json.Unmarshaller interface,
+// the members of an unexpected type are ignored as RFC 9457 requires
+func (p *Problem) UnmarshalJSON(payload []byte) error {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return err
+	}
+
+	*p = Problem{Type: "about:blank", Extensions: map[string]interface{}{}}
+	for k, v := range doc {
+		switch k {
+		case "type":
+			if s, ok := v.(string); ok && len(s) > 0 {
+				p.Type = s
+			}
+		case "title":
+			p.Title, _ = v.(string)
+		case "status":
+			if f, ok := v.(float64); ok {
+				p.Status = int(f)
+			}
+		case "detail":
+			p.Detail, _ = v.(string)
+		case "instance":
+			p.Instance, _ = v.(string)
+		default:
+			p.Extensions[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func TestMarshalProblemHTTPStatus(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	he := NewCustomHTTPStatus(StatusNotFound, "/items/42", "item 42 does not exist")
+	he.SetPayload(map[string]interface{}{"item": "42", "status": "ignored"})
+
+	res, err := MarshalProblem(he)
+
+	tests.MaybeFail("marshal_problem_http_status", err,
+		tests.Expect(string(res), fmt.Sprintf(`{"detail":"item 42 does not exist","instance":"/items/42","instance_id":"%s","item":"42","payload":{"status":"ignored"},"status":404,"title":"Resource not found","type":"about:blank"}`, InstanceID(he))))
+}
+
+func TestMarshalProblemCodeError(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	ProblemTypeBaseURI = "https://errors.example.com"
+	defer func() { ProblemTypeBaseURI = "" }()
+
+	ce := WrapCodeError(errors.New("token expired"), ErrInvalidGrant, "auth", "refresh the token").ExposeCause()
+	internalErr := WrapCodeError(errors.New("token expired"), ErrInvalidGrant, "auth")
+	internal, err := MarshalProblem(internalErr)
+	tests.MaybeFail("marshal_internal", err)
+	res, err := MarshalProblem(ce)
+
+	tests.MaybeFail("marshal_problem_code_error", err,
+		tests.Expect(string(internal), fmt.Sprintf(`{"code":1006,"instance_id":"%s","service":"auth","status":400,"title":"The grant or authorization code is invalid or expired","type":"https://errors.example.com/1006"}`, InstanceID(internalErr))),
+		tests.Expect(string(res), fmt.Sprintf(`{"cause":"token expired","code":1006,"detail":"refresh the token","instance_id":"%s","service":"auth","status":400,"title":"The grant or authorization code is invalid or expired","type":"https://errors.example.com/1006"}`, InstanceID(ce))))
+}
+
+func TestParseProblem(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	he := NewCustomHTTPStatus(StatusMethodNotAllowed, "/items", "use POST")
+	he.SetPayload(map[string]interface{}{"allow": "POST"})
+	doc, _ := MarshalProblem(he)
+	back, err := ParseProblem(doc)
+	tests.MaybeFail("parse_http_status", err)
+
+	ce := NewCustomCodeError(ErrAccessDenied, "items", "no scope")
+	doc, _ = MarshalProblem(ce)
+	backCode, err := ParseProblem(doc)
+	tests.MaybeFail("parse_code_error", err)
+
+	foreign, err := ParseProblem([]byte(`{"type":"https://example.net/out-of-credit","title":"You do not have enough credit.","status":"403","balance":30}`))
+	tests.MaybeFail("parse_foreign", err)
+	_, invalid := ParseProblem([]byte(`not json`))
+
+	tests.MaybeFail("parse_problem",
+		tests.Expect(back.Error(), he.Error()),
+		tests.Expect(back.GetPayload()["allow"], "POST"),
+		tests.Expect(errors.Is(backCode, ce), true),
+		tests.Expect(backCode.Error(), ce.Error()),
+		tests.Expect(foreign.GetCode(), 500),
+		tests.Expect(foreign.GetPayload()["balance"], float64(30)),
+		tests.Expect(IsProblem("application/problem+json; charset=utf-8"), true),
+		tests.Expect(IsProblem("application/json"), false),
+		tests.Expect(invalid != nil, true))
+}
+
+func TestProblemPayloadCollisions(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	payload := map[string]interface{}{
+		"code": "SKU-1", "service": "billing", "cause": "stock", "instance_id": "i-1", "trace_id": "t-1",
+		"stack": "full", "payload": "raw", "title": "a title", "item": "42",
+	}
+	ce := NewCustomCodeError(ErrAccessDenied, "items", "no scope")
+	ce.SetPayload(payload)
+	he := NewCustomHTTPStatus(StatusConflict, "/items/42", "item 42 is locked")
+	he.SetPayload(payload)
+
+	ceDoc, err := MarshalProblem(ce)
+	tests.MaybeFail("marshal_code_error", err)
+	heDoc, err := MarshalProblem(he)
+	tests.MaybeFail("marshal_http_status", err)
+	ceBack, err := ParseProblem(ceDoc)
+	tests.MaybeFail("parse_code_error", err)
+	heBack, err := ParseProblem(heDoc)
+	tests.MaybeFail("parse_http_status", err)
+
+	tests.MaybeFail("problem_payload_collisions",
+		tests.Expect(errors.Is(ceBack, ce), true),
+		tests.Expect(InstanceID(ceBack), InstanceID(ce)),
+		tests.Expect(fmt.Sprint(ceBack.GetPayload()), fmt.Sprint(payload)),
+		tests.Expect(heBack.GetCode(), 409),
+		tests.Expect(InstanceID(heBack), InstanceID(he)),
+		tests.Expect(fmt.Sprint(heBack.GetPayload()), fmt.Sprint(payload)))
+}
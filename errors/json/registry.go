@@ -0,0 +1,130 @@
+package json
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrorCodeRange is a range of error codes owned by a service, the bounds are included
+type ErrorCodeRange struct {
+	Service string
+	First   ErrorCode
+	Last    ErrorCode
+}
+
+// ErrorCodeInfo describes a registered error code
+type ErrorCodeInfo struct {
+	Description string
+	// HTTPStatus is the status of the responses carrying the code, 500 if zero
+	HTTPStatus StatusCode
+	// Retryable tells the clients the request may succeed when sent again
+	Retryable bool
+}
+
+// CommonErrorCodes is the range of the codes declared in this package
+var CommonErrorCodes = ErrorCodeRange{Service: "common", First: 1000, Last: 1999}
+
+type errorCodeRegistry struct {
+	mu     sync.RWMutex
+	ranges []ErrorCodeRange
+	codes  map[ErrorCode]ErrorCodeInfo
+}
+
+var registry = &errorCodeRegistry{codes: map[ErrorCode]ErrorCodeInfo{}}
+
+func init() {
+	MustRegisterErrorCodes(CommonErrorCodes, map[ErrorCode]ErrorCodeInfo{
+		ErrInvalidRequest:         {Description: ErrorCodeDescriptions[ErrInvalidRequest], HTTPStatus: StatusBadRequest},
+		ErrUnauthorizedClient:     {Description: ErrorCodeDescriptions[ErrUnauthorizedClient], HTTPStatus: StatusUnauthorized},
+		ErrAccessDenied:           {Description: ErrorCodeDescriptions[ErrAccessDenied], HTTPStatus: StatusForbidden},
+		ErrServerError:            {Description: ErrorCodeDescriptions[ErrServerError], HTTPStatus: StatusInternalServerError},
+		ErrTemporarilyUnavailable: {Description: ErrorCodeDescriptions[ErrTemporarilyUnavailable], HTTPStatus: StatusServiceUnavailable, Retryable: true},
+		ErrInvalidClient:          {Description: ErrorCodeDescriptions[ErrInvalidClient], HTTPStatus: StatusUnauthorized},
+		ErrInvalidGrant:           {Description: ErrorCodeDescriptions[ErrInvalidGrant], HTTPStatus: StatusBadRequest},
+		ErrUnsupportedGrantType:   {Description: ErrorCodeDescriptions[ErrUnsupportedGrantType], HTTPStatus: StatusBadRequest},
+	})
+}
+
+// RegisterErrorCodes registers the range of a service and its codes, it fails when the range
+// overlaps a registered one, a code is out of the range, has no description or an invalid HTTP status.
+// The codes are registered from the init functions, before any error is built
+func RegisterErrorCodes(r ErrorCodeRange, codes map[ErrorCode]ErrorCodeInfo) error {
+	if len(r.Service) == 0 {
+		return fmt.Errorf("the service of the error codes %d-%d is missing", r.First, r.Last)
+	}
+	if r.First <= 0 || r.First > r.Last {
+		return fmt.Errorf("%s: invalid error codes range %d-%d", r.Service, r.First, r.Last)
+	}
+	for code, info := range codes {
+		if code < r.First || code > r.Last {
+			return fmt.Errorf("%s: the error code %d is out of the range %d-%d", r.Service, code, r.First, r.Last)
+		}
+		if len(info.Description) == 0 {
+			return fmt.Errorf("%s: the description of the error code %d is missing", r.Service, code)
+		}
+		if info.HTTPStatus != 0 && (info.HTTPStatus < 400 || info.HTTPStatus > 599) {
+			return fmt.Errorf("%s: the error code %d has the HTTP status %d, not an error status", r.Service, code, info.HTTPStatus)
+		}
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, registered := range registry.ranges {
+		if r.First <= registered.Last && registered.First <= r.Last {
+			return fmt.Errorf("%s: the error codes range %d-%d overlaps the range %d-%d of %s",
+				r.Service, r.First, r.Last, registered.First, registered.Last, registered.Service)
+		}
+	}
+	registry.ranges = append(registry.ranges, r)
+	sort.Slice(registry.ranges, func(i, j int) bool { return registry.ranges[i].First < registry.ranges[j].First })
+	for code, info := range codes {
+		if info.HTTPStatus == 0 {
+			info.HTTPStatus = StatusInternalServerError
+		}
+		registry.codes[code] = info
+	}
+	return nil
+}
+
+// MustRegisterErrorCodes is RegisterErrorCodes panicking on error, for the init functions
+func MustRegisterErrorCodes(r ErrorCodeRange, codes map[ErrorCode]ErrorCodeInfo) {
+	if err := RegisterErrorCodes(r, codes); err != nil {
+		panic(err)
+	}
+}
+
+// LookupErrorCode returns the registered description of code
+func LookupErrorCode(code ErrorCode) (ErrorCodeInfo, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	info, ok := registry.codes[code]
+	return info, ok
+}
+
+// ErrorCodeRanges lists the registered ranges in the codes order
+func ErrorCodeRanges() []ErrorCodeRange {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return append([]ErrorCodeRange(nil), registry.ranges...)
+}
+
+// Description is the registered description of the code, empty if unknown
+func (c ErrorCode) Description() string {
+	info, _ := LookupErrorCode(c)
+	return info.Description
+}
+
+// HTTPStatus is the HTTP status of the responses carrying the code, 500 for the unknown codes
+func (c ErrorCode) HTTPStatus() StatusCode {
+	if info, ok := LookupErrorCode(c); ok {
+		return info.HTTPStatus
+	}
+	return StatusInternalServerError
+}
+
+// Retryable tells whether the request failing with the code may succeed when sent again
+func (c ErrorCode) Retryable() bool {
+	info, _ := LookupErrorCode(c)
+	return info.Retryable
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"net/http"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+const (
+	errItemLocked   ErrorCode = 42001
+	errItemConflict ErrorCode = 42002
+)
+
+// unregisterErrorCodes removes the range r and its codes from the registry
+func unregisterErrorCodes(r ErrorCodeRange) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for i, registered := range registry.ranges {
+		if registered == r {
+			registry.ranges = append(registry.ranges[:i], registry.ranges[i+1:]...)
+			break
+		}
+	}
+	for code := range registry.codes {
+		if code >= r.First && code <= r.Last {
+			delete(registry.codes, code)
+		}
+	}
+}
+
+func TestRegisterErrorCodes(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	items := ErrorCodeRange{Service: "items", First: 42000, Last: 42099}
+	t.Cleanup(func() { unregisterErrorCodes(items) })
+	err := RegisterErrorCodes(items, map[ErrorCode]ErrorCodeInfo{
+		errItemLocked:   {Description: "The item is locked by another user", HTTPStatus: StatusLocked, Retryable: true},
+		errItemConflict: {Description: "The item was modified concurrently"},
+	})
+	tests.MaybeFail("register_items", err)
+
+	overlap := RegisterErrorCodes(ErrorCodeRange{Service: "orders", First: 42050, Last: 42150}, nil)
+	duplicate := RegisterErrorCodes(items, nil)
+	outOfRange := RegisterErrorCodes(ErrorCodeRange{Service: "orders", First: 43000, Last: 43099},
+		map[ErrorCode]ErrorCodeInfo{44000: {Description: "out"}})
+	notAnError := RegisterErrorCodes(ErrorCodeRange{Service: "orders", First: 43000, Last: 43099},
+		map[ErrorCode]ErrorCodeInfo{43001: {Description: "ok", HTTPStatus: StatusOK}})
+	noDescription := RegisterErrorCodes(ErrorCodeRange{Service: "orders", First: 43000, Last: 43099},
+		map[ErrorCode]ErrorCodeInfo{43001: {}})
+	noService := RegisterErrorCodes(ErrorCodeRange{First: 43000, Last: 43099}, nil)
+
+	ce := NewCustomCodeError(errItemLocked, "items")
+	ranges := ErrorCodeRanges()
+
+	tests.MaybeFail("register_error_codes",
+		tests.Expect(ce.Error(), "42001 : The item is locked by another user, Service: items"),
+		tests.Expect(errItemLocked.HTTPStatus(), StatusLocked),
+		tests.Expect(errItemLocked.Retryable(), true),
+		tests.Expect(errItemConflict.Description(), "The item was modified concurrently"),
+		tests.Expect(ErrorCodeDescriptions[errItemConflict], ""),
+		tests.Expect(errItemConflict.HTTPStatus(), StatusInternalServerError),
+		tests.Expect(errItemConflict.Retryable(), false),
+		tests.Expect(ErrTemporarilyUnavailable.Retryable(), true),
+		tests.Expect(ErrAccessDenied.HTTPStatus(), StatusForbidden),
+		tests.Expect(ErrorCode(42050).HTTPStatus(), StatusInternalServerError),
+		tests.Expect(overlap.Error(), "orders: the error codes range 42050-42150 overlaps the range 42000-42099 of items"),
+		tests.Expect(duplicate != nil, true),
+		tests.Expect(outOfRange.Error(), "orders: the error code 44000 is out of the range 43000-43099"),
+		tests.Expect(notAnError.Error(), "orders: the error code 43001 has the HTTP status 200, not an error status"),
+		tests.Expect(noDescription.Error(), "orders: the description of the error code 43001 is missing"),
+		tests.Expect(noService != nil, true),
+		tests.Expect(ranges[0], CommonErrorCodes),
+		tests.Expect(ranges[len(ranges)-1], items))
+}
+
+func TestHTTPStatusCatalog(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	missing := []int{}
+	for code := 100; code < 600; code++ {
+		if len(http.StatusText(code)) > 0 && len(HTTPCodeDescriptions[StatusCode(code)]) == 0 {
+			missing = append(missing, code)
+		}
+	}
+
+	tests.MaybeFail("http_status_catalog",
+		tests.Expect(missing, []int{}),
+		tests.Expect(NewCustomHTTPStatus(StatusTooManyRequests).Error(), "429 : Too many requests"))
+}
@@ -0,0 +1,183 @@
+// Package faultinjection injects latency, error statuses, connection resets and truncated bodies
+// into the HTTP exchanges, as a client transport or a server middleware, to rehearse outages.
+// It is hard-disabled when GOENV is production.
+package faultinjection
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/grpasr/common/configloader"
+)
+
+const (
+	// FaultInjectedHeader is set on the responses altered by a rule, to the rule name
+	FaultInjectedHeader = "X-Fault-Injected"
+	configKey           = "faultinjection"
+)
+
+// Rule describes a fault and the requests it applies to, the empty matchers match everything
+type Rule struct {
+	Name string `mapstructure:"name"`
+	// Host matches the request host, with or without the port, path.Match patterns like *.svc are accepted
+	Host string `mapstructure:"host"`
+	// Path matches the request path, path.Match patterns like /items/* are accepted
+	Path   string `mapstructure:"path"`
+	Method string `mapstructure:"method"`
+	// Headers must all be present on the request with these values
+	Headers map[string]string `mapstructure:"headers"`
+	// Probability is the chance of the rule to apply to a matching request, 0 never applies it
+	Probability float64 `mapstructure:"probability"`
+
+	// LatencyMs delays the request, LatencyJitterMs adds a random delay up to its value
+	LatencyMs       int `mapstructure:"latency_ms"`
+	LatencyJitterMs int `mapstructure:"latency_jitter_ms"`
+	// Status answers the request with this status without reaching the server or the handler
+	Status int `mapstructure:"status"`
+	// Reset resets the connection
+	Reset bool `mapstructure:"reset"`
+	// TruncateBytes cuts the response body after this number of bytes, 0 disables it
+	TruncateBytes int `mapstructure:"truncate_bytes"`
+}
+
+// Config holds the rules, the first matching rule applies
+type Config struct {
+	// GOENV determines the environment, the injection is disabled when it or the process GOENV is production
+	GOENV string `mapstructure:"-"`
+	// Seed makes the probabilities reproducible, 0 seeds with the time
+	Seed  int64  `mapstructure:"seed"`
+	Rules []Rule `mapstructure:"rules"`
+}
+
+// ConfigLoader is the configloader's loaderConfig
+type ConfigLoader interface {
+	LDRGetGOENV() string
+	LDRUnmarshalKey(key string, out interface{}) error
+}
+
+// LoadConfig reads the faultinjection section of the loaded configuration,
+// the section under the GOENV one takes precedence
+func LoadConfig(loader ConfigLoader) (*Config, error) {
+	conf := &Config{GOENV: loader.LDRGetGOENV()}
+	if err := loader.LDRUnmarshalKey(configKey, conf); err != nil {
+		return nil, fmt.Errorf("invalid %s configuration: %v", configKey, err)
+	}
+	return conf, nil
+}
+
+// Injector selects the fault of the requests, a nil Injector injects nothing
+type Injector struct {
+	rules []Rule
+	mu    sync.Mutex
+	rand  *rand.Rand
+}
+
+// NewInjector validates the rules, it returns a nil Injector in production
+// or without rules so the transport and the middleware pass the requests through
+func NewInjector(conf *Config) (*Injector, error) {
+	if conf == nil || len(conf.Rules) == 0 || configloader.IsProductionEnv(conf.GOENV) {
+		return nil, nil
+	}
+	for i, r := range conf.Rules {
+		if r.Probability < 0 || r.Probability > 1 {
+			return nil, fmt.Errorf("rule %d %s: the probability must be between 0 and 1", i, r.Name)
+		}
+		if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+			return nil, fmt.Errorf("rule %d %s: invalid status %d", i, r.Name, r.Status)
+		}
+		if r.LatencyMs < 0 || r.LatencyJitterMs < 0 || r.TruncateBytes < 0 {
+			return nil, fmt.Errorf("rule %d %s: the latency and the truncation can not be negative", i, r.Name)
+		}
+		for _, pattern := range []string{r.Host, r.Path} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d %s: invalid pattern %s", i, r.Name, pattern)
+			}
+		}
+	}
+
+	seed := conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		rules: append([]Rule(nil), conf.Rules...),
+		rand:  rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// fault returns the rule applying to the request, nil if none
+func (in *Injector) fault(host string, r *http.Request) *Rule {
+	if in == nil {
+		return nil
+	}
+	for i := range in.rules {
+		rule := &in.rules[i]
+		if !rule.matches(host, r) {
+			continue
+		}
+		in.mu.Lock()
+		draw := in.rand.Float64()
+		in.mu.Unlock()
+		if draw < rule.Probability {
+			return rule
+		}
+		return nil
+	}
+	return nil
+}
+
+func (r *Rule) matches(host string, req *http.Request) bool {
+	if len(r.Method) > 0 && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	if len(r.Host) > 0 {
+		hostname := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+		ok, _ := path.Match(r.Host, host)
+		okName, _ := path.Match(r.Host, hostname)
+		if !ok && !okName {
+			return false
+		}
+	}
+	if len(r.Path) > 0 {
+		if ok, _ := path.Match(r.Path, req.URL.Path); !ok {
+			return false
+		}
+	}
+	for k, v := range r.Headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// delay sleeps the rule latency, it returns early when ctx is done
+func (in *Injector) delay(ctx context.Context, rule *Rule) error {
+	d := time.Duration(rule.LatencyMs) * time.Millisecond
+	if rule.LatencyJitterMs > 0 {
+		in.mu.Lock()
+		d += time.Duration(in.rand.Intn(rule.LatencyJitterMs+1)) * time.Millisecond
+		in.mu.Unlock()
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,173 @@
+package faultinjection
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/configloader"
+	"gitlab.com/grpasr/common/tests"
+)
+
+func newTestInjector(t *testing.T, rules ...Rule) *Injector {
+	in, err := NewInjector(&Config{GOENV: configloader.LocalhostENV, Seed: 1, Rules: rules})
+	tests.MaybeFail("new_injector", err)
+	return in
+}
+
+func Test_transport_injects_the_faults(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(newTestInjector(t,
+		Rule{Name: "down", Path: "/down", Probability: 1, Status: http.StatusServiceUnavailable},
+		Rule{Name: "reset", Path: "/reset", Probability: 1, Reset: true},
+		Rule{Name: "truncate", Path: "/truncate", Probability: 1, TruncateBytes: 5},
+		Rule{Name: "slow", Path: "/slow", Method: "POST", Probability: 1, LatencyMs: 50},
+		Rule{Name: "never", Probability: 0, Status: http.StatusInternalServerError},
+	), nil)}
+
+	down, err := client.Get(srv.URL + "/down")
+	tests.MaybeFail("down", err)
+	downBody, _ := io.ReadAll(down.Body)
+
+	_, resetErr := client.Get(srv.URL + "/reset")
+
+	truncated, err := client.Get(srv.URL + "/truncate")
+	tests.MaybeFail("truncate", err)
+	truncatedBody, truncatedErr := io.ReadAll(truncated.Body)
+
+	start := time.Now()
+	slow, err := client.Post(srv.URL+"/slow", "application/json", nil)
+	tests.MaybeFail("slow", err)
+	slowElapsed := time.Since(start)
+
+	start = time.Now()
+	fast, err := client.Get(srv.URL + "/slow")
+	tests.MaybeFail("fast", err)
+
+	tests.MaybeFail("transport_injects_the_faults",
+		tests.Expect(down.StatusCode, http.StatusServiceUnavailable),
+		tests.Expect(down.Header.Get(FaultInjectedHeader), "down"),
+		tests.Expect(string(downBody), `{"error_code":503,"message":"fault injected by down"}`),
+		tests.Expect(errors.Is(resetErr, syscall.ECONNRESET), true),
+		tests.Expect(string(truncatedBody), `{"nam`),
+		tests.Expect(truncatedErr, io.ErrUnexpectedEOF),
+		tests.Expect(slowElapsed >= 50*time.Millisecond, true),
+		tests.Expect(slow.Header.Get(FaultInjectedHeader), "slow"),
+		tests.Expect(fast.Header.Get(FaultInjectedHeader), ""),
+		tests.Expect(time.Since(start) < 50*time.Millisecond, true),
+		tests.Expect(calls, 3))
+}
+
+func Test_middleware_injects_the_faults(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	handler := Middleware(newTestInjector(t,
+		Rule{Name: "tenant-down", Headers: map[string]string{"X-Tenant": "acme"}, Probability: 1, Status: http.StatusServiceUnavailable},
+		Rule{Name: "reset", Path: "/reset", Probability: 1, Reset: true},
+		Rule{Name: "truncate", Host: "127.0.0.1", Path: "/truncate", Probability: 1, TruncateBytes: 5},
+	))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"item",`))
+		w.Write([]byte(`"count":1}`))
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/items", nil)
+	req.Header.Set("X-Tenant", "acme")
+	down, err := http.DefaultClient.Do(req)
+	tests.MaybeFail("tenant_down", err)
+	downBody, _ := io.ReadAll(down.Body)
+
+	_, resetErr := http.Get(srv.URL + "/reset")
+
+	truncated, err := http.Get(srv.URL + "/truncate")
+	tests.MaybeFail("truncate", err)
+	truncatedBody, truncatedErr := io.ReadAll(truncated.Body)
+
+	ok, err := http.Get(srv.URL + "/items")
+	tests.MaybeFail("items", err)
+	okBody, _ := io.ReadAll(ok.Body)
+
+	tests.MaybeFail("middleware_injects_the_faults",
+		tests.Expect(down.StatusCode, http.StatusServiceUnavailable),
+		tests.Expect(down.Header.Get(FaultInjectedHeader), "tenant-down"),
+		tests.Expect(strings.HasPrefix(string(downBody), `{"code":503,"description":"Service unavailable","comment":"fault injected by tenant-down","instance_id":"`), true),
+		tests.Expect(resetErr != nil, true),
+		tests.Expect(string(truncatedBody), `{"nam`),
+		tests.Expect(truncatedErr != nil, true),
+		tests.Expect(string(okBody), `{"name":"item","count":1}`))
+}
+
+func Test_injector_is_disabled_in_production(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	rules := []Rule{{Name: "down", Probability: 1, Status: http.StatusServiceUnavailable}}
+	prod, err := NewInjector(&Config{GOENV: configloader.ProductionENV, Rules: rules})
+	tests.MaybeFail("production_injector", err)
+
+	_, invalid := NewInjector(&Config{GOENV: configloader.StagingENV, Rules: []Rule{{Probability: 2}}})
+
+	t.Setenv("GOENV", configloader.ProductionENV)
+	fromEnv, err := NewInjector(&Config{Rules: rules})
+	tests.MaybeFail("process_env_injector", err)
+
+	// the config of another environment does not enable the faults in a production process
+	devConfig, err := NewInjector(&Config{GOENV: configloader.DevelopmentENV, Rules: rules})
+	tests.MaybeFail("development_config_injector", err)
+
+	next := http.DefaultTransport
+	tests.MaybeFail("injector_is_disabled_in_production",
+		tests.Expect(prod == nil, true),
+		tests.Expect(fromEnv == nil, true),
+		tests.Expect(devConfig == nil, true),
+		tests.Expect(NewTransport(prod, next) == next, true),
+		tests.Expect(invalid != nil, true))
+}
+
+func Test_probability_and_load_config(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	lc := configloader.NewLoaderConfig(configloader.StagingENV)
+	tests.MaybeFail("load_configs", lc.LDRLoadConfigs("faultinjection", "yaml", "./tests/"))
+	staging, err := LoadConfig(lc)
+	tests.MaybeFail("load_staging", err)
+
+	local, err := LoadConfig(configloader.NewLoaderConfig(configloader.LocalhostENV))
+	tests.MaybeFail("load_localhost", err)
+
+	in, err := NewInjector(local)
+	tests.MaybeFail("new_injector", err)
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	applied := 0
+	for i := 0; i < 1000; i++ {
+		if in.fault(req.Host, req) != nil {
+			applied++
+		}
+	}
+
+	tests.MaybeFail("probability_and_load_config",
+		tests.Expect(staging.GOENV, configloader.StagingENV),
+		tests.Expect(staging.Rules, []Rule{{
+			Name:        "payments-down",
+			Host:        "*.payments.svc",
+			Headers:     map[string]string{"x-tenant": "acme"},
+			Probability: 1,
+			Status:      503,
+		}}),
+		tests.Expect(local.Seed, int64(42)),
+		tests.Expect(local.Rules[0].LatencyJitterMs, 50),
+		tests.Expect(applied > 400 && applied < 600, true))
+}
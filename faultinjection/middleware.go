@@ -0,0 +1,86 @@
+package faultinjection
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	e "gitlab.com/grpasr/common/errors/json"
+)
+
+// Middleware injects the faults into the requests served by next, a nil injector passes them through
+func Middleware(injector *Injector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if injector == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := injector.fault(r.Host, r)
+			if rule == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := injector.delay(r.Context(), rule); err != nil {
+				return
+			}
+			if rule.Reset {
+				resetConnection(w)
+				return
+			}
+			w.Header().Set(FaultInjectedHeader, rule.Name)
+			if rule.Status != 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(rule.Status)
+				json.NewEncoder(w).Encode(e.NewCustomHTTPStatus(e.StatusCode(rule.Status), "", "fault injected by "+rule.Name))
+				return
+			}
+			if rule.TruncateBytes > 0 {
+				w = &truncatingWriter{ResponseWriter: w, remaining: rule.TruncateBytes}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resetConnection closes the connection with a TCP RST, the server aborts
+// the connection when it can not be hijacked, HTTP/2 streams are reset
+func resetConnection(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				tcp.SetLinger(0)
+			}
+			conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// truncatingWriter aborts the response once remaining bytes of the body were written,
+// the client receives a truncated body
+type truncatingWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (tw *truncatingWriter) WriteHeader(code int) {
+	// the Content-Length would let the client detect the truncation before reading
+	tw.Header().Del("Content-Length")
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *truncatingWriter) Write(p []byte) (int, error) {
+	if len(p) <= tw.remaining {
+		tw.remaining -= len(p)
+		return tw.ResponseWriter.Write(p)
+	}
+	tw.Header().Del("Content-Length")
+	tw.ResponseWriter.Write(p[:tw.remaining])
+	tw.remaining = 0
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
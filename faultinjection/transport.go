@@ -0,0 +1,114 @@
+package faultinjection
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+)
+
+// Transport injects the faults into the requests of a http.Client
+type Transport struct {
+	injector *Injector
+	next     http.RoundTripper
+}
+
+// NewTransport wraps next, http.DefaultTransport if nil, a nil injector passes the requests through
+func NewTransport(injector *Injector, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if injector == nil {
+		return next
+	}
+	return &Transport{injector: injector, next: next}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule := t.injector.fault(req.URL.Host, req)
+	if rule == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	if err := t.injector.delay(req.Context(), rule); err != nil {
+		return nil, err
+	}
+	if rule.Reset {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("fault injected by %s: %w", rule.Name, syscall.ECONNRESET)
+	}
+	if rule.Status != 0 {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return faultResponse(req, rule), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set(FaultInjectedHeader, rule.Name)
+	if rule.TruncateBytes > 0 {
+		resp.Body = &truncatedBody{body: resp.Body, remaining: rule.TruncateBytes}
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *Transport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// faultResponse is the response of a status rule, its body is a restclient RestError
+func faultResponse(req *http.Request, rule *Rule) *http.Response {
+	body := []byte(fmt.Sprintf(`{"error_code":%d,"message":"fault injected by %s"}`, rule.Status, rule.Name))
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(FaultInjectedHeader, rule.Name)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rule.Status, http.StatusText(rule.Status)),
+		StatusCode:    rule.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF once remaining bytes were read
+type truncatedBody struct {
+	body      io.ReadCloser
+	remaining int
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// a body of exactly the limit is not truncated
+		var one [1]byte
+		if n, err := b.body.Read(one[:]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= n
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,40 @@
+// Package idempotency holds the responses stored by idempotency key and the contract of their stores,
+// it is shared by the apiserver middleware and the database stores.
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// InProgressCode is the StatusCode of a key whose first request is in progress
+const InProgressCode = 0
+
+// Response is the stored response of a key,
+// StatusCode is InProgressCode while the first request is in progress
+type Response struct {
+	Fingerprint string      `json:"fingerprint" bson:"fingerprint"`
+	StatusCode  int         `json:"status_code" bson:"status_code"`
+	Header      http.Header `json:"header" bson:"header"`
+	Body        []byte      `json:"body" bson:"body"`
+	ExpiresAt   time.Time   `json:"expires_at" bson:"expires_at"`
+}
+
+// InProgress tells whether the first request of the key is still in progress
+func (r *Response) InProgress() bool {
+	return r.StatusCode == InProgressCode
+}
+
+// Store keeps the responses by idempotency key
+type Store interface {
+	// Reserve claims the key for a new request until the lease expires, if the key is
+	// already claimed and not expired it returns the stored response and false
+	Reserve(ctx context.Context, key, fingerprint string, lease time.Duration) (*Response, bool, error)
+	// Renew extends the lease of the key while its request is in progress
+	Renew(ctx context.Context, key string, lease time.Duration) error
+	// Complete stores the response of the claimed key, kept until its ExpiresAt
+	Complete(ctx context.Context, key string, resp *Response) error
+	// Release frees the key, the request can be sent again
+	Release(ctx context.Context, key string) error
+}
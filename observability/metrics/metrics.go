@@ -13,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/global"
 	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"time"
@@ -54,6 +55,14 @@ func (m *meterHandler) MTHInt64Counter(name string, iopt instrument.Option) (ins
 	return m.meter.Int64Counter(name, iopt)
 }
 
+func (m *meterHandler) MTHInt64Histogram(name string, iopts ...instrument.Int64Option) (instrument.Int64Histogram, error) {
+	return m.meter.Int64Histogram(name, iopts...)
+}
+
+func (m *meterHandler) MTHFloat64Histogram(name string, iopts ...instrument.Float64Option) (instrument.Float64Histogram, error) {
+	return m.meter.Float64Histogram(name, iopts...)
+}
+
 type instrumentHandler struct{}
 
 func newInstrumentHandler() *instrumentHandler {
@@ -64,10 +73,22 @@ func (i *instrumentHandler) ISOWithDescription(desc string) instrument.Option {
 	return instrument.WithDescription(desc)
 }
 
+func (i *instrumentHandler) ISOWithUnit(u unit.Unit) instrument.Option {
+	return instrument.WithUnit(u)
+}
+
 func (i *instrumentHandler) ISOAdd(ctx context.Context, instr instrument.Int64Counter, incr int64, attrs ...attribute.KeyValue) {
 	instr.Add(ctx, incr, attrs...)
 }
 
+func (i *instrumentHandler) ISORecordInt64(ctx context.Context, instr instrument.Int64Histogram, v int64, attrs ...attribute.KeyValue) {
+	instr.Record(ctx, v, attrs...)
+}
+
+func (i *instrumentHandler) ISORecordFloat64(ctx context.Context, instr instrument.Float64Histogram, v float64, attrs ...attribute.KeyValue) {
+	instr.Record(ctx, v, attrs...)
+}
+
 func SetupMetrics(ctx context.Context, c *tls.Config, sec int, serviceName, endpoint, environment string) (*sdkmetric.MeterProvider, error) {
 	exporter, err := otlpmetricgrpc.New(
 		ctx,
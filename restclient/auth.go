@@ -0,0 +1,213 @@
+package restclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator adds the credentials to an outgoing request,
+// body is the encoded request body, nil when there is none
+type Authenticator interface {
+	Authenticate(req *http.Request, body []byte) error
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface
+type AuthenticatorFunc func(req *http.Request, body []byte) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// principalHolder is implemented by the authenticators whose Authorization header
+// changes from one request to the next, the cache keys their responses by principal instead
+type principalHolder interface {
+	principal() string
+}
+
+// credentialsHolder is implemented by the authenticators placing secrets
+// outside of the Authorization header, the request logger redacts them
+type credentialsHolder interface {
+	credentialHeaders() []string
+	credentialQueryParams() []string
+}
+
+// newAuthenticator returns the authenticator identified on the configured credentials source
+func newAuthenticator(service *url.URL, conf *Config) (Authenticator, error) {
+	// Remove userinfo from url regardless of source to avoid confusion/conflicts
+	defer func() {
+		service.User = nil
+	}()
+
+	if conf.Authenticator != nil {
+		return conf.Authenticator, nil
+	}
+
+	source := conf.BasicAuthCredentialsSource
+
+	switch strings.ToUpper(source) {
+	case "", "NONE":
+		return nil, nil
+	case "URL":
+		if service.User == nil {
+			return nil, nil
+		}
+		password, _ := service.User.Password()
+		return NewBasicAuthenticator(service.User.Username(), password), nil
+	case "USER_INFO":
+		return NewBasicAuthenticatorFromUserInfo(conf.BasicAuthUserInfo)
+	case "BEARER", "BASIC":
+		token := strings.TrimSpace(conf.AuthCredentialsDatas.Token)
+		token = strings.Trim(token, `"`)
+		return &tokenAuthenticator{scheme: string(conf.AuthCredentialsDatas.AuthType), token: token}, nil
+	}
+	return nil, fmt.Errorf("unrecognized value for basic.auth.credentials.source %s", source)
+}
+
+// BasicAuthenticator sends the HTTP Basic credentials
+type BasicAuthenticator struct {
+	username string
+	password string
+}
+
+func NewBasicAuthenticator(username, password string) *BasicAuthenticator {
+	return &BasicAuthenticator{username, password}
+}
+
+// NewBasicAuthenticatorFromUserInfo reads user info in the form of {username}:{password}
+func NewBasicAuthenticatorFromUserInfo(userinfo string) (*BasicAuthenticator, error) {
+	username, password, found := strings.Cut(userinfo, ":")
+	if !found || len(username) == 0 {
+		return nil, fmt.Errorf("BasicAuthUserInfo must be in the form of {username}:{password}")
+	}
+	return NewBasicAuthenticator(username, password), nil
+}
+
+func (b *BasicAuthenticator) Authenticate(req *http.Request, _ []byte) error {
+	req.Header.Set("Authorization", "Basic "+encodeBasicAuth(b.username+":"+b.password))
+	return nil
+}
+
+// tokenAuthenticator sends a static token with its scheme
+type tokenAuthenticator struct {
+	scheme string
+	token  string
+}
+
+// NewBearerAuthenticator sends a static bearer token
+func NewBearerAuthenticator(token string) Authenticator {
+	return &tokenAuthenticator{scheme: string(Bearer), token: token}
+}
+
+func (t *tokenAuthenticator) Authenticate(req *http.Request, _ []byte) error {
+	req.Header.Set("Authorization", fmt.Sprintf("%s %s", t.scheme, t.token))
+	return nil
+}
+
+type APIKeyLocation string
+
+const (
+	APIKeyInHeader APIKeyLocation = "header"
+	APIKeyInQuery  APIKeyLocation = "query"
+)
+
+// APIKeyAuthenticator sends an API key in a header or a query parameter
+type APIKeyAuthenticator struct {
+	name     string
+	key      string
+	location APIKeyLocation
+}
+
+func NewAPIKeyAuthenticator(name, key string, location APIKeyLocation) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{name, key, location}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(req *http.Request, _ []byte) error {
+	switch a.location {
+	case APIKeyInQuery:
+		q := req.URL.Query()
+		q.Set(a.name, a.key)
+		req.URL.RawQuery = q.Encode()
+	case APIKeyInHeader, "":
+		req.Header.Set(a.name, a.key)
+	default:
+		return fmt.Errorf("unknown API key location %s", a.location)
+	}
+	return nil
+}
+
+func (a *APIKeyAuthenticator) credentialHeaders() []string {
+	if a.location == APIKeyInQuery {
+		return nil
+	}
+	return []string{a.name}
+}
+
+func (a *APIKeyAuthenticator) credentialQueryParams() []string {
+	if a.location == APIKeyInQuery {
+		return []string{a.name}
+	}
+	return nil
+}
+
+// HMACAuthenticator signs the requests with HMAC-SHA256, the string to sign is
+//
+//	METHOD\nPATH?QUERY\nTIMESTAMP\nHEX(SHA256(BODY))
+//
+// and the Authorization header is HMAC-SHA256 KeyId={keyID}, Signature={base64 signature}
+type HMACAuthenticator struct {
+	keyID  string
+	secret []byte
+	// TimestampHeader carries the unix timestamp, default to X-Timestamp
+	TimestampHeader string
+	// ContentHashHeader carries the body hash, default to X-Content-SHA256
+	ContentHashHeader string
+	now               func() time.Time
+}
+
+func NewHMACAuthenticator(keyID string, secret []byte) *HMACAuthenticator {
+	return &HMACAuthenticator{
+		keyID:             keyID,
+		secret:            secret,
+		TimestampHeader:   "X-Timestamp",
+		ContentHashHeader: "X-Content-SHA256",
+		now:               time.Now,
+	}
+}
+
+func (h *HMACAuthenticator) Authenticate(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(h.now().Unix(), 10)
+	bodyHash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(bodyHash[:])
+
+	req.Header.Set(h.TimestampHeader, timestamp)
+	req.Header.Set(h.ContentHashHeader, contentHash)
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 KeyId=%s, Signature=%s",
+		h.keyID, h.Sign(req.Method, req.URL.RequestURI(), timestamp, contentHash)))
+	return nil
+}
+
+// Sign returns the base64 signature, exposed so servers can verify the requests
+// principal is the key ID and the secret, the signature covers a fresh timestamp on each request
+func (h *HMACAuthenticator) principal() string {
+	secretHash := sha256.Sum256(h.secret)
+	return h.keyID + ":" + hex.EncodeToString(secretHash[:])
+}
+
+func (h *HMACAuthenticator) Sign(method, requestURI, timestamp, contentHash string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(strings.Join([]string{strings.ToUpper(method), requestURI, timestamp, contentHash}, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeBasicAuth adds a basic http authentication header to the provided header
+func encodeBasicAuth(userinfo string) string {
+	return base64.StdEncoding.EncodeToString([]byte(userinfo))
+}
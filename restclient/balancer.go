@@ -0,0 +1,386 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type BalancingStrategy string
+
+const (
+	RoundRobin    BalancingStrategy = "RoundRobin"
+	LeastInFlight BalancingStrategy = "LeastInFlight"
+	Weighted      BalancingStrategy = "Weighted"
+)
+
+// Endpoint is a target of the service
+type Endpoint struct {
+	URL string
+	// Weight is used by the Weighted strategy, defaults to 1
+	Weight int
+}
+
+// LoadBalancingConfig configures the endpoints selection and the ejection of the unhealthy ones
+type LoadBalancingConfig struct {
+	Strategy BalancingStrategy
+	// MaxFailures is the number of consecutive failures which eject an endpoint
+	MaxFailures int
+	// EjectionDuration is the first ejection duration, doubled at each following ejection
+	EjectionDuration time.Duration
+	// MaxEjectionDuration caps the ejection backoff
+	MaxEjectionDuration time.Duration
+	// HealthPath enables the active health checks of the ejected endpoints when set
+	HealthPath string
+	// HealthInterval is the delay between two health checks rounds
+	HealthInterval time.Duration
+}
+
+func NewLoadBalancingConfig(strategy BalancingStrategy) *LoadBalancingConfig {
+	return &LoadBalancingConfig{
+		Strategy:            strategy,
+		MaxFailures:         3,
+		EjectionDuration:    10 * time.Second,
+		MaxEjectionDuration: 5 * time.Minute,
+		HealthInterval:      5 * time.Second,
+	}
+}
+
+// endpoint holds the state of a target
+type endpoint struct {
+	url           *url.URL
+	weight        int
+	currentWeight int
+	inFlight      int
+	failures      int
+	ejections     int
+	ejectedUntil  time.Time
+}
+
+func (ep *endpoint) isEjected(now time.Time) bool {
+	return now.Before(ep.ejectedUntil)
+}
+
+// balancer is a RoundTripper spreading the requests over the endpoints,
+// a failed idempotent request is retried on another endpoint
+type balancer struct {
+	mu        sync.Mutex
+	next      http.RoundTripper
+	primary   *url.URL
+	endpoints []*endpoint
+	conf      LoadBalancingConfig
+	rrIndex   int
+	now       func() time.Time
+	cancel    context.CancelFunc
+}
+
+// newBalancer returns a balancer over the endpoints, the requests are built against the primary URL
+func newBalancer(next http.RoundTripper, primary *url.URL, endpoints []Endpoint, lbc *LoadBalancingConfig) (*balancer, error) {
+	conf := *NewLoadBalancingConfig(RoundRobin)
+	if lbc != nil {
+		conf = *lbc
+	}
+
+	b := &balancer{
+		next:    next,
+		primary: primary,
+		conf:    conf,
+		now:     time.Now,
+	}
+
+	for _, e := range endpoints {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return nil, err
+		}
+		// credentials are only read from the TargetURL, see newAuthHeader
+		u.User = nil
+		weight := e.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		b.endpoints = append(b.endpoints, &endpoint{url: u, weight: weight})
+	}
+	if len(b.endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoint to balance")
+	}
+
+	switch b.conf.Strategy {
+	case RoundRobin, LeastInFlight, Weighted:
+	case "":
+		b.conf.Strategy = RoundRobin
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %s", b.conf.Strategy)
+	}
+
+	if len(b.conf.HealthPath) > 0 && b.conf.HealthInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.cancel = cancel
+		go b.healthLoop(ctx)
+	}
+
+	return b, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (b *balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody != nil {
+		// each attempt reads its own copy from GetBody
+		defer req.Body.Close()
+	}
+
+	tried := make(map[*endpoint]bool)
+	for {
+		ep := b.pick(tried)
+		tried[ep] = true
+
+		attempt, err := b.rewrite(req, ep)
+		if err != nil {
+			return nil, err
+		}
+
+		b.acquire(ep)
+		resp, err := b.next.RoundTrip(attempt)
+		b.release(ep)
+
+		failed := err != nil || resp.StatusCode >= 500
+		b.report(ep, !failed)
+
+		retryable := err != nil || resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable ||
+			resp.StatusCode == http.StatusGatewayTimeout
+		if !retryable || !isIdempotent(req.Method) || len(tried) >= len(b.endpoints) ||
+			(req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		trace.SpanFromContext(req.Context()).AddEvent("failover",
+			trace.WithAttributes(attribute.String("restclient.endpoint", ep.url.Host)))
+	}
+}
+
+// rewrite clones the request toward the endpoint,
+// the path relative to the primary URL is joined to the endpoint's one
+func (b *balancer) rewrite(req *http.Request, ep *endpoint) (*http.Request, error) {
+	out := req.Clone(req.Context())
+
+	rel := strings.TrimPrefix(req.URL.Path, b.primary.Path)
+	u := *ep.url
+	u.Path = path.Join("/", ep.url.Path, rel)
+	u.RawPath = ""
+	u.RawQuery = req.URL.RawQuery
+	out.URL = &u
+	out.Host = ""
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+	return out, nil
+}
+
+// pick selects an endpoint not tried yet, healthy ones first,
+// when all are ejected the one whose ejection ends first is used
+func (b *balancer) pick(tried map[*endpoint]bool) *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	candidates := []*endpoint{}
+	for _, ep := range b.endpoints {
+		if !tried[ep] && !ep.isEjected(now) {
+			candidates = append(candidates, ep)
+		}
+	}
+
+	if len(candidates) == 0 {
+		var best *endpoint
+		for _, ep := range b.endpoints {
+			if tried[ep] {
+				continue
+			}
+			if best == nil || ep.ejectedUntil.Before(best.ejectedUntil) {
+				best = ep
+			}
+		}
+		if best == nil {
+			// every endpoint has been tried, RoundTrip stops before
+			best = b.endpoints[0]
+		}
+		return best
+	}
+
+	switch b.conf.Strategy {
+	case LeastInFlight:
+		start := b.rrIndex % len(candidates)
+		b.rrIndex++
+		best := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			ep := candidates[(start+i)%len(candidates)]
+			if ep.inFlight < best.inFlight {
+				best = ep
+			}
+		}
+		return best
+	case Weighted:
+		// smooth weighted round robin
+		total := 0
+		var best *endpoint
+		for _, ep := range candidates {
+			ep.currentWeight += ep.weight
+			total += ep.weight
+			if best == nil || ep.currentWeight > best.currentWeight {
+				best = ep
+			}
+		}
+		best.currentWeight -= total
+		return best
+	default:
+		ep := candidates[b.rrIndex%len(candidates)]
+		b.rrIndex++
+		return ep
+	}
+}
+
+func (b *balancer) acquire(ep *endpoint) {
+	b.mu.Lock()
+	ep.inFlight++
+	b.mu.Unlock()
+}
+
+func (b *balancer) release(ep *endpoint) {
+	b.mu.Lock()
+	ep.inFlight--
+	b.mu.Unlock()
+}
+
+// report updates the passive health of the endpoint
+func (b *balancer) report(ep *endpoint, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		ep.failures = 0
+		ep.ejections = 0
+		return
+	}
+
+	ep.failures++
+	if b.conf.MaxFailures > 0 && ep.failures >= b.conf.MaxFailures {
+		b.eject(ep)
+	}
+}
+
+// eject removes the endpoint from the selection, the duration doubles at each ejection
+func (b *balancer) eject(ep *endpoint) {
+	d := b.conf.EjectionDuration
+	for i := 0; i < ep.ejections; i++ {
+		d *= 2
+		if b.conf.MaxEjectionDuration > 0 && d >= b.conf.MaxEjectionDuration {
+			d = b.conf.MaxEjectionDuration
+			break
+		}
+	}
+	ep.ejections++
+	ep.failures = 0
+	ep.ejectedUntil = b.now().Add(d)
+}
+
+// healthLoop probes the ejected endpoints until the balancer is closed
+func (b *balancer) healthLoop(ctx context.Context) {
+	ticker := time.NewTicker(b.conf.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.checkHealth(ctx)
+		}
+	}
+}
+
+func (b *balancer) checkHealth(ctx context.Context) {
+	b.mu.Lock()
+	now := b.now()
+	ejected := []*endpoint{}
+	for _, ep := range b.endpoints {
+		if ep.isEjected(now) {
+			ejected = append(ejected, ep)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, ep := range ejected {
+		healthy := b.probe(ctx, ep)
+
+		b.mu.Lock()
+		if healthy {
+			ep.ejectedUntil = time.Time{}
+			ep.failures = 0
+			ep.ejections = 0
+		} else {
+			b.eject(ep)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// probe sends a GET on the health path, a 2xx means healthy
+func (b *balancer) probe(ctx context.Context, ep *endpoint) bool {
+	u := *ep.url
+	u.Path = path.Join("/", ep.url.Path, b.conf.HealthPath)
+
+	ctx, cancel := context.WithTimeout(ctx, b.conf.HealthInterval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := b.next.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// close stops the health checks
+func (b *balancer) close() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// CloseIdleConnections lets http.Client close the pooled connections of the transport
+func (b *balancer) CloseIdleConnections() {
+	closeIdleConnections(b.next)
+}
+
+// isIdempotent tells if a request can safely be sent again, RFC 9110 section 9.2.2
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func newCountingServer(status int, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"` + r.URL.Path + `","count":1}`))
+	}))
+}
+
+func Test_balancer_round_robin(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var c1, c2 int32
+	s1, s2 := newCountingServer(http.StatusOK, &c1), newCountingServer(http.StatusOK, &c2)
+	defer s1.Close()
+	defer s2.Close()
+
+	conf := NewConfig(s1.URL + "/api")
+	conf.Endpoints = []Endpoint{{URL: s2.URL + "/api"}}
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	defer rs.Close()
+
+	var out codecItem
+	for i := 0; i < 4; i++ {
+		if ierr := rs.HandleRequest(NewRequest("GET", "/items", nil), &out); ierr != nil {
+			t.Fatalf("handle_request failed: %v", ierr)
+		}
+	}
+
+	tests.MaybeFail("balancer_round_robin",
+		tests.Expect(atomic.LoadInt32(&c1), int32(2)),
+		tests.Expect(atomic.LoadInt32(&c2), int32(2)),
+		tests.Expect(out.Name, "/api/items"))
+}
+
+func Test_balancer_fails_over_idempotent_requests_only(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var cDown, cUp int32
+	down, up := newCountingServer(http.StatusServiceUnavailable, &cDown), newCountingServer(http.StatusOK, &cUp)
+	defer down.Close()
+	defer up.Close()
+
+	conf := NewConfig(down.URL)
+	conf.Endpoints = []Endpoint{{URL: up.URL}}
+	conf.LoadBalancing = NewLoadBalancingConfig(RoundRobin)
+	conf.LoadBalancing.MaxFailures = 0
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	defer rs.Close()
+
+	var out codecItem
+	errGet := rs.HandleRequest(NewRequest("GET", "/items", nil), &out)
+	errPut := rs.HandleRequest(NewRequest("PUT", "/items", codecItem{Name: "x"}), &out)
+	errPost := rs.HandleRequest(NewRequest("POST", "/items", codecItem{Name: "x"}), &out)
+
+	tests.MaybeFail("balancer_fails_over_idempotent_requests_only",
+		tests.Expect(errGet, nil),
+		tests.Expect(errPut, nil),
+		tests.Expect(errPost.GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(atomic.LoadInt32(&cDown), int32(3)),
+		tests.Expect(atomic.LoadInt32(&cUp), int32(2)))
+}
+
+func Test_balancer_passive_ejection_and_weighted(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	lbc := NewLoadBalancingConfig(Weighted)
+	lbc.MaxFailures = 2
+	lbc.EjectionDuration = time.Minute
+	primary, _ := url.Parse("http://a")
+	b, err := newBalancer(http.DefaultTransport, primary,
+		[]Endpoint{{URL: "http://a", Weight: 3}, {URL: "http://b", Weight: 1}}, lbc)
+	tests.MaybeFail("new_balancer", err)
+
+	picks := map[string]int{}
+	for i := 0; i < 8; i++ {
+		picks[b.pick(map[*endpoint]bool{}).url.Host]++
+	}
+
+	a := b.endpoints[0]
+	b.report(a, false)
+	b.report(a, false)
+	ejectedPick := b.pick(map[*endpoint]bool{}).url.Host
+
+	b.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	reinstatedPick := b.pick(map[*endpoint]bool{}).url.Host
+
+	tests.MaybeFail("balancer_passive_ejection_and_weighted",
+		tests.Expect(picks["a"], 6),
+		tests.Expect(picks["b"], 2),
+		tests.Expect(a.ejections, 1),
+		tests.Expect(ejectedPick, "b"),
+		tests.Expect(reinstatedPick, "a"))
+}
+
+func Test_balancer_active_health_check(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var count int32
+	srv := newCountingServer(http.StatusOK, &count)
+	defer srv.Close()
+
+	lbc := NewLoadBalancingConfig(LeastInFlight)
+	lbc.HealthPath = "/health"
+	lbc.HealthInterval = 10 * time.Millisecond
+	primary, _ := url.Parse(srv.URL)
+	b, err := newBalancer(http.DefaultTransport, primary, []Endpoint{{URL: srv.URL}}, lbc)
+	tests.MaybeFail("new_balancer", err)
+	defer b.close()
+
+	b.mu.Lock()
+	b.eject(b.endpoints[0])
+	b.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	ejected := true
+	for ejected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		b.mu.Lock()
+		ejected = b.endpoints[0].isEjected(time.Now())
+		b.mu.Unlock()
+	}
+
+	tests.MaybeFail("balancer_active_health_check",
+		tests.Expect(ejected, false),
+		tests.Expect(atomic.LoadInt32(&count) > 0, true))
+}
@@ -0,0 +1,173 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	e "gitlab.com/grpasr/common/errors/json"
+)
+
+const defaultBatchConcurrency = 8
+
+// ErrBatchSkipped is the cause of the error of the requests a batch did not send,
+// once a request failed in FailFast mode or the context is done
+var ErrBatchSkipped = errors.New("the request was not sent, the batch was canceled")
+
+// BatchMode selects how a batch handles the failed requests
+type BatchMode int
+
+const (
+	// CollectAll sends every request and collects the errors per item
+	CollectAll BatchMode = iota
+	// FailFast cancels the requests in flight and skips the pending ones once a request failed
+	FailFast
+)
+
+// BatchConfig configures a batch
+type BatchConfig struct {
+	// Concurrency is the number of requests in flight, default to 8
+	Concurrency int
+	Mode        BatchMode
+	// Retries and RetryDelay, in seconds, are applied to each request as HandleRetryRequest does
+	Retries    int8
+	RetryDelay int8
+	// Timeout bounds each request, retries included, 0 means no timeout
+	Timeout time.Duration
+	// OnProgress is called once a request completed, the calls are serialized,
+	// the skipped requests are not reported
+	OnProgress func(BatchProgress)
+}
+
+func NewBatchConfig() BatchConfig {
+	return BatchConfig{
+		Concurrency: defaultBatchConcurrency,
+		Mode:        CollectAll,
+	}
+}
+
+// BatchProgress is the state of a batch after the request Index completed
+type BatchProgress struct {
+	Index  int
+	Err    e.IError
+	Done   int
+	Failed int
+	Total  int
+}
+
+// BatchItem is the outcome of a request of a batch
+type BatchItem[T any] struct {
+	Request  *Api
+	Response T
+	Err      e.IError
+	// Skipped tells the request was not sent, Err wraps ErrBatchSkipped
+	Skipped bool
+}
+
+// Batch sends the requests with a bounded concurrency and returns their outcome in the
+// requests order, the error is the first failure, every failure is on its item.
+// The requests not sent once the batch is canceled are Skipped, they are not counted as failed.
+// Each request is sent with its own context derived from ctx, the context set on the requests is ignored
+//
+//	items, err := Batch[Config](ctx, rs, requests, NewBatchConfig())
+func Batch[T any](ctx context.Context, rs Requester, requests []*Api, conf BatchConfig) ([]BatchItem[T], e.IError) {
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = defaultBatchConcurrency
+	}
+	items := make([]BatchItem[T], len(requests))
+	if len(requests) == 0 {
+		return items, nil
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var first e.IError
+	sent := make([]bool, len(requests))
+	progress := BatchProgress{Total: len(requests)}
+	complete := func(i int, err e.IError) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[i] = true
+		items[i].Err = err
+		progress.Index, progress.Err = i, err
+		progress.Done++
+		if err != nil {
+			progress.Failed++
+			if first == nil {
+				first = err
+				if conf.Mode == FailFast {
+					cancel()
+				}
+			}
+		}
+		if conf.OnProgress != nil {
+			conf.OnProgress(progress)
+		}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < conf.Concurrency && w < len(requests); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if batchCtx.Err() != nil {
+					continue
+				}
+				complete(i, sendBatchItem(batchCtx, rs, requests[i], &items[i], conf))
+			}
+		}()
+	}
+	for i := range requests {
+		if batchCtx.Err() != nil {
+			break
+		}
+		select {
+		case indexes <- i:
+		case <-batchCtx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := range items {
+		if sent[i] {
+			continue
+		}
+		items[i] = BatchItem[T]{Request: requests[i], Err: e.WrapHTTPStatusContext(ctx, ErrBatchSkipped, e.StatusServiceUnavailable), Skipped: true}
+		if first == nil {
+			// the caller canceled the batch before any failure
+			first = e.WrapHTTPStatusContext(ctx, ctx.Err(), e.StatusServiceUnavailable)
+		}
+	}
+	return items, first
+}
+
+// sendBatchItem sends a copy of the request, the request may be shared by several batches
+func sendBatchItem[T any](ctx context.Context, rs Requester, request *Api, item *BatchItem[T], conf BatchConfig) e.IError {
+	item.Request = request
+	if err := ctx.Err(); err != nil {
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable)
+	}
+	if conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Timeout)
+		defer cancel()
+	}
+
+	req := *request
+	req.ctx = ctx
+	if rs, ok := rs.(*restService); ok {
+		// the retries of the item share a key, set on the copy only
+		req.idempotencyKey = rs.idempotencyKey(&req)
+	}
+	return retry(ctx, conf.Retries, conf.RetryDelay, func(attempt int) e.IError {
+		req.attempt = attempt
+		_, err := rs.HandleRequestWithResult(&req, &item.Response)
+		return err
+	})
+}
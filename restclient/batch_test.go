@@ -0,0 +1,163 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_batch_bounds_the_concurrency_and_collects_all(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/items/"))
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		switch {
+		case id%5 == 0:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":404,"message":"item not found"}`))
+		case id%3 == 0 && attempt == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintf(w, `{"name":"item","count":%d}`, id)
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var requests []*Api
+	for i := 1; i <= 20; i++ {
+		requests = append(requests, NewRequest("GET", "/items/%d", nil, i))
+	}
+	var progress []BatchProgress
+	conf := NewBatchConfig()
+	conf.Concurrency = 3
+	conf.Retries = 1
+	conf.OnProgress = func(p BatchProgress) {
+		progress = append(progress, p)
+	}
+
+	items, ierr := Batch[codecItem](context.Background(), rs, requests, conf)
+
+	var counts []int
+	failed := 0
+	for _, item := range items {
+		if item.Err != nil {
+			failed++
+			tests.MaybeFail("item_not_found", tests.Expect(item.Err.GetCode(), http.StatusNotFound))
+			continue
+		}
+		counts = append(counts, item.Response.Count)
+	}
+
+	tests.MaybeFail("batch_bounds_the_concurrency_and_collects_all",
+		tests.Expect(ierr.GetCode(), http.StatusNotFound),
+		tests.Expect(atomic.LoadInt32(&maxInFlight) <= 3, true),
+		tests.Expect(failed, 4),
+		tests.Expect(counts, []int{1, 2, 3, 4, 6, 7, 8, 9, 11, 12, 13, 14, 16, 17, 18, 19}),
+		tests.Expect(items[2].Request, requests[2]),
+		tests.Expect(len(progress), 20),
+		tests.Expect(progress[19].Done, 20),
+		tests.Expect(progress[19].Failed, 4),
+		tests.Expect(progress[19].Total, 20))
+}
+
+func Test_batch_fail_fast(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var sent int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		if r.URL.Path == "/items/1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var requests []*Api
+	for i := 1; i <= 10; i++ {
+		requests = append(requests, NewRequest("GET", "/items/%d", nil, i))
+	}
+	var reported []BatchProgress
+	conf := NewBatchConfig()
+	conf.Concurrency = 2
+	conf.Mode = FailFast
+	conf.OnProgress = func(p BatchProgress) {
+		reported = append(reported, p)
+	}
+
+	start := time.Now()
+	items, ierr := Batch[codecItem](context.Background(), rs, requests, conf)
+
+	skipped := 0
+	for _, item := range items {
+		if item.Skipped {
+			skipped++
+		}
+	}
+
+	tests.MaybeFail("batch_fail_fast",
+		tests.Expect(ierr.GetCode(), http.StatusInternalServerError),
+		tests.Expect(time.Since(start) < 500*time.Millisecond, true),
+		tests.Expect(atomic.LoadInt32(&sent) <= 3, true),
+		tests.Expect(items[9].Skipped, true),
+		tests.Expect(errors.Is(items[9].Err, ErrBatchSkipped), true),
+		tests.Expect(items[9].Request, requests[9]),
+		tests.Expect(skipped >= 7, true),
+		tests.Expect(len(reported), len(requests)-skipped),
+		tests.Expect(reported[len(reported)-1].Done, len(requests)-skipped),
+		tests.Expect(reported[len(reported)-1].Failed <= 3, true))
+}
+
+func Test_batch_canceled_by_the_caller(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rs, err := NewRestService(NewConfig("http://localhost"), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	items, ierr := Batch[codecItem](ctx, rs, []*Api{NewRequest("GET", "/items", nil)}, NewBatchConfig())
+
+	tests.MaybeFail("batch_canceled_by_the_caller",
+		tests.Expect(errors.Is(ierr, context.Canceled), true),
+		tests.Expect(items[0].Skipped, true))
+}
@@ -0,0 +1,423 @@
+package restclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a stored GET response
+type CachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+	// RequestHeader holds the request values of the headers listed by the response Vary
+	RequestHeader http.Header `json:"request_header,omitempty"`
+}
+
+// CacheStore persists the cached responses, implementations must be safe for concurrent use
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, cr *CachedResponse)
+	Delete(key string)
+}
+
+// CacheConfig enables the GET responses caching of the restService
+type CacheConfig struct {
+	// Store holds the responses, an in-memory LRU of 256 entries is used if nil
+	Store CacheStore
+	// StaleIfError is how long a stale response can be served when the server fails,
+	// the response stale-if-error directive takes precedence
+	StaleIfError time.Duration
+}
+
+func NewCacheConfig(store CacheStore) *CacheConfig {
+	return &CacheConfig{Store: store}
+}
+
+// responseCache applies the RFC 9111 rules of a private cache
+type responseCache struct {
+	store        CacheStore
+	staleIfError time.Duration
+	now          func() time.Time
+}
+
+func newResponseCache(cc *CacheConfig) *responseCache {
+	if cc == nil {
+		return nil
+	}
+	store := cc.Store
+	if store == nil {
+		store = NewMemoryCacheStore(256)
+	}
+	return &responseCache{
+		store:        store,
+		staleIfError: cc.StaleIfError,
+		now:          time.Now,
+	}
+}
+
+// key identifies a response by its URL, the negotiated media types and the credentials
+// the request carries, so the responses of different principals never share an entry.
+// The principal of the authenticator replaces the Authorization header when it provides one
+func (rc *responseCache) key(req *http.Request, auth Authenticator) string {
+	names := []string{"Authorization", "Cookie"}
+	h := sha256.New()
+	if ph, ok := auth.(principalHolder); ok {
+		names = names[1:]
+		h.Write([]byte("Principal: " + ph.principal() + "\n"))
+	}
+	if ch, ok := auth.(credentialsHolder); ok {
+		names = append(names, ch.credentialHeaders()...)
+	}
+	for _, name := range names {
+		for _, v := range req.Header.Values(name) {
+			h.Write([]byte(http.CanonicalHeaderKey(name) + ": " + v + "\n"))
+		}
+	}
+	return req.URL.String() + "|" + req.Header.Get("Accept") + "|" + hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns the stored entry and whether it is still fresh,
+// the request gets the validators of a stale entry.
+// An entry stored for other values of the Vary headers is ignored
+func (rc *responseCache) lookup(key string, req *http.Request) (*CachedResponse, bool) {
+	entry, ok := rc.store.Get(key)
+	if !ok || !matchesVary(entry, req.Header) {
+		return nil, false
+	}
+	if rc.isFresh(entry) {
+		return entry, true
+	}
+	if etag := entry.Header.Get("ETag"); len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lm := entry.Header.Get("Last-Modified"); len(lm) > 0 {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+	return entry, false
+}
+
+// update stores or refreshes the entry according to the response,
+// it returns what must be decoded: the stored entry on a 304 or when stale content is served
+func (rc *responseCache) update(key string, entry *CachedResponse, reqHeader http.Header, statusCode int, header http.Header, body []byte) (int, http.Header, []byte) {
+	switch {
+	case statusCode == http.StatusNotModified && entry != nil:
+		refreshed := &CachedResponse{
+			StatusCode:    entry.StatusCode,
+			Header:        entry.Header.Clone(),
+			Body:          entry.Body,
+			StoredAt:      rc.now(),
+			RequestHeader: entry.RequestHeader,
+		}
+		// RFC 9111 section 4.3.4, the 304 headers update the stored ones
+		for _, h := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date", "Age"} {
+			if v := header.Get(h); len(v) > 0 {
+				refreshed.Header.Set(h, v)
+			}
+		}
+		if cacheDirectives(refreshed.Header)["no-store"] != "" {
+			rc.store.Delete(key)
+		} else {
+			rc.store.Set(key, refreshed)
+		}
+		return refreshed.StatusCode, refreshed.Header, refreshed.Body
+	case statusCode >= 500 && entry != nil && rc.canServeStale(entry):
+		return entry.StatusCode, entry.Header, entry.Body
+	case statusCode == http.StatusOK:
+		if isStorable(header) {
+			rc.store.Set(key, &CachedResponse{
+				StatusCode:    statusCode,
+				Header:        header.Clone(),
+				Body:          body,
+				StoredAt:      rc.now(),
+				RequestHeader: varyHeader(header, reqHeader),
+			})
+		} else {
+			rc.store.Delete(key)
+		}
+	}
+	return statusCode, header, body
+}
+
+// isFresh compares the entry age with its freshness lifetime
+func (rc *responseCache) isFresh(entry *CachedResponse) bool {
+	cd := cacheDirectives(entry.Header)
+	if _, ok := cd["no-cache"]; ok {
+		return false
+	}
+	lifetime, ok := freshnessLifetime(entry.Header)
+	if !ok {
+		return false
+	}
+	return rc.age(entry) < lifetime
+}
+
+// canServeStale tells if the entry can be used when the server fails
+func (rc *responseCache) canServeStale(entry *CachedResponse) bool {
+	cd := cacheDirectives(entry.Header)
+	if _, ok := cd["must-revalidate"]; ok {
+		return false
+	}
+
+	allowed := rc.staleIfError
+	if v, ok := cd["stale-if-error"]; ok {
+		if sec, err := strconv.Atoi(v); err == nil {
+			allowed = time.Duration(sec) * time.Second
+		}
+	}
+	if allowed <= 0 {
+		return false
+	}
+
+	lifetime, _ := freshnessLifetime(entry.Header)
+	return rc.age(entry) < lifetime+allowed
+}
+
+// age is the entry current age, RFC 9111 section 4.2.3
+func (rc *responseCache) age(entry *CachedResponse) time.Duration {
+	age := rc.now().Sub(entry.StoredAt)
+	if v := entry.Header.Get("Age"); len(v) > 0 {
+		if sec, err := strconv.Atoi(v); err == nil {
+			age += time.Duration(sec) * time.Second
+		}
+	}
+	return age
+}
+
+// freshnessLifetime reads max-age, then Expires
+func freshnessLifetime(header http.Header) (time.Duration, bool) {
+	cd := cacheDirectives(header)
+	if v, ok := cd["max-age"]; ok {
+		if sec, err := strconv.Atoi(v); err == nil {
+			return time.Duration(sec) * time.Second, true
+		}
+	}
+	if v := header.Get("Expires"); len(v) > 0 {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// an invalid Expires means already expired
+			return 0, true
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			return 0, true
+		}
+		return expires.Sub(date), true
+	}
+	return 0, false
+}
+
+// isStorable tells if a 200 response can be stored
+func isStorable(header http.Header) bool {
+	cd := cacheDirectives(header)
+	if _, ok := cd["no-store"]; ok {
+		return false
+	}
+	if _, ok := varyNames(header); !ok {
+		// Vary: * never matches a later request
+		return false
+	}
+	if _, ok := freshnessLifetime(header); ok {
+		return true
+	}
+	// no explicit freshness, only worth storing for revalidation
+	return len(header.Get("ETag")) > 0 || len(header.Get("Last-Modified")) > 0
+}
+
+// varyNames lists the headers of the response Vary, false for Vary: *
+func varyNames(header http.Header) ([]string, bool) {
+	var names []string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if len(name) > 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, true
+}
+
+// varyHeader selects the request values of the headers listed by the response Vary
+func varyHeader(header, reqHeader http.Header) http.Header {
+	names, _ := varyNames(header)
+	if len(names) == 0 {
+		return nil
+	}
+	selected := http.Header{}
+	for _, name := range names {
+		selected[name] = reqHeader.Values(name)
+	}
+	return selected
+}
+
+// matchesVary tells if the request has the values of the Vary headers the entry was stored for
+func matchesVary(entry *CachedResponse, reqHeader http.Header) bool {
+	names, ok := varyNames(entry.Header)
+	if !ok {
+		return false
+	}
+	for _, name := range names {
+		if strings.Join(entry.RequestHeader.Values(name), ",") != strings.Join(reqHeader.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheDirectives parses the Cache-Control header, directives without value map to "true"
+func cacheDirectives(header http.Header) map[string]string {
+	cd := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(line, ",") {
+			d = strings.TrimSpace(d)
+			if len(d) == 0 {
+				continue
+			}
+			k, v, found := strings.Cut(d, "=")
+			k = strings.ToLower(strings.TrimSpace(k))
+			if !found {
+				cd[k] = "true"
+				continue
+			}
+			cd[k] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return cd
+}
+
+/******
+* STORES
+******/
+
+// MemoryCacheStore is an in-memory LRU store
+type MemoryCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = 256
+	}
+	return &MemoryCacheStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.ll.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).entry, true
+}
+
+func (m *MemoryCacheStore) Set(key string, cr *CachedResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryCacheItem).entry = cr
+		m.ll.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.ll.PushFront(&memoryCacheItem{key, cr})
+	for m.ll.Len() > m.capacity {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (m *MemoryCacheStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.ll.Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// DiskCacheStore stores each response as a JSON file in a directory
+type DiskCacheStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStore{dir: dir}, nil
+}
+
+func (d *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *DiskCacheStore) Get(key string) (*CachedResponse, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	b, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var cr CachedResponse
+	if err := json.Unmarshal(b, &cr); err != nil {
+		return nil, false
+	}
+	return &cr, true
+}
+
+func (d *DiskCacheStore) Set(key string, cr *CachedResponse) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, err := json.Marshal(cr)
+	if err != nil {
+		return
+	}
+	// write then rename, so a reader never sees a partial file
+	tmp := d.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, d.path(key))
+}
+
+func (d *DiskCacheStore) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_ = os.Remove(d.path(key))
+}
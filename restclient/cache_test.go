@@ -0,0 +1,254 @@
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func newCachedRestService(t *testing.T, url string, cc *CacheConfig) *restService {
+	conf := NewConfig(url)
+	conf.Cache = cc
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	if err != nil {
+		t.Fatalf("new_rest_service failed: %v", err)
+	}
+	return rs
+}
+
+func Test_cache_serves_fresh_response(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	rs := newCachedRestService(t, srv.URL, NewCacheConfig(nil))
+
+	var first, second codecItem
+	err1 := rs.HandleRequest(NewRequest("GET", "/items", nil), &first)
+	err2 := rs.HandleRequest(NewRequest("GET", "/items", nil), &second)
+
+	tests.MaybeFail("cache_serves_fresh_response",
+		tests.Expect(err1, nil),
+		tests.Expect(err2, nil),
+		tests.Expect(calls, 1),
+		tests.Expect(second, first))
+}
+
+func Test_cache_revalidates_with_etag(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	var ifNoneMatch string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ifNoneMatch = r.Header.Get("If-None-Match")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if ifNoneMatch == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"item","count":2}`))
+	}))
+	defer srv.Close()
+
+	rs := newCachedRestService(t, srv.URL, NewCacheConfig(NewMemoryCacheStore(10)))
+
+	var first, second codecItem
+	err1 := rs.HandleRequest(NewRequest("GET", "/items", nil), &first)
+	err2 := rs.HandleRequest(NewRequest("GET", "/items", nil), &second)
+
+	tests.MaybeFail("cache_revalidates_with_etag",
+		tests.Expect(err1, nil),
+		tests.Expect(err2, nil),
+		tests.Expect(calls, 2),
+		tests.Expect(ifNoneMatch, `"v1"`),
+		tests.Expect(second, codecItem{Name: "item", Count: 2}))
+}
+
+func Test_cache_no_store_and_stale_if_error(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		}
+		w.Write([]byte(`{"name":"item","count":3}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCacheStore(10)
+	rs := newCachedRestService(t, srv.URL, NewCacheConfig(store))
+
+	var out, private codecItem
+	_ = rs.HandleRequest(NewRequest("GET", "/items", nil), &out)
+	_ = rs.HandleRequest(NewRequest("GET", "/private", nil), &private)
+
+	fail = true
+	var stale codecItem
+	errStale := rs.HandleRequest(NewRequest("GET", "/items", nil), &stale)
+	errPrivate := rs.HandleRequest(NewRequest("GET", "/private", nil), &private)
+
+	tests.MaybeFail("cache_no_store_and_stale_if_error",
+		tests.Expect(store.ll.Len(), 1),
+		tests.Expect(errStale, nil),
+		tests.Expect(stale.Count, 3),
+		tests.Expect(errPrivate.GetCode(), http.StatusInternalServerError))
+}
+
+func Test_memory_cache_store_evicts_least_recently_used(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	store := NewMemoryCacheStore(2)
+	store.Set("a", &CachedResponse{StatusCode: 200})
+	store.Set("b", &CachedResponse{StatusCode: 200})
+	store.Get("a")
+	store.Set("c", &CachedResponse{StatusCode: 200})
+
+	_, okA := store.Get("a")
+	_, okB := store.Get("b")
+	_, okC := store.Get("c")
+
+	tests.MaybeFail("memory_cache_store_evicts_least_recently_used",
+		tests.Expect(okA, true),
+		tests.Expect(okB, false),
+		tests.Expect(okC, true))
+}
+
+func Test_disk_cache_store(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	store, err := NewDiskCacheStore(t.TempDir())
+	tests.MaybeFail("new_disk_cache_store", err)
+
+	in := &CachedResponse{
+		StatusCode: 200,
+		Header:     http.Header{"Etag": []string{`"v1"`}},
+		Body:       []byte(`{"name":"item"}`),
+		StoredAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	store.Set("key", in)
+	out, ok := store.Get("key")
+	store.Delete("key")
+	_, okDeleted := store.Get("key")
+
+	tests.MaybeFail("disk_cache_store",
+		tests.Expect(ok, true),
+		tests.Expect(out, in),
+		tests.Expect(okDeleted, false))
+}
+
+func Test_cache_separates_principals(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(`{"name":"` + r.Header.Get("Authorization") + `","count":1}`))
+	}))
+	defer srv.Close()
+
+	// the services share the store
+	store := NewMemoryCacheStore(16)
+	alice := newCachedRestService(t, srv.URL, NewCacheConfig(store))
+	alice.auth = NewBearerAuthenticator("alice")
+	bob := newCachedRestService(t, srv.URL, NewCacheConfig(store))
+	bob.auth = NewBearerAuthenticator("bob")
+
+	var a1, a2, b, override codecItem
+	err1 := alice.HandleRequest(NewRequest("GET", "/me", nil), &a1)
+	err2 := bob.HandleRequest(NewRequest("GET", "/me", nil), &b)
+	err3 := alice.HandleRequest(NewRequest("GET", "/me", nil), &a2)
+	callsBeforeOverride := calls
+	err4 := alice.HandleRequest(NewRequest("GET", "/me", nil).WithAuthenticator(NewBearerAuthenticator("carol")), &override)
+	err5 := alice.HandleRequest(NewRequest("GET", "/me", nil).WithAuthenticator(NewBearerAuthenticator("carol")), &override)
+
+	tests.MaybeFail("cache_separates_principals", err1, err2, err3, err4, err5,
+		tests.Expect(a1.Name, "Bearer alice"),
+		tests.Expect(b.Name, "Bearer bob"),
+		tests.Expect(a2.Name, "Bearer alice"),
+		tests.Expect(callsBeforeOverride, 2),
+		tests.Expect(override.Name, "Bearer carol"),
+		tests.Expect(calls, 4))
+}
+
+func Test_cache_keys_hmac_requests_by_key_id(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(`{"name":"` + r.Header.Get("X-Timestamp") + `","count":1}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCacheStore(16)
+	signer := NewHMACAuthenticator("key-1", []byte("secret-1"))
+	now := time.Unix(1700000000, 0)
+	signer.now = func() time.Time { now = now.Add(time.Second); return now }
+	alice := newCachedRestService(t, srv.URL, NewCacheConfig(store))
+	alice.auth = signer
+	bob := newCachedRestService(t, srv.URL, NewCacheConfig(store))
+	bob.auth = NewHMACAuthenticator("key-2", []byte("secret-2"))
+
+	var a1, a2, b codecItem
+	err1 := alice.HandleRequest(NewRequest("GET", "/me", nil), &a1)
+	err2 := alice.HandleRequest(NewRequest("GET", "/me", nil), &a2)
+	err3 := bob.HandleRequest(NewRequest("GET", "/me", nil), &b)
+
+	tests.MaybeFail("cache_keys_hmac_requests_by_key_id", err1, err2, err3,
+		tests.Expect(a1.Name, "1700000001"),
+		tests.Expect(a2, a1),
+		tests.Expect(b.Name != a1.Name, true),
+		tests.Expect(calls, 2))
+}
+
+func Test_cache_honors_vary(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "X-Tenant")
+		w.Write([]byte(`{"name":"` + r.Header.Get("X-Tenant") + `","count":1}`))
+	}))
+	defer srv.Close()
+
+	rs := newCachedRestService(t, srv.URL, NewCacheConfig(nil))
+
+	var a, b1, b2 codecItem
+	err1 := rs.HandleRequest(NewRequest("GET", "/items", nil).WithHeader("X-Tenant", "a"), &a)
+	err2 := rs.HandleRequest(NewRequest("GET", "/items", nil).WithHeader("X-Tenant", "b"), &b1)
+	err3 := rs.HandleRequest(NewRequest("GET", "/items", nil).WithHeader("X-Tenant", "b"), &b2)
+
+	tests.MaybeFail("cache_honors_vary", err1, err2, err3,
+		tests.Expect(a.Name, "a"),
+		tests.Expect(b1.Name, "b"),
+		tests.Expect(b2.Name, "b"),
+		tests.Expect(calls, 2))
+}
@@ -0,0 +1,40 @@
+// openapigen generates a typed restclient from an OpenAPI 3 document,
+// it is run by go generate:
+//
+//	//go:generate go run gitlab.com/grpasr/common/restclient/cmd/openapigen -spec api.yaml -out client.gen.go
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/grpasr/common/restclient/openapi"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "path of the OpenAPI 3 document, YAML or JSON")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file, default to the go generate's package")
+	out := flag.String("out", "client.gen.go", "path of the generated file")
+	flag.Parse()
+
+	if len(*specPath) == 0 {
+		log.Fatal("openapigen: -spec is required")
+	}
+
+	spec, err := openapi.LoadSpec(*specPath)
+	if err != nil {
+		log.Fatalf("openapigen: %v", err)
+	}
+	src, err := openapi.Generate(spec, openapi.Config{
+		Package: *pkg,
+		Source:  filepath.Base(*specPath),
+	})
+	if err != nil {
+		log.Fatalf("openapigen: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("openapigen: %v", err)
+	}
+}
@@ -0,0 +1,425 @@
+package restclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MediaTypeJSON      string = "application/json"
+	MediaTypeProtobuf         = "application/x-protobuf"
+	MediaTypeProtoJSON        = "application/x-protobuf+json"
+	MediaTypeXML              = "application/xml"
+	MediaTypeForm             = "application/x-www-form-urlencoded"
+	MediaTypeMsgpack          = "application/x-msgpack"
+)
+
+// Codec encodes the requests' body and decodes the responses' body for a media type
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecRegistry holds the codecs keyed by media type
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+	// order keeps the registration order, used to build the Accept header
+	order []string
+}
+
+// NewCodecRegistry returns a registry holding the given codecs
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	cr := &CodecRegistry{
+		codecs: make(map[string]Codec),
+	}
+	for _, c := range codecs {
+		cr.Register(c)
+	}
+	return cr
+}
+
+// NewDefaultCodecRegistry returns a registry holding all the built-in codecs
+func NewDefaultCodecRegistry() *CodecRegistry {
+	cr := NewCodecRegistry(
+		JSONCodec{},
+		ProtobufCodec{},
+		ProtoJSONCodec{},
+		XMLCodec{},
+		FormCodec{},
+		MsgpackCodec{},
+	)
+	cr.Register(ProtobufCodec{}, "application/protobuf", "application/vnd.google.protobuf")
+	cr.Register(XMLCodec{}, "text/xml")
+	cr.Register(MsgpackCodec{}, "application/msgpack", "application/vnd.msgpack")
+	return cr
+}
+
+// Register adds the codec under its own media type and the optional aliases,
+// an already registered media type is overwritten
+func (cr *CodecRegistry) Register(c Codec, aliases ...string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	for _, mt := range append([]string{c.ContentType()}, aliases...) {
+		mt = normalizeMediaType(mt)
+		if _, ok := cr.codecs[mt]; !ok {
+			cr.order = append(cr.order, mt)
+		}
+		cr.codecs[mt] = c
+	}
+}
+
+// Get returns the codec matching the contentType, parameters such as charset are ignored
+func (cr *CodecRegistry) Get(contentType string) (Codec, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	c, ok := cr.codecs[normalizeMediaType(contentType)]
+	if !ok {
+		// structured syntax suffix, e.g. application/vnd.api+json
+		mt := normalizeMediaType(contentType)
+		if i := strings.LastIndex(mt, "+"); i >= 0 {
+			c, ok = cr.codecs["application/"+mt[i+1:]]
+		}
+	}
+	return c, ok
+}
+
+// MediaTypes returns the registered media types in registration order
+func (cr *CodecRegistry) MediaTypes() []string {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	mts := make([]string, len(cr.order))
+	copy(mts, cr.order)
+	return mts
+}
+
+// Accept builds an Accept header value, preferred is given the highest quality,
+// the other registered media types follow with a lower quality
+func (cr *CodecRegistry) Accept(preferred ...string) string {
+	seen := make(map[string]bool)
+	values := []string{}
+	for _, p := range preferred {
+		mt := normalizeMediaType(p)
+		if mt == "" || seen[mt] {
+			continue
+		}
+		seen[mt] = true
+		values = append(values, mt)
+	}
+	for _, mt := range cr.MediaTypes() {
+		if seen[mt] {
+			continue
+		}
+		seen[mt] = true
+		values = append(values, mt+";q=0.8")
+	}
+	return strings.Join(values, ", ")
+}
+
+// Negotiate returns the registered codec that best matches an Accept header value
+func (cr *CodecRegistry) Negotiate(accept string) (Codec, bool) {
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mt, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		if r.mediaType == "*/*" {
+			if mts := cr.MediaTypes(); len(mts) > 0 {
+				return cr.Get(mts[0])
+			}
+			continue
+		}
+		if strings.HasSuffix(r.mediaType, "/*") {
+			prefix := strings.TrimSuffix(r.mediaType, "*")
+			for _, mt := range cr.MediaTypes() {
+				if strings.HasPrefix(mt, prefix) {
+					return cr.Get(mt)
+				}
+			}
+			continue
+		}
+		if c, ok := cr.Get(r.mediaType); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeMediaType strips the parameters and lower the media type
+func normalizeMediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mt)
+}
+
+// JSONCodec handle application/json
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return MediaTypeJSON }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec handle the protobuf binary wire format
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string { return MediaTypeProtobuf }
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// ProtoJSONCodec handle the protobuf canonical JSON mapping
+type ProtoJSONCodec struct{}
+
+func (ProtoJSONCodec) ContentType() string { return MediaTypeProtoJSON }
+
+func (ProtoJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protojson codec: %T is not a proto.Message", v)
+	}
+	return protojson.Marshal(m)
+}
+
+func (ProtoJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protojson codec: %T is not a proto.Message", v)
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// XMLCodec handle application/xml
+type XMLCodec struct{}
+
+func (XMLCodec) ContentType() string { return MediaTypeXML }
+
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// MsgpackCodec handle application/x-msgpack
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ContentType() string { return MediaTypeMsgpack }
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// FormCodec handle application/x-www-form-urlencoded,
+// it accepts url.Values, map[string]string, map[string][]string
+// and structs whose fields are tagged with `form:"name"`
+type FormCodec struct{}
+
+func (FormCodec) ContentType() string { return MediaTypeForm }
+
+func (FormCodec) Marshal(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case url.Values:
+		return []byte(t.Encode()), nil
+	case *url.Values:
+		return []byte(t.Encode()), nil
+	case map[string]string:
+		values := url.Values{}
+		for k, val := range t {
+			values.Set(k, val)
+		}
+		return []byte(values.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(t).Encode()), nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form codec: unsupported type %T", v)
+	}
+
+	values := url.Values{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, ok := formFieldName(rt.Field(i))
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			for j := 0; j < fv.Len(); j++ {
+				values.Add(name, fmt.Sprint(fv.Index(j).Interface()))
+			}
+			continue
+		}
+		values.Set(name, fmt.Sprint(fv.Interface()))
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (FormCodec) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case *url.Values:
+		*t = values
+		return nil
+	case *map[string][]string:
+		*t = values
+		return nil
+	case *map[string]string:
+		if *t == nil {
+			*t = make(map[string]string)
+		}
+		for k := range values {
+			(*t)[k] = values.Get(k)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("form codec: unsupported type %T", v)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, ok := formFieldName(rt.Field(i))
+		if !ok {
+			continue
+		}
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+			for j, s := range vals {
+				if err := setFormValue(slice.Index(j), s); err != nil {
+					return fmt.Errorf("form codec: field %s: %w", name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setFormValue(fv, vals[0]); err != nil {
+			return fmt.Errorf("form codec: field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// formFieldName returns the form key of an exported struct field
+func formFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("form")
+	if tag == "-" {
+		return "", false
+	}
+	if tag == "" {
+		return f.Name, true
+	}
+	return strings.Split(tag, ",")[0], true
+}
+
+// setFormValue parses s into the field according to its kind
+func setFormValue(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package restclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecItem struct {
+	Name  string `json:"name" xml:"name" form:"name" msgpack:"name"`
+	Count int    `json:"count" xml:"count" form:"count" msgpack:"count"`
+}
+
+func Test_codec_registry_get_ignores_parameters_and_suffix(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	cr := NewDefaultCodecRegistry()
+
+	c1, ok1 := cr.Get("application/json; charset=utf-8")
+	c2, ok2 := cr.Get("application/vnd.api+json")
+	c3, ok3 := cr.Get("application/protobuf")
+	_, ok4 := cr.Get("text/plain")
+
+	tests.MaybeFail("codec_registry_get",
+		tests.Expect(ok1, true),
+		tests.Expect(c1.ContentType(), MediaTypeJSON),
+		tests.Expect(ok2, true),
+		tests.Expect(c2.ContentType(), MediaTypeJSON),
+		tests.Expect(ok3, true),
+		tests.Expect(c3.ContentType(), MediaTypeProtobuf),
+		tests.Expect(ok4, false))
+}
+
+func Test_codec_registry_negotiate(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	cr := NewDefaultCodecRegistry()
+
+	c1, ok1 := cr.Negotiate("text/plain, application/xml;q=0.5, application/x-msgpack;q=0.9")
+	c2, ok2 := cr.Negotiate("*/*")
+	_, ok3 := cr.Negotiate("text/plain")
+
+	tests.MaybeFail("codec_registry_negotiate",
+		tests.Expect(ok1, true),
+		tests.Expect(c1.ContentType(), MediaTypeMsgpack),
+		tests.Expect(ok2, true),
+		tests.Expect(c2.ContentType(), MediaTypeJSON),
+		tests.Expect(ok3, false))
+}
+
+func Test_codecs_round_trip(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	in := codecItem{Name: "item", Count: 3}
+	for _, c := range []Codec{JSONCodec{}, XMLCodec{}, FormCodec{}, MsgpackCodec{}} {
+		b, err := c.Marshal(in)
+		var out codecItem
+		errU := c.Unmarshal(b, &out)
+		tests.MaybeFail("codec_round_trip_"+c.ContentType(), err, errU, tests.Expect(out, in))
+	}
+
+	for _, c := range []Codec{ProtobufCodec{}, ProtoJSONCodec{}} {
+		b, err := c.Marshal(wrapperspb.String("item"))
+		out := &wrapperspb.StringValue{}
+		errU := c.Unmarshal(b, out)
+		tests.MaybeFail("codec_round_trip_"+c.ContentType(), err, errU, tests.Expect(out.GetValue(), "item"))
+	}
+
+	_, err := ProtobufCodec{}.Marshal(in)
+	tests.MaybeFail("protobuf_codec_rejects_non_proto", tests.Expect(err != nil, true))
+}
+
+func Test_form_codec_maps(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	b, err := FormCodec{}.Marshal(map[string]string{"a": "1", "b": "two words"})
+	var values url.Values
+	errU := FormCodec{}.Unmarshal(b, &values)
+
+	tests.MaybeFail("form_codec_maps", err, errU,
+		tests.Expect(string(b), "a=1&b=two+words"),
+		tests.Expect(values.Get("b"), "two words"))
+}
+
+func Test_handle_request_protobuf(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var gotContentType, gotAccept string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		gotAccept = r.Header.Get("Accept")
+		gotBody, _ = io.ReadAll(r.Body)
+
+		b, _ := proto.Marshal(wrapperspb.String("pong"))
+		w.Header().Set("Content-Type", MediaTypeProtobuf)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	out := &wrapperspb.StringValue{}
+	req := NewRequest("POST", "/ping", wrapperspb.String("ping")).WithContentType(MediaTypeProtobuf)
+	ierr := rs.HandleRequest(req, out)
+
+	in := &wrapperspb.StringValue{}
+	errU := proto.Unmarshal(gotBody, in)
+
+	if ierr != nil {
+		t.Fatalf("handle_request_protobuf failed: %v", ierr)
+	}
+	tests.MaybeFail("handle_request_protobuf", errU,
+		tests.Expect(gotContentType, MediaTypeProtobuf),
+		tests.Expect(gotAccept[:len(MediaTypeProtobuf)], MediaTypeProtobuf),
+		tests.Expect(in.GetValue(), "ping"),
+		tests.Expect(out.GetValue(), "pong"))
+}
+
+func Test_handle_request_error_status(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_code":40401,"message":"subject not found"}`))
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var out map[string]interface{}
+	ierr := rs.HandleRequest(NewRequest("GET", "/subjects/%s", nil, "x"), &out)
+
+	tests.MaybeFail("handle_request_error_status",
+		tests.Expect(ierr != nil, true),
+		tests.Expect(ierr.GetCode(), http.StatusNotFound),
+		tests.Expect(ierr.Error(), "404 : Resource not found, Comment: subject not found"))
+}
+
+func Test_handle_request_problem_status(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"https://errors.example.com/1002","title":"Access denied","status":403,"detail":"no scope","code":1002,"service":"items","scope":"items:write"}`))
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var out map[string]interface{}
+	ierr := rs.HandleRequest(NewRequest("GET", "/items", nil), &out)
+
+	tests.MaybeFail("handle_request_problem_status",
+		tests.Expect(ierr.GetCode(), 1002),
+		tests.Expect(ierr.Error(), "1002 : Access to the requested resource is denied, Service: items, Comment: no scope"),
+		tests.Expect(ierr.GetPayload()["scope"], "items:write"))
+}
@@ -1,7 +1,9 @@
 package restclient
 
 import (
-// "fmt"
+	// "fmt"
+
+	"gitlab.com/grpasr/common/faultinjection"
 )
 
 type AuthType string
@@ -17,30 +19,98 @@ type AuthData struct {
 }
 
 type Config struct {
-	// SchemaRegistryURL determines the URL of the service to reach
+	// TargetURL determines the URL of the service to reach
 	TargetURL string
+	// Endpoints lists the other URLs of the same service, balanced along with TargetURL
+	Endpoints []Endpoint
+	// LoadBalancing configures the selection between the endpoints
+	LoadBalancing *LoadBalancingConfig
+	// Hedging sends a second copy of the slow idempotent requests when not nil
+	Hedging *HedgingConfig
 
 	// BasicAuthUserInfo specifies the user info in the form of {username}:{password}.
 	BasicAuthUserInfo string
-	// BasicAuthCredentialsSource specifies how to determine the credentials, one of URL, USER_INFO
+	// BasicAuthCredentialsSource specifies how to determine the credentials, one of URL, USER_INFO, BEARER, BASIC, NONE
 	BasicAuthCredentialsSource string
 
 	// AuthCreadentialsDatas holds the creadentials datas
 	AuthCredentialsDatas AuthData
 
+	// Authenticator authenticates each request, it takes precedence over BasicAuthCredentialsSource.
+	Authenticator Authenticator
+
+	// DisableIdempotencyKeys stops generating an Idempotency-Key for the POST and PATCH requests,
+	// the keys set with Api.WithIdempotencyKey are still sent.
+	DisableIdempotencyKeys bool
+
+	// Interceptors wrap every request, the first one is the outermost.
+	Interceptors []Interceptor
+
 	// SslCertificateLocation specifies the location of SSL certificates.
 	SslCertificateLocation string
 	// SslKeyLocation specifies the location of SSL keys.
 	SslKeyLocation string
 	// SslCaLocation specifies the location of SSL certificate authorities.
 	SslCaLocation string
-	// SslDisableEndpointVerification determines whether to disable endpoint verification.
+	// SslDisableEndpointVerification determines whether to disable endpoint verification,
+	// it is refused when GOENV or the process GOENV is production.
 	SslDisableEndpointVerification bool
+	// SslReloadIntervalMs determines how often the certificate, key and CA files are checked for changes, 0 disables it.
+	SslReloadIntervalMs int
+	// SslMinVersion specifies the minimum TLS version, one of 1.0, 1.1, 1.2, 1.3, default to 1.2.
+	SslMinVersion string
+	// SslCipherSuites lists the allowed cipher suites by IANA name, for TLS 1.0 to 1.2 only.
+	SslCipherSuites []string
+	// SslServerName overrides the server name sent with SNI and verified against the certificate.
+	SslServerName string
+
+	// GOENV determines the environment, the production restrictions also apply when the process GOENV is production.
+	GOENV string
 
 	// ConnectionTimeoutMs determines the connection timeout in milliseconds.
-	ConnectionTimeoutMs int
+	ConnectionTimeoutMs int `mapstructure:"connection_timeout_ms"`
 	// RequestTimeoutMs determines the request timeout in milliseconds.
-	RequestTimeoutMs int
+	RequestTimeoutMs int `mapstructure:"request_timeout_ms"`
+
+	// ProxyURL specifies the proxy of the requests, with a http, https or socks5 scheme.
+	ProxyURL string `mapstructure:"proxy_url"`
+	// NoProxy lists the hosts reached without the proxy, in the NO_PROXY format.
+	NoProxy string `mapstructure:"no_proxy"`
+	// ProxyFromEnvironment uses the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables when ProxyURL is empty.
+	ProxyFromEnvironment bool `mapstructure:"proxy_from_environment"`
+
+	// MaxIdleConns limits the idle connections across all hosts, 0 means no limit.
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// MaxIdleConnsPerHost limits the idle connections kept per host.
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// MaxConnsPerHost limits the connections per host, in any state, 0 means no limit.
+	MaxConnsPerHost int `mapstructure:"max_conns_per_host"`
+	// IdleConnTimeoutMs determines how long an idle connection is kept, 0 means forever.
+	IdleConnTimeoutMs int `mapstructure:"idle_conn_timeout_ms"`
+	// KeepAliveMs determines the TCP keep-alive period, and the HTTP/2 ping period with H2C.
+	KeepAliveMs int `mapstructure:"keep_alive_ms"`
+	// TLSHandshakeTimeoutMs determines the TLS handshake timeout, 0 means no timeout.
+	TLSHandshakeTimeoutMs int `mapstructure:"tls_handshake_timeout_ms"`
+	// ResponseHeaderTimeoutMs determines how long to wait for the response headers once the request is written, 0 means no timeout.
+	ResponseHeaderTimeoutMs int `mapstructure:"response_header_timeout_ms"`
+
+	// ForceHTTP2 attempts HTTP/2 over TLS, it is disabled by default by the custom TLS and dial settings.
+	ForceHTTP2 bool `mapstructure:"force_http2"`
+	// H2C speaks HTTP/2 over cleartext TCP with prior knowledge, the proxy settings do not apply.
+	H2C bool `mapstructure:"h2c"`
+	// UnixSocket specifies the path of a Unix domain socket every connection goes to,
+	// TargetURL still gives the scheme, the Host header and the base path.
+	UnixSocket string `mapstructure:"unix_socket"`
+
+	// Logging enables the requests' logging when not nil.
+	Logging *LoggingConfig
+
+	// Cache enables the GET responses caching when not nil.
+	Cache *CacheConfig
+
+	// FaultInjection injects the configured faults into the requests when not nil,
+	// it is disabled when GOENV is production.
+	FaultInjection *faultinjection.Config `mapstructure:"faultinjection"`
 }
 
 func NewConfig(url string, authDatas ...AuthData) *Config {
@@ -58,9 +128,16 @@ func NewConfig(url string, authDatas ...AuthData) *Config {
 	c.SslKeyLocation = ""
 	c.SslCaLocation = ""
 	c.SslDisableEndpointVerification = false
+	c.SslReloadIntervalMs = 30000
 
 	c.ConnectionTimeoutMs = 10000
 	c.RequestTimeoutMs = 10000
 
+	c.MaxIdleConns = 100
+	c.MaxIdleConnsPerHost = 10
+	c.IdleConnTimeoutMs = 90000
+	c.KeepAliveMs = 30000
+	c.TLSHandshakeTimeoutMs = 10000
+
 	return c
 }
@@ -0,0 +1,293 @@
+package restclient
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/grpasr/common/observability/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	hedgeOutcomeKey = attribute.Key("restclient.hedge.outcome")
+
+	// the delay percentile is computed again after this number of samples
+	hedgeRecomputeEvery = 50
+)
+
+// HedgingConfig configures the hedged requests, a second copy of a request
+// is sent when the first one has not answered within the delay
+type HedgingConfig struct {
+	// Delay before the hedge, used until MinSamples latencies are observed when Percentile is set
+	Delay time.Duration
+	// Percentile of the observed latencies used as the delay, 0 to always use Delay
+	Percentile float64
+	// MinSamples is the number of latencies observed before using Percentile
+	MinSamples int
+	// Window is the number of latest latencies the percentile is computed on
+	Window int
+	// Budget caps the ratio of hedged requests, 0.05 hedges at most 5% of the requests
+	Budget float64
+	// Methods are the hedged methods, they need to be idempotent
+	Methods []string
+}
+
+func NewHedgingConfig() *HedgingConfig {
+	return &HedgingConfig{
+		Delay:      50 * time.Millisecond,
+		Percentile: 95,
+		MinSamples: 20,
+		Window:     1000,
+		Budget:     0.05,
+		Methods:    []string{http.MethodGet, http.MethodHead},
+	}
+}
+
+// hedger is the http.RoundTripper sending the hedges, the first successful response wins
+type hedger struct {
+	next    http.RoundTripper
+	conf    HedgingConfig
+	methods map[string]bool
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	cursor    int
+	samples   int
+	delay     time.Duration
+	tokens    float64
+
+	mf     *metrics.MetricsFacade
+	hedges instrument.Int64Counter
+	delays instrument.Float64Histogram
+}
+
+func newHedger(next http.RoundTripper, conf *HedgingConfig) *hedger {
+	c := *conf
+	if c.Window <= 0 {
+		c.Window = 1000
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 1
+	}
+	if len(c.Methods) == 0 {
+		c.Methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	h := &hedger{
+		next:      next,
+		conf:      c,
+		methods:   make(map[string]bool),
+		latencies: make([]time.Duration, c.Window),
+		delay:     c.Delay,
+		mf:        metrics.NewMetricsFacade(),
+	}
+	for _, m := range c.Methods {
+		if isIdempotent(m) {
+			h.methods[m] = true
+		}
+	}
+
+	mh := h.mf.NewMeterHandler()
+	h.hedges, _ = mh.MTHInt64Counter("http.client.hedges",
+		h.mf.ISOWithDescription("number of hedged requests by outcome"))
+	h.delays, _ = mh.MTHFloat64Histogram("http.client.hedge.delay",
+		h.mf.ISOWithDescription("delay waited before sending the hedges"),
+		h.mf.ISOWithUnit(unit.Milliseconds))
+	return h
+}
+
+// CloseIdleConnections lets http.Client close the pooled connections of the transport
+func (h *hedger) CloseIdleConnections() {
+	closeIdleConnections(h.next)
+}
+
+// attempt is the outcome of a copy of the request
+type attempt struct {
+	resp    *http.Response
+	err     error
+	hedge   bool
+	elapsed time.Duration
+	cancel  context.CancelFunc
+}
+
+func (a *attempt) succeeded() bool {
+	return a.err == nil && a.resp.StatusCode < 500
+}
+
+// discard releases a losing attempt
+func (a *attempt) discard() {
+	if a.resp != nil {
+		io.Copy(io.Discard, a.resp.Body)
+		a.resp.Body.Close()
+	}
+	a.cancel()
+}
+
+// RoundTrip implements http.RoundTripper
+func (h *hedger) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !h.methods[req.Method] || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return h.next.RoundTrip(req)
+	}
+
+	delay, allowed := h.admit()
+	results := make(chan *attempt, 2)
+	send := func(r *http.Request, hedge bool) {
+		ctx, cancel := context.WithCancel(r.Context())
+		start := time.Now()
+		resp, err := h.next.RoundTrip(r.WithContext(ctx))
+		results <- &attempt{resp, err, hedge, time.Since(start), cancel}
+	}
+	go send(req, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	pending := 1
+	var failed *attempt
+	for {
+		select {
+		case <-timer.C:
+			if !allowed || !h.take() {
+				h.record(req.Context(), "budget_exhausted")
+				continue
+			}
+			hedge, err := cloneRequest(req)
+			if err != nil {
+				continue
+			}
+			h.record(req.Context(), "sent")
+			if h.delays != nil {
+				h.mf.ISORecordFloat64(req.Context(), h.delays, float64(delay)/float64(time.Millisecond))
+			}
+			trace.SpanFromContext(req.Context()).AddEvent("hedge")
+			pending++
+			go send(hedge, true)
+
+		case a := <-results:
+			pending--
+			if !a.succeeded() && pending > 0 {
+				failed = a
+				continue
+			}
+			if failed != nil {
+				failed.discard()
+			}
+			if a.succeeded() {
+				h.observe(a.elapsed)
+				if a.hedge {
+					h.record(req.Context(), "won")
+				}
+			}
+			// the losing attempt is canceled and released in background
+			if pending > 0 {
+				go func() {
+					(<-results).discard()
+				}()
+			}
+			return a.win(), a.err
+		}
+	}
+}
+
+// win returns the response of the winning attempt, its context is canceled once the body is closed
+func (a *attempt) win() *http.Response {
+	if a.resp == nil {
+		a.cancel()
+		return nil
+	}
+	a.resp.Body = &cancelOnClose{ReadCloser: a.resp.Body, cancel: a.cancel}
+	return a.resp
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// admit credits the budget with a request and returns the current delay,
+// the budget is not credited by the requests which could not be hedged
+func (h *hedger) admit() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = math.Min(h.tokens+h.conf.Budget, math.Max(1, h.conf.Budget*100))
+	return h.delay, h.conf.Budget > 0
+}
+
+// take consumes a hedge from the budget
+func (h *hedger) take() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// observe adds a latency to the window, and updates the delay
+func (h *hedger) observe(latency time.Duration) {
+	if h.conf.Percentile <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latencies[h.cursor] = latency
+	h.cursor = (h.cursor + 1) % len(h.latencies)
+	h.samples++
+	if h.samples >= h.conf.MinSamples && (h.samples == h.conf.MinSamples || h.samples%hedgeRecomputeEvery == 0) {
+		h.delay = h.percentile()
+	}
+}
+
+// percentile returns the configured percentile of the window, the lock is held
+func (h *hedger) percentile() time.Duration {
+	n := h.samples
+	if n > len(h.latencies) {
+		n = len(h.latencies)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, h.latencies[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(h.conf.Percentile/100*float64(n))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= n {
+		rank = n - 1
+	}
+	return sorted[rank]
+}
+
+func (h *hedger) record(ctx context.Context, outcome string) {
+	if h.hedges != nil {
+		h.mf.ISOAdd(ctx, h.hedges, 1, hedgeOutcomeKey.String(outcome))
+	}
+}
+
+// cloneRequest returns a copy of the request with a fresh body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
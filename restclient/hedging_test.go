@@ -0,0 +1,86 @@
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+// newSlowFirstServer answers slowly to the odd requests
+func newSlowFirstServer(count *int32, slow time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(count, 1)
+		if n%2 == 1 {
+			select {
+			case <-time.After(slow):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"fast","count":1}`))
+	}))
+}
+
+func Test_hedged_request_first_success_wins(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var count int32
+	srv := newSlowFirstServer(&count, 2*time.Second)
+	defer srv.Close()
+
+	conf := NewConfig(srv.URL)
+	conf.Hedging = &HedgingConfig{Delay: 20 * time.Millisecond, Budget: 1}
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var out codecItem
+	start := time.Now()
+	ierr := rs.HandleRequest(NewRequest("GET", "/items", nil), &out)
+	elapsed := time.Since(start)
+
+	// POST is not hedged
+	atomic.StoreInt32(&count, 1)
+	postErr := rs.HandleRequest(NewRequest("POST", "/items", codecItem{}), nil)
+
+	tests.MaybeFail("hedged_request_first_success_wins",
+		tests.Expect(ierr, nil),
+		tests.Expect(out.Name, "fast"),
+		tests.Expect(elapsed < time.Second, true),
+		tests.Expect(postErr, nil),
+		tests.Expect(atomic.LoadInt32(&count), int32(2)))
+}
+
+func Test_hedger_budget_and_percentile(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	h := newHedger(http.DefaultTransport, &HedgingConfig{Delay: time.Second, Percentile: 90, MinSamples: 10, Budget: 0.5})
+
+	_, allowed := h.admit()
+	first := h.take()
+	h.admit()
+	second := h.take()
+	third := h.take()
+
+	delayBefore := h.delay
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	none := newHedger(http.DefaultTransport, &HedgingConfig{Methods: []string{http.MethodPost}})
+	_, allowedNone := none.admit()
+
+	tests.MaybeFail("hedger_budget_and_percentile",
+		tests.Expect(allowed, true),
+		tests.Expect(first, false),
+		tests.Expect(second, true),
+		tests.Expect(third, false),
+		tests.Expect(delayBefore, time.Second),
+		tests.Expect(h.delay, 9*time.Millisecond),
+		tests.Expect(allowedNone, false),
+		tests.Expect(len(none.methods), 0))
+}
@@ -0,0 +1,45 @@
+package restclient
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader identifies a logical POST or PATCH call across its retries
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey sets the Idempotency-Key of the request,
+// a key is generated for the POST and PATCH requests otherwise
+func (a *Api) WithIdempotencyKey(key string) *Api {
+	a.idempotencyKey = key
+	return a
+}
+
+// IdempotencyKey returns the Idempotency-Key set with WithIdempotencyKey, the generated ones
+// are on the Exchange
+func (a *Api) IdempotencyKey() string {
+	return a.idempotencyKey
+}
+
+// idempotencyKey returns the key of a call of request: its own key, or a new one for the
+// POST and PATCH requests when the restService sends them, empty otherwise.
+// The retries of a call share the key, the Api is left unchanged so it can be sent again
+func (rs *restService) idempotencyKey(request *Api) string {
+	if len(request.idempotencyKey) > 0 {
+		return request.idempotencyKey
+	}
+	if rs.idempotencyKeys && (request.method == http.MethodPost || request.method == http.MethodPatch) {
+		return newIdempotencyKey()
+	}
+	return ""
+}
+
+// newIdempotencyKey returns a random UUID v4
+func newIdempotencyKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,46 @@
+package restclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_idempotency_key_stable_across_retries(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Method+" "+r.Header.Get(IdempotencyKeyHeader))
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	req := NewRequest("POST", "/orders", codecItem{Name: "x"})
+	errRetry := rs.HandleRetryRequest(context.Background(), req, nil, 3, 0, THandleRequest)
+	generated := strings.TrimPrefix(keys[0], "POST ")
+	// the Api sent again is a new operation
+	errAgain := rs.HandleRequest(req, nil)
+	again := strings.TrimPrefix(keys[3], "POST ")
+
+	errCustom := rs.HandleRequest(NewRequest("PATCH", "/orders/1", codecItem{}).WithIdempotencyKey("order-1"), nil)
+	errGet := rs.HandleRequest(NewRequest("GET", "/orders/1", nil), nil)
+
+	tests.MaybeFail("idempotency_key_stable_across_retries", errRetry, errAgain, errCustom, errGet,
+		tests.Expect(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(generated), true),
+		tests.Expect(again != generated, true),
+		tests.Expect(req.IdempotencyKey(), ""),
+		tests.Expect(keys, []string{"POST " + generated, "POST " + generated, "POST " + generated, "POST " + again, "PATCH order-1", "GET "}))
+}
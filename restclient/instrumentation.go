@@ -0,0 +1,169 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/grpasr/common/observability/metrics"
+	"gitlab.com/grpasr/common/observability/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "gitlab.com/grpasr/common/restclient"
+
+	attemptKey     = attribute.Key("restclient.attempt")
+	statusClassKey = attribute.Key("http.status_class")
+)
+
+// clientInstrumentation holds the tracer and the metrics instruments of the restService
+type clientInstrumentation struct {
+	tracer       trace.Tracer
+	mf           *metrics.MetricsFacade
+	duration     instrument.Float64Histogram
+	requestSize  instrument.Int64Histogram
+	responseSize instrument.Int64Histogram
+	requests     instrument.Int64Counter
+	phases       instrument.Float64Histogram
+}
+
+// newClientInstrumentation creates the instruments, they are bound to the
+// global providers, so SetupTracing and SetupMetrics can be called afterward
+func newClientInstrumentation() *clientInstrumentation {
+	tf := tracing.NewTracingfacade()
+	mf := metrics.NewMetricsFacade()
+	mh := mf.NewMeterHandler()
+
+	ci := &clientInstrumentation{
+		tracer: tf.TRCGetTracer(instrumentationName),
+		mf:     mf,
+	}
+
+	// the instruments errors are ignored, a nil instrument is not recorded
+	ci.duration, _ = mh.MTHFloat64Histogram("http.client.duration",
+		mf.ISOWithDescription("duration of the outbound HTTP requests"),
+		mf.ISOWithUnit(unit.Milliseconds))
+	ci.requestSize, _ = mh.MTHInt64Histogram("http.client.request.size",
+		mf.ISOWithDescription("size of the outbound HTTP requests' body"),
+		mf.ISOWithUnit(unit.Bytes))
+	ci.responseSize, _ = mh.MTHInt64Histogram("http.client.response.size",
+		mf.ISOWithDescription("size of the inbound HTTP responses' body"),
+		mf.ISOWithUnit(unit.Bytes))
+	ci.requests, _ = mh.MTHInt64Counter("http.client.requests",
+		mf.ISOWithDescription("number of outbound HTTP requests by status class"))
+	ci.phases, _ = mh.MTHFloat64Histogram("http.client.phase.duration",
+		mf.ISOWithDescription("duration of the outbound HTTP requests' phases: dns, connect, tls, first_byte"),
+		mf.ISOWithUnit(unit.Milliseconds))
+
+	return ci
+}
+
+// clientCall tracks a single round trip, from the span start to the metrics recording
+type clientCall struct {
+	ci    *clientInstrumentation
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue
+
+	requestSize  int64
+	responseSize int64
+	statusCode   int
+
+	phases  *phaseTimer
+	timings *Timings
+}
+
+// start opens the client span, injects the trace context into the request
+// headers and returns the request bound to the span's context
+func (ci *clientInstrumentation) start(request *Api, req *http.Request) (*clientCall, *http.Request) {
+	ctx := request.context()
+
+	attrs := semconv.HTTPClientAttributesFromHTTPRequest(req)
+	ctx, span := ci.tracer.Start(ctx, fmt.Sprintf("HTTP %s", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	if request.attempt > 0 {
+		span.AddEvent("retry", trace.WithAttributes(attemptKey.Int(request.attempt)))
+	}
+
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	phases := newPhaseTimer()
+	return &clientCall{
+		ci:     ci,
+		ctx:    ctx,
+		span:   span,
+		start:  time.Now(),
+		phases: phases,
+		attrs: []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+		},
+	}, req.WithContext(phases.withClientTrace(ctx))
+}
+
+// end records the metrics, set the span status and close it,
+// err is the transport error, if any
+func (c *clientCall) end(err error) {
+	defer c.span.End()
+
+	statusClass := "error"
+	if c.statusCode > 0 {
+		statusClass = fmt.Sprintf("%dxx", c.statusCode/100)
+		c.span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(c.statusCode)...)
+		c.span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(c.statusCode, trace.SpanKindClient))
+		c.attrs = append(c.attrs, semconv.HTTPStatusCodeKey.Int(c.statusCode))
+	}
+	if err != nil {
+		c.span.RecordError(err)
+		c.span.SetStatus(codes.Error, err.Error())
+	}
+	c.span.SetAttributes(
+		semconv.HTTPRequestContentLengthKey.Int64(c.requestSize),
+		semconv.HTTPResponseContentLengthKey.Int64(c.responseSize))
+
+	c.timings = c.phases.timings()
+	c.phases.addSpanEvents(c.span, c.timings)
+
+	attrs := append(c.attrs, statusClassKey.String(statusClass))
+	elapsed := float64(time.Since(c.start)) / float64(time.Millisecond)
+	if c.ci.duration != nil {
+		c.ci.mf.ISORecordFloat64(c.ctx, c.ci.duration, elapsed, attrs...)
+	}
+	if c.ci.requestSize != nil {
+		c.ci.mf.ISORecordInt64(c.ctx, c.ci.requestSize, c.requestSize, attrs...)
+	}
+	if c.ci.responseSize != nil {
+		c.ci.mf.ISORecordInt64(c.ctx, c.ci.responseSize, c.responseSize, attrs...)
+	}
+	if c.ci.requests != nil {
+		c.ci.mf.ISOAdd(c.ctx, c.ci.requests, 1, attrs...)
+	}
+	if c.ci.phases != nil {
+		for phase, d := range map[string]time.Duration{
+			"dns":        c.timings.DNS,
+			"connect":    c.timings.Connect,
+			"tls":        c.timings.TLSHandshake,
+			"first_byte": c.timings.TimeToFirstByte,
+		} {
+			if d > 0 {
+				c.ci.mf.ISORecordFloat64(c.ctx, c.ci.phases, durationMs(d),
+					append(c.attrs, phaseKey.String(phase), connReusedKey.Bool(c.timings.ConnReused))...)
+			}
+		}
+	}
+}
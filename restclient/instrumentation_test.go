@@ -0,0 +1,185 @@
+package restclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/tests"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_handle_request_creates_client_span_and_propagates(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	calls := 0
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		traceparent = r.Header.Get("traceparent")
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var out codecItem
+	ierr := rs.HandleRetryRequest(context.Background(), NewRequest("GET", "/items/%d", nil, 1), &out, 1, 0, THandleRequest)
+	if ierr != nil {
+		t.Fatalf("handle_retry_request failed: %v", ierr)
+	}
+
+	spans := sr.Ended()
+	tests.MaybeFail("client_spans",
+		tests.Expect(len(spans), 2),
+		tests.Expect(spans[0].Name(), "HTTP GET"),
+		tests.Expect(spans[0].SpanKind(), trace.SpanKindClient),
+		tests.Expect(eventNames(spans[0]), []string{"http.connect", "http.first_byte"}),
+		tests.Expect(spans[1].Events()[0].Name, "retry"),
+		tests.Expect(spans[1].Events()[0].Attributes[0], attemptKey.Int(1)),
+		tests.Expect(traceparent[3:35], spans[1].SpanContext().TraceID().String()),
+		tests.Expect(out.Name, "item"))
+
+	var status int64
+	for _, kv := range spans[1].Attributes() {
+		if kv.Key == "http.status_code" {
+			status = kv.Value.AsInt64()
+		}
+	}
+	tests.MaybeFail("client_span_status_code", tests.Expect(status, int64(200)))
+}
+
+func Test_handle_request_errors_carry_the_trace(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	failed := rs.HandleRequest(NewRequest("GET", "/items", nil), nil)
+
+	// refused before the client span, the error gets the trace of the request context
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+	crossOrigin := NewRequest("GET", "", nil).WithContext(ctx)
+	crossOrigin.rawURL, _ = url.Parse("https://other.example/items")
+	refused := rs.HandleRequest(crossOrigin, nil)
+
+	spans := sr.Ended()
+	tests.MaybeFail("handle_request_errors_carry_the_trace",
+		tests.Expect(failed.GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(len(spans), 1),
+		tests.Expect(e.TraceID(failed), spans[0].SpanContext().TraceID().String()),
+		tests.Expect(refused.GetCode(), http.StatusBadGateway),
+		tests.Expect(e.TraceID(refused), parent.SpanContext().TraceID().String()))
+}
+
+func Test_handle_retry_request_leaves_the_api_unchanged(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	// the Api is a descriptor shared by the concurrent calls
+	shared := NewRequest("GET", "/items/%d", nil, 1)
+	done := make(chan e.IError)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- rs.HandleRetryRequest(context.Background(), shared, nil, 2, 0, THandleRequest)
+		}()
+	}
+	var failed int
+	for i := 0; i < 4; i++ {
+		if <-done != nil {
+			failed++
+		}
+	}
+
+	tests.MaybeFail("handle_retry_request_leaves_the_api_unchanged",
+		tests.Expect(failed, 4),
+		tests.Expect(shared.Attempt(), 0),
+		tests.Expect(shared.ctx == nil, true))
+}
+
+func Test_handle_request_with_result_reports_timings(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var out codecItem
+	first, ierr := rs.HandleRequestWithResult(NewRequest("GET", "/items/1", nil), &out)
+	tests.MaybeFail("first_request", ierr)
+	second, ierr := rs.HandleRequestWithResult(NewRequest("GET", "/items/1", nil), &out)
+	tests.MaybeFail("second_request", ierr)
+
+	spans := sr.Ended()
+	var reused []bool
+	for _, span := range spans {
+		for _, kv := range span.Attributes() {
+			if kv.Key == connReusedKey {
+				reused = append(reused, kv.Value.AsBool())
+			}
+		}
+	}
+
+	tests.MaybeFail("handle_request_with_result_reports_timings",
+		tests.Expect(first.Timings.ConnReused, false),
+		tests.Expect(first.Timings.Connect > 0, true),
+		tests.Expect(first.Timings.TimeToFirstByte >= 5*time.Millisecond, true),
+		tests.Expect(first.Timings.Total >= first.Timings.TimeToFirstByte, true),
+		tests.Expect(second.Timings.ConnReused, true),
+		tests.Expect(second.Timings.Connect, time.Duration(0)),
+		tests.Expect(second.Timings.TimeToFirstByte >= 5*time.Millisecond, true),
+		tests.Expect(eventNames(spans[0]), []string{"http.connect", "http.first_byte"}),
+		tests.Expect(eventNames(spans[1]), []string{"http.first_byte"}),
+		tests.Expect(reused, []bool{false, true}))
+}
+
+func eventNames(span sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, ev := range span.Events() {
+		names = append(names, ev.Name)
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+package restclient
+
+import (
+	"net/http"
+
+	e "gitlab.com/grpasr/common/errors/json"
+)
+
+// Exchange is a request going through the interceptors chain
+type Exchange struct {
+	// Api is the request descriptor
+	Api *Api
+	// Request is the authenticated HTTP request, an interceptor may replace it
+	Request *http.Request
+	// Result holds the response status and headers once the next handler returned
+	Result *Result
+	// IdempotencyKey is the Idempotency-Key of the call, shared by its retries
+	IdempotencyKey string
+
+	response    interface{}
+	reqBody     []byte
+	accept      string
+	contentType string
+	pathToWrite string
+	stream      *http.Response
+}
+
+// ExchangeHandler performs the exchange, returning the decoded error
+type ExchangeHandler func(ex *Exchange) e.IError
+
+// Interceptor wraps the exchange, it calls next to proceed with the round trip
+// or returns without calling it to short-circuit the request
+type Interceptor func(ex *Exchange, next ExchangeHandler) e.IError
+
+// Use appends global interceptors, it is not safe to call concurrently with the requests
+func (rs *restService) Use(interceptors ...Interceptor) {
+	rs.interceptors = append(rs.interceptors, interceptors...)
+}
+
+// intercept runs the global then the request's interceptors, in the order
+// they were added, around send
+func (rs *restService) intercept(ex *Exchange, send ExchangeHandler) e.IError {
+	chain := make([]Interceptor, 0, len(rs.interceptors)+len(ex.Api.interceptors))
+	chain = append(chain, rs.interceptors...)
+	chain = append(chain, ex.Api.interceptors...)
+
+	handler := send
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], handler
+		handler = func(ex *Exchange) e.IError {
+			return interceptor(ex, next)
+		}
+	}
+	return handler(ex)
+}
+
+// HeaderInterceptor sets static headers on the requests
+func HeaderInterceptor(header http.Header) Interceptor {
+	return func(ex *Exchange, next ExchangeHandler) e.IError {
+		for k, v := range header {
+			ex.Request.Header[http.CanonicalHeaderKey(k)] = v
+		}
+		return next(ex)
+	}
+}
@@ -0,0 +1,79 @@
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_interceptors_chain_order(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var tenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = r.Header.Get("X-Tenant")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	var calls []string
+	var status int
+	var decoded e.IError
+	record := func(name string) Interceptor {
+		return func(ex *Exchange, next ExchangeHandler) e.IError {
+			calls = append(calls, name+">")
+			err := next(ex)
+			calls = append(calls, "<"+name)
+			return err
+		}
+	}
+
+	conf := NewConfig(srv.URL)
+	conf.Interceptors = []Interceptor{record("config")}
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	rs.Use(record("global"), HeaderInterceptor(http.Header{"x-tenant": {"acme"}}))
+
+	req := NewRequest("GET", "/items/%d", nil, 1).WithInterceptors(func(ex *Exchange, next ExchangeHandler) e.IError {
+		decoded = next(ex)
+		status = ex.Result.StatusCode
+		return decoded
+	}, record("request"))
+	ierr := rs.HandleRequest(req, nil)
+
+	tests.MaybeFail("interceptors_chain_order",
+		tests.Expect(calls, []string{"config>", "global>", "request>", "<request", "<global", "<config"}),
+		tests.Expect(tenant, "acme"),
+		tests.Expect(status, http.StatusNotFound),
+		tests.Expect(decoded.GetCode(), http.StatusNotFound),
+		tests.Expect(ierr, decoded))
+}
+
+func Test_interceptor_short_circuit(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	sent := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	var method, endpoint string
+	rs.Use(func(ex *Exchange, next ExchangeHandler) e.IError {
+		method, endpoint = ex.Api.Method(), ex.Api.Endpoint()
+		return e.NewCustomHTTPStatus(e.StatusForbidden, "", "blocked")
+	})
+	ierr := rs.HandleRequest(NewRequest("DELETE", "/items", nil), nil)
+
+	tests.MaybeFail("interceptor_short_circuit",
+		tests.Expect(sent, false),
+		tests.Expect(method, "DELETE"),
+		tests.Expect(endpoint, "/items"),
+		tests.Expect(ierr.GetCode(), http.StatusForbidden))
+}
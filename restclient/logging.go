@@ -0,0 +1,296 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/grpasr/common/observability/logging"
+)
+
+const (
+	redactedValue    = "[REDACTED]"
+	defaultBodyLimit = 1024
+)
+
+// LoggingConfig configures the request/response logging of the restService
+type LoggingConfig struct {
+	// BodyLimit is the maximum number of bytes of the bodies logged at debug level
+	BodyLimit int
+	// RedactHeaders lists the headers to redact, Authorization is always redacted
+	RedactHeaders []string
+	// RedactQueryParams lists the query parameters to redact
+	RedactQueryParams []string
+	// RedactJSONFields lists the JSON fields to redact, at any depth of the bodies
+	RedactJSONFields []string
+	// Curl logs, at debug level, an equivalent curl command of each request
+	Curl bool
+}
+
+func NewLoggingConfig() *LoggingConfig {
+	return &LoggingConfig{
+		BodyLimit: defaultBodyLimit,
+	}
+}
+
+// requestLogger writes the exchanges through observability/logging
+type requestLogger struct {
+	lf          *logging.LoggingFacade
+	bodyLimit   int
+	headers     map[string]bool
+	queryParams map[string]bool
+	jsonFields  map[string]bool
+	curl        bool
+}
+
+// withCredentials returns a copy of rl which also redacts where auth places its secrets,
+// rl itself when auth places them in the Authorization header only
+func (rl *requestLogger) withCredentials(auth Authenticator) *requestLogger {
+	ch, ok := auth.(credentialsHolder)
+	if !ok {
+		return rl
+	}
+	cp := *rl
+	cp.headers = make(map[string]bool, len(rl.headers))
+	for h := range rl.headers {
+		cp.headers[h] = true
+	}
+	for _, h := range ch.credentialHeaders() {
+		cp.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	cp.queryParams = make(map[string]bool, len(rl.queryParams))
+	for q := range rl.queryParams {
+		cp.queryParams[q] = true
+	}
+	for _, q := range ch.credentialQueryParams() {
+		cp.queryParams[q] = true
+	}
+	return &cp
+}
+
+func newRequestLogger(lc *LoggingConfig) *requestLogger {
+	if lc == nil {
+		return nil
+	}
+
+	rl := &requestLogger{
+		lf:          logging.NewLoggingFacade(),
+		bodyLimit:   lc.BodyLimit,
+		headers:     map[string]bool{"Authorization": true},
+		queryParams: make(map[string]bool),
+		jsonFields:  make(map[string]bool),
+		curl:        lc.Curl,
+	}
+	if rl.bodyLimit <= 0 {
+		rl.bodyLimit = defaultBodyLimit
+	}
+	for _, h := range lc.RedactHeaders {
+		rl.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, q := range lc.RedactQueryParams {
+		rl.queryParams[q] = true
+	}
+	for _, f := range lc.RedactJSONFields {
+		rl.jsonFields[strings.ToLower(f)] = true
+	}
+	return rl
+}
+
+// exchange holds what is logged of a round trip
+type exchange struct {
+	req         *http.Request
+	auth        Authenticator
+	reqBody     []byte
+	statusCode  int
+	respHeader  http.Header
+	respBody    []byte
+	respSize    int64
+	elapsed     time.Duration
+	timings     *Timings
+	err         error
+	skipRespLog bool
+}
+
+// log writes the summary line and, at debug level, the redacted headers, bodies and curl command,
+// the secrets of the authenticator of the exchange are redacted too
+func (rl *requestLogger) log(ctx context.Context, ex *exchange) {
+	if rl == nil {
+		return
+	}
+	rl = rl.withCredentials(ex.auth)
+
+	level := rl.lf.LLHInfo()
+	if ex.err != nil || ex.statusCode >= 500 {
+		level = rl.lf.LLHError()
+	} else if ex.statusCode >= 400 {
+		level = rl.lf.LLHWarn()
+	}
+
+	lh := rl.lf.NewLogHandler(level, ctx).
+		Str("method", ex.req.Method).
+		Str("url", rl.redactURL(ex.req.URL)).
+		Int("status", ex.statusCode).
+		Float64("latency_ms", float64(ex.elapsed)/float64(time.Millisecond)).
+		Int("request_size", len(ex.reqBody)).
+		Int("response_size", int(ex.respSize))
+	if ex.err != nil {
+		lh = lh.Err(ex.err)
+	}
+	lh.Msg("restclient request")
+
+	// the debug level is never written in production, skip the redaction work
+	if rl.lf.GetLoggingEnv() == "production" {
+		return
+	}
+
+	dh := rl.lf.NewLogHandler(rl.lf.LLHDebug(), ctx).
+		Str("method", ex.req.Method).
+		Str("url", rl.redactURL(ex.req.URL)).
+		Str("request_headers", rl.formatHeaders(ex.req.Header)).
+		Str("request_body", rl.formatBody(ex.reqBody, ex.req.Header.Get("Content-Type")))
+	if t := ex.timings; t != nil {
+		dh = dh.Float64("dns_ms", durationMs(t.DNS)).
+			Float64("connect_ms", durationMs(t.Connect)).
+			Float64("tls_ms", durationMs(t.TLSHandshake)).
+			Float64("ttfb_ms", durationMs(t.TimeToFirstByte)).
+			Str("conn_reused", strconv.FormatBool(t.ConnReused))
+	}
+	if ex.respHeader != nil {
+		dh = dh.Str("response_headers", rl.formatHeaders(ex.respHeader))
+		if !ex.skipRespLog {
+			dh = dh.Str("response_body", rl.formatBody(ex.respBody, ex.respHeader.Get("Content-Type")))
+		}
+	}
+	dh.Msg("restclient exchange")
+
+	if rl.curl {
+		rl.lf.NewLogHandler(rl.lf.LLHDebug(), ctx).
+			Str("curl", rl.curlCommand(ex.req, ex.reqBody)).
+			Msg("restclient curl")
+	}
+}
+
+// redactURL returns the URL with the sensitive query params and the userinfo redacted
+func (rl *requestLogger) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	cp := *u
+	if cp.User != nil {
+		cp.User = url.User(redactedValue)
+	}
+	if len(rl.queryParams) > 0 && len(cp.RawQuery) > 0 {
+		q := cp.Query()
+		for k := range q {
+			if rl.queryParams[k] {
+				q[k] = []string{redactedValue}
+			}
+		}
+		cp.RawQuery = q.Encode()
+	}
+	return cp.String()
+}
+
+// redactHeaders returns a copy of the headers with the sensitive values redacted
+func (rl *requestLogger) redactHeaders(h http.Header) http.Header {
+	cp := h.Clone()
+	for k := range cp {
+		if rl.headers[http.CanonicalHeaderKey(k)] {
+			cp[k] = []string{redactedValue}
+		}
+	}
+	return cp
+}
+
+func (rl *requestLogger) formatHeaders(h http.Header) string {
+	rh := rl.redactHeaders(h)
+	keys := make([]string, 0, len(rh))
+	for k := range rh {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", k, strings.Join(rh[k], ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatBody redacts the JSON fields and truncates the body to the configured limit
+func (rl *requestLogger) formatBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	body = rl.redactBody(body, contentType)
+	if len(body) > rl.bodyLimit {
+		return fmt.Sprintf("%s...(%d bytes truncated)", body[:rl.bodyLimit], len(body)-rl.bodyLimit)
+	}
+	return string(body)
+}
+
+func (rl *requestLogger) redactBody(body []byte, contentType string) []byte {
+	if len(rl.jsonFields) == 0 || !strings.Contains(normalizeMediaType(contentType), "json") {
+		return body
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+	b, err := json.Marshal(rl.redactJSON(doc))
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+func (rl *requestLogger) redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if rl.jsonFields[strings.ToLower(k)] {
+				t[k] = redactedValue
+				continue
+			}
+			t[k] = rl.redactJSON(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = rl.redactJSON(val)
+		}
+	}
+	return v
+}
+
+// curlCommand returns a curl command reproducing the request, with the secrets redacted
+func (rl *requestLogger) curlCommand(req *http.Request, body []byte) string {
+	parts := []string{"curl", "-X", req.Method, shellQuote(rl.redactURL(req.URL))}
+
+	rh := rl.redactHeaders(req.Header)
+	keys := make([]string, 0, len(rh))
+	for k := range rh {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range rh[k] {
+			parts = append(parts, "-H", shellQuote(fmt.Sprintf("%s: %s", k, v)))
+		}
+	}
+
+	if len(body) > 0 {
+		parts = append(parts, "--data-binary", shellQuote(string(rl.redactBody(body, req.Header.Get("Content-Type")))))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote wraps s in single quotes, escaping the inner ones
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
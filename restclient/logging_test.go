@@ -0,0 +1,140 @@
+package restclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/observability/logging"
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_request_logger_redaction(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	lc := NewLoggingConfig()
+	lc.BodyLimit = 60
+	lc.RedactHeaders = []string{"x-api-key"}
+	lc.RedactQueryParams = []string{"token"}
+	lc.RedactJSONFields = []string{"password"}
+	rl := newRequestLogger(lc)
+
+	u, _ := url.Parse("https://host/path?token=secret&page=2")
+	h := http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	h.Set("X-Api-Key", "key")
+	h.Set("Accept", MediaTypeJSON)
+
+	body := rl.formatBody([]byte(`{"user":"bob","creds":{"password":"pwd"}}`), MediaTypeJSON)
+	long := rl.formatBody([]byte(strings.Repeat("a", 70)), "text/plain")
+
+	tests.MaybeFail("request_logger_redaction",
+		tests.Expect(rl.redactURL(u), "https://host/path?page=2&token=%5BREDACTED%5D"),
+		tests.Expect(rl.formatHeaders(h), "Accept: application/json; Authorization: [REDACTED]; X-Api-Key: [REDACTED]"),
+		tests.Expect(body, `{"creds":{"password":"[REDACTED]"},"user":"bob"}`),
+		tests.Expect(long, strings.Repeat("a", 60)+"...(10 bytes truncated)"))
+}
+
+func Test_request_logger_curl(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	rl := newRequestLogger(NewLoggingConfig())
+
+	u, _ := url.Parse("http://host/items")
+	req := &http.Request{Method: "POST", URL: u, Header: http.Header{}}
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("Content-Type", MediaTypeJSON)
+
+	tests.MaybeFail("request_logger_curl",
+		tests.Expect(rl.curlCommand(req, []byte(`{"name":"it's"}`)),
+			`curl -X POST 'http://host/items' -H 'Authorization: [REDACTED]' -H 'Content-Type: application/json' --data-binary '{"name":"it'\''s"}'`))
+}
+
+func Test_handle_request_logs_without_token(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	lf := logging.NewLoggingFacade("restclientTest")
+	lf.SetLoggingEnvToDevelopment()
+	defer lf.SetLoggingEnvToProduction()
+
+	conf := NewConfig(srv.URL, AuthData{AuthType: Bearer, Token: "super-secret-token"})
+	conf.Logging = NewLoggingConfig()
+	conf.Logging.Curl = true
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	var out codecItem
+	ierr := rs.HandleRequest(NewRequest("GET", "/items", nil), &out)
+
+	w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	if ierr != nil {
+		t.Fatalf("handle_request failed: %v", ierr)
+	}
+	logs := buf.String()
+	tests.MaybeFail("handle_request_logs_without_token",
+		tests.Expect(strings.Contains(logs, "super-secret-token"), false),
+		tests.Expect(strings.Contains(logs, `"message":"restclient request"`), true),
+		tests.Expect(strings.Contains(logs, `"status":200`), true),
+		tests.Expect(strings.Contains(logs, `"message":"restclient curl"`), true))
+}
+
+func Test_handle_request_logs_without_per_request_credentials(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"item","count":1}`))
+	}))
+	defer srv.Close()
+
+	lf := logging.NewLoggingFacade("restclientTest")
+	lf.SetLoggingEnvToDevelopment()
+	defer lf.SetLoggingEnvToProduction()
+
+	conf := NewConfig(srv.URL)
+	conf.Logging = NewLoggingConfig()
+	conf.Logging.Curl = true
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	var out codecItem
+	inQuery := rs.HandleRequest(NewRequest("GET", "/items", nil).
+		WithAuthenticator(NewAPIKeyAuthenticator("api_key", "query-secret-key", APIKeyInQuery)), &out)
+	inHeader := rs.HandleRequest(NewRequest("GET", "/items", nil).
+		WithAuthenticator(NewAPIKeyAuthenticator("X-Api-Key", "header-secret-key", APIKeyInHeader)), &out)
+
+	w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	logs := buf.String()
+	tests.MaybeFail("handle_request_logs_without_per_request_credentials", inQuery, inHeader,
+		tests.Expect(strings.Contains(logs, "query-secret-key"), false),
+		tests.Expect(strings.Contains(logs, "header-secret-key"), false),
+		tests.Expect(strings.Contains(logs, "api_key=%5BREDACTED%5D"), true),
+		tests.Expect(strings.Contains(logs, `"message":"restclient curl"`), true))
+}
@@ -0,0 +1,830 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	restclientImport = "gitlab.com/grpasr/common/restclient"
+	errorsImport     = "gitlab.com/grpasr/common/errors/json"
+)
+
+// Config configures the generation
+type Config struct {
+	// Package is the package name of the generated file
+	Package string
+	// Source is the spec path written in the generated file header
+	Source string
+}
+
+// statusConstants are the errors/json status codes, the generated
+// error types refer to them rather than to the numeric codes
+var statusConstants = map[int]string{
+	http.StatusBadRequest:                    "StatusBadRequest",
+	http.StatusUnauthorized:                  "StatusUnauthorized",
+	http.StatusPaymentRequired:               "StatusPaymentRequired",
+	http.StatusForbidden:                     "StatusForbidden",
+	http.StatusNotFound:                      "StatusNotFound",
+	http.StatusMethodNotAllowed:              "StatusMethodNotAllowed",
+	http.StatusNotAcceptable:                 "StatusNotAcceptable",
+	http.StatusProxyAuthRequired:             "StatusProxyAuthRequired",
+	http.StatusRequestTimeout:                "StatusRequestTimeout",
+	http.StatusConflict:                      "StatusConflict",
+	http.StatusGone:                          "StatusGone",
+	http.StatusLengthRequired:                "StatusLengthRequired",
+	http.StatusPreconditionFailed:            "StatusPreconditionFailed",
+	http.StatusRequestEntityTooLarge:         "StatusRequestEntityTooLarge",
+	http.StatusRequestURITooLong:             "StatusRequestURITooLong",
+	http.StatusUnsupportedMediaType:          "StatusUnsupportedMediaType",
+	http.StatusRequestedRangeNotSatisfiable:  "StatusRequestedRangeNotSatisfiable",
+	http.StatusExpectationFailed:             "StatusExpectationFailed",
+	http.StatusTeapot:                        "StatusTeapot",
+	http.StatusMisdirectedRequest:            "StatusMisdirectedRequest",
+	http.StatusUnprocessableEntity:           "StatusUnprocessableEntity",
+	http.StatusLocked:                        "StatusLocked",
+	http.StatusFailedDependency:              "StatusFailedDependency",
+	http.StatusTooEarly:                      "StatusTooEarly",
+	http.StatusUpgradeRequired:               "StatusUpgradeRequired",
+	http.StatusPreconditionRequired:          "StatusPreconditionRequired",
+	http.StatusTooManyRequests:               "StatusTooManyRequests",
+	http.StatusRequestHeaderFieldsTooLarge:   "StatusRequestHeaderFieldsTooLarge",
+	http.StatusUnavailableForLegalReasons:    "StatusUnavailableForLegalReasons",
+	http.StatusInternalServerError:           "StatusInternalServerError",
+	http.StatusNotImplemented:                "StatusNotImplemented",
+	http.StatusBadGateway:                    "StatusBadGateway",
+	http.StatusServiceUnavailable:            "StatusServiceUnavailable",
+	http.StatusGatewayTimeout:                "StatusGatewayTimeout",
+	http.StatusHTTPVersionNotSupported:       "StatusHTTPVersionNotSupported",
+	http.StatusVariantAlsoNegotiates:         "StatusVariantAlsoNegotiates",
+	http.StatusInsufficientStorage:           "StatusInsufficientStorage",
+	http.StatusLoopDetected:                  "StatusLoopDetected",
+	http.StatusNotExtended:                   "StatusNotExtended",
+	http.StatusNetworkAuthenticationRequired: "StatusNetworkAuthenticationRequired",
+}
+
+// generator writes the Go source of a spec, the types are written
+// in types as they are discovered and the operations in ops
+type generator struct {
+	spec    *Spec
+	imports map[string]bool
+	// defined are the generated type names, true for the struct types
+	defined map[string]bool
+	enums   map[string]bool
+	types   bytes.Buffer
+	ops     bytes.Buffer
+}
+
+// Generate returns the formatted Go source of the typed client of spec
+func Generate(spec *Spec, conf Config) ([]byte, error) {
+	if len(conf.Package) == 0 {
+		return nil, fmt.Errorf("the package name is missing")
+	}
+	g := &generator{
+		spec:    spec,
+		imports: map[string]bool{},
+		defined: map[string]bool{},
+		enums:   map[string]bool{},
+	}
+
+	// the component names are reserved first so the inline types cannot take them
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+		g.defined[goName(name)] = isStruct(spec.Components.Schemas[name])
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.defineSchema(goName(name), spec.Components.Schemas[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %v", name, err)
+		}
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for p := range spec.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, mo := range spec.Paths[p].operations() {
+			if err := g.operation(p, mo.method, spec.Paths[p], mo.op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", mo.method, p, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	source := conf.Source
+	if len(source) == 0 {
+		source = "an OpenAPI document"
+	}
+	fmt.Fprintf(&out, "// Code generated by openapigen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&out, "package %s\n\n", conf.Package)
+	g.writeImports(&out)
+	if g.ops.Len() > 0 {
+		title := strings.TrimSpace(spec.Info.Title + " " + spec.Info.Version)
+		fmt.Fprintf(&out, "// Client is the typed client of %s\n", title)
+		out.WriteString("type Client struct {\n\trs restclient.Requester\n}\n\n")
+		out.WriteString("// NewClient returns a client sending the requests through rs\n")
+		out.WriteString("func NewClient(rs restclient.Requester) *Client {\n\treturn &Client{rs: rs}\n}\n\n")
+	}
+	out.Write(g.types.Bytes())
+	out.Write(g.ops.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("the generated source is invalid: %v", err)
+	}
+	return src, nil
+}
+
+func (g *generator) writeImports(out *bytes.Buffer) {
+	if len(g.imports) == 0 {
+		return
+	}
+	var std, module []string
+	for path := range g.imports {
+		if strings.Contains(path, ".") {
+			module = append(module, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(module)
+
+	out.WriteString("import (\n")
+	for _, path := range std {
+		fmt.Fprintf(out, "\t%q\n", path)
+	}
+	if len(std) > 0 && len(module) > 0 {
+		out.WriteString("\n")
+	}
+	for _, path := range module {
+		if path == errorsImport {
+			fmt.Fprintf(out, "\te %q\n", path)
+			continue
+		}
+		fmt.Fprintf(out, "\t%q\n", path)
+	}
+	out.WriteString(")\n\n")
+}
+
+// isStruct tells if the schema is generated as a struct
+func isStruct(s *Schema) bool {
+	return s != nil && len(s.Ref) == 0 && (len(s.Properties) > 0 || len(s.AllOf) > 1 ||
+		(len(s.AllOf) == 1 && len(s.AllOf[0].Ref) == 0))
+}
+
+// defineSchema writes the named type of a schema
+func (g *generator) defineSchema(name string, s *Schema) error {
+	switch {
+	case isStruct(s):
+		return g.defineStruct(name, s)
+	case s.Type == "string" && len(s.Enum) > 0:
+		g.defineEnum(name, s)
+		return nil
+	}
+	t, err := g.goType(s, name+"Item")
+	if err != nil {
+		return err
+	}
+	writeDoc(&g.types, name+" is the "+name+" schema", s.Description)
+	fmt.Fprintf(&g.types, "type %s %s\n\n", name, t)
+	return nil
+}
+
+func (g *generator) defineEnum(name string, s *Schema) {
+	g.enums[name] = true
+	writeDoc(&g.types, name+" is the "+name+" enumeration", s.Description)
+	fmt.Fprintf(&g.types, "type %s string\n\nconst (\n", name)
+	for _, v := range s.Enum {
+		suffix := goName(v)
+		if len(suffix) == 0 {
+			suffix = "Empty"
+		}
+		fmt.Fprintf(&g.types, "\t%s%s %s = %q\n", name, suffix, name, v)
+	}
+	g.types.WriteString(")\n\n")
+}
+
+// defineStruct writes the struct of an object schema, the allOf references
+// are embedded and the inline allOf schemas merged
+func (g *generator) defineStruct(name string, s *Schema) error {
+	var embedded []string
+	props := map[string]*Schema{}
+	required := map[string]bool{}
+	parts := append([]*Schema{{Properties: s.Properties, Required: s.Required}}, s.AllOf...)
+	for _, part := range parts {
+		if len(part.Ref) > 0 {
+			t, err := g.goType(part, "")
+			if err != nil {
+				return err
+			}
+			embedded = append(embedded, t)
+			continue
+		}
+		for k, v := range part.Properties {
+			props[k] = v
+		}
+		for _, k := range part.Required {
+			required[k] = true
+		}
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var fields bytes.Buffer
+	for _, t := range embedded {
+		fmt.Fprintf(&fields, "\t%s\n", t)
+	}
+	for _, k := range keys {
+		prop := props[k]
+		field := goName(k)
+		t, err := g.goType(prop, name+field)
+		if err != nil {
+			return fmt.Errorf("property %s: %v", k, err)
+		}
+		if prop.Nullable || (!required[k] && g.isStructType(t)) {
+			t = "*" + t
+		}
+		tag := k
+		if !required[k] {
+			tag += ",omitempty"
+		}
+		if len(prop.Description) > 0 {
+			writeDoc(&fields, "", prop.Description)
+		}
+		fmt.Fprintf(&fields, "\t%s %s `json:%q`\n", field, t, tag)
+	}
+
+	writeDoc(&g.types, name+" is the "+name+" schema", s.Description)
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n\n", name, fields.String())
+	return nil
+}
+
+// isStructType tells if t is a struct, its optional fields are pointers so they can be omitted
+func (g *generator) isStructType(t string) bool {
+	return t == "time.Time" || g.defined[t]
+}
+
+// goType returns the Go type of a schema, the inline objects and enumerations
+// are defined with the hint name
+func (g *generator) goType(s *Schema, hint string) (string, error) {
+	if s == nil {
+		return "interface{}", nil
+	}
+	if len(s.Ref) > 0 {
+		name, err := refName(s.Ref, "schemas")
+		if err != nil {
+			return "", err
+		}
+		if _, ok := g.spec.Components.Schemas[name]; !ok {
+			return "", fmt.Errorf("unknown schema %s", s.Ref)
+		}
+		return goName(name), nil
+	}
+	if len(s.AllOf) == 1 && len(s.AllOf[0].Ref) > 0 && len(s.Properties) == 0 {
+		return g.goType(s.AllOf[0], hint)
+	}
+	if isStruct(s) || (s.Type == "string" && len(s.Enum) > 0) {
+		if _, ok := g.defined[hint]; ok {
+			return "", fmt.Errorf("the type %s is defined twice", hint)
+		}
+		g.defined[hint] = isStruct(s)
+		return hint, g.defineSchema(hint, s)
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time", nil
+		case "byte":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		switch s.Format {
+		case "int32":
+			return "int32", nil
+		case "int64":
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		if s.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		t, err := g.goType(s.Items, hint)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + t, nil
+	case "object":
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			t, err := g.goType(s.AdditionalProperties.Schema, hint+"Value")
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + t, nil
+		}
+		return "map[string]interface{}", nil
+	}
+	return "interface{}", nil
+}
+
+// param is a resolved operation parameter
+type param struct {
+	*Parameter
+	field  string
+	goType string
+}
+
+// operation writes the request struct, the error type and the method of an operation
+func (g *generator) operation(path, method string, item *PathItem, op *Operation) error {
+	name := goName(op.OperationID)
+	if len(name) == 0 {
+		name = goName(strings.ToLower(method) + " " + path)
+	}
+
+	params, err := g.params(name, item, op)
+	if err != nil {
+		return err
+	}
+
+	var bodyType string
+	var bodyRequired bool
+	if op.RequestBody != nil {
+		rb, err := g.spec.requestBody(op.RequestBody)
+		if err != nil {
+			return err
+		}
+		schema := jsonSchema(rb.Content)
+		if schema == nil {
+			return fmt.Errorf("only the JSON request bodies are supported")
+		}
+		if bodyType, err = g.goType(schema, name+"Body"); err != nil {
+			return err
+		}
+		if g.isStructType(bodyType) {
+			bodyType = "*" + bodyType
+		}
+		bodyRequired = rb.Required
+	}
+
+	respType, errorCases, err := g.responses(name, op)
+	if err != nil {
+		return err
+	}
+
+	g.imports["context"] = true
+	g.imports[restclientImport] = true
+	g.imports[errorsImport] = true
+
+	// the request struct
+	hasRequest := len(params) > 0 || len(bodyType) > 0
+	if hasRequest {
+		fmt.Fprintf(&g.ops, "// %sRequest holds the parameters of %s\n", name, name)
+		fmt.Fprintf(&g.ops, "type %sRequest struct {\n", name)
+		for _, p := range params {
+			writeDoc(&g.ops, "", p.Description)
+			fmt.Fprintf(&g.ops, "\t%s %s\n", p.field, p.goType)
+		}
+		if len(bodyType) > 0 {
+			if bodyRequired {
+				g.ops.WriteString("\t// Body is the request body, it is required\n")
+			}
+			fmt.Fprintf(&g.ops, "\tBody %s\n", bodyType)
+		}
+		g.ops.WriteString("}\n\n")
+	}
+
+	if len(errorCases) > 0 {
+		g.writeErrorType(name, errorCases)
+	}
+
+	// the method
+	doc := fmt.Sprintf("%s sends %s %s", name, method, path)
+	if len(op.Summary) > 0 {
+		doc += ", " + lowerFirst(strings.TrimSuffix(strings.TrimSpace(op.Summary), "."))
+	}
+	writeDoc(&g.ops, doc, op.Description)
+	if op.Deprecated {
+		g.ops.WriteString("//\n// Deprecated: the operation is deprecated by the API\n")
+	}
+	signature := "ctx context.Context"
+	if hasRequest {
+		signature += ", r *" + name + "Request"
+	}
+	returns, zero := "e.IError", ""
+	if len(respType) > 0 {
+		zero = "out, "
+		if g.isStructType(respType) {
+			zero = "nil, "
+			returns = "(*" + respType + ", e.IError)"
+		} else {
+			returns = "(" + respType + ", e.IError)"
+		}
+	}
+	fmt.Fprintf(&g.ops, "func (c *Client) %s(%s) %s {\n", name, signature, returns)
+
+	endpoint, args, err := g.endpoint(path, params)
+	if err != nil {
+		return err
+	}
+	body := "nil"
+	if len(bodyType) > 0 {
+		if strings.HasPrefix(bodyType, "*") || strings.HasPrefix(bodyType, "[]") || strings.HasPrefix(bodyType, "map[") {
+			g.ops.WriteString("\tvar body interface{}\n\tif r.Body != nil {\n\t\tbody = r.Body\n\t}\n")
+			body = "body"
+		} else {
+			body = "r.Body"
+		}
+	}
+	fmt.Fprintf(&g.ops, "\treq := restclient.NewRequest(%q, %q, %s%s).WithContext(ctx)\n", method, endpoint, body, args)
+	g.writeQuery(params)
+	g.writeHeaders(params)
+
+	out := "nil"
+	if len(respType) > 0 {
+		fmt.Fprintf(&g.ops, "\tvar out %s\n", respType)
+		out = "&out"
+	}
+	if len(errorCases) > 0 {
+		fmt.Fprintf(&g.ops, "\tresult, err := c.rs.HandleRequestWithResult(req, %s)\n", out)
+		fmt.Fprintf(&g.ops, "\tif err != nil {\n\t\treturn %snew%sError(result, err)\n\t}\n", zero, name)
+	} else {
+		fmt.Fprintf(&g.ops, "\tif _, err := c.rs.HandleRequestWithResult(req, %s); err != nil {\n", out)
+		fmt.Fprintf(&g.ops, "\t\treturn %serr\n\t}\n", zero)
+	}
+	switch {
+	case len(respType) == 0:
+		g.ops.WriteString("\treturn nil\n")
+	case g.isStructType(respType):
+		g.ops.WriteString("\treturn &out, nil\n")
+	default:
+		g.ops.WriteString("\treturn out, nil\n")
+	}
+	g.ops.WriteString("}\n\n")
+	return nil
+}
+
+// params returns the path and query parameters of an operation, the operation's
+// ones overwrite the path's ones, the path parameters first then by name
+func (g *generator) params(opName string, item *PathItem, op *Operation) ([]param, error) {
+	byKey := map[string]*Parameter{}
+	for _, list := range [][]*Parameter{item.Parameters, op.Parameters} {
+		for _, p := range list {
+			resolved, err := g.spec.parameter(p)
+			if err != nil {
+				return nil, err
+			}
+			byKey[resolved.In+":"+resolved.Name] = resolved
+		}
+	}
+
+	var params []param
+	for _, p := range byKey {
+		switch p.In {
+		case "path", "query", "header":
+		default:
+			return nil, fmt.Errorf("the %s parameters are not supported, %s", p.In, p.Name)
+		}
+		field := goName(p.Name)
+		t, err := g.goType(p.Schema, opName+field)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", p.Name, err)
+		}
+		if strings.HasPrefix(t, "map[") || g.defined[t] {
+			return nil, fmt.Errorf("parameter %s: only the scalar and array parameters are supported", p.Name)
+		}
+		if p.In != "path" && !p.Required && !strings.HasPrefix(t, "[]") {
+			t = "*" + t
+		}
+		params = append(params, param{Parameter: p, field: field, goType: t})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if (params[i].In == "path") != (params[j].In == "path") {
+			return params[i].In == "path"
+		}
+		return params[i].Name < params[j].Name
+	})
+	return params, nil
+}
+
+// endpoint returns the printf endpoint of path and its arguments, the path parameters are escaped
+func (g *generator) endpoint(path string, params []param) (string, string, error) {
+	byName := map[string]param{}
+	for _, p := range params {
+		if p.In == "path" {
+			byName[p.Name] = p
+		}
+	}
+
+	var endpoint, args strings.Builder
+	rest := path
+	for {
+		i := strings.Index(rest, "{")
+		j := strings.Index(rest, "}")
+		if i < 0 || j < i {
+			break
+		}
+		endpoint.WriteString(strings.ReplaceAll(rest[:i], "%", "%%"))
+		endpoint.WriteString("%s")
+		p, ok := byName[rest[i+1:j]]
+		if !ok {
+			return "", "", fmt.Errorf("the path parameter %s is not declared", rest[i+1:j])
+		}
+		g.imports["net/url"] = true
+		args.WriteString(", url.PathEscape(" + g.format("r."+p.field, p.goType) + ")")
+		rest = rest[j+1:]
+	}
+	endpoint.WriteString(strings.ReplaceAll(rest, "%", "%%"))
+	return endpoint.String(), args.String(), nil
+}
+
+// format returns the expression of the string value of expr
+func (g *generator) format(expr, t string) string {
+	switch {
+	case t == "string":
+		return expr
+	case t == "time.Time":
+		return expr + ".Format(time.RFC3339)"
+	case g.enums[t]:
+		return "string(" + expr + ")"
+	}
+	g.imports["fmt"] = true
+	return "fmt.Sprint(" + expr + ")"
+}
+
+func (g *generator) writeQuery(params []param) {
+	var query []param
+	for _, p := range params {
+		if p.In == "query" {
+			query = append(query, p)
+		}
+	}
+	if len(query) == 0 {
+		return
+	}
+	g.imports["net/url"] = true
+	g.ops.WriteString("\tquery := url.Values{}\n")
+	for _, p := range query {
+		g.writeValue(p, "query.Add")
+	}
+	g.ops.WriteString("\treq.WithQuery(query)\n")
+}
+
+func (g *generator) writeHeaders(params []param) {
+	for _, p := range params {
+		if p.In == "header" {
+			g.writeValue(p, "req.WithHeader")
+		}
+	}
+}
+
+// writeValue writes the call of set for a query or header parameter,
+// the optional parameters are skipped when they are not set
+func (g *generator) writeValue(p param, set string) {
+	field := "r." + p.field
+	switch {
+	case strings.HasPrefix(p.goType, "[]"):
+		if set == "req.WithHeader" {
+			g.imports["strings"] = true
+			fmt.Fprintf(&g.ops, "\tif len(%s) > 0 {\n\t\tvalues := make([]string, 0, len(%s))\n", field, field)
+			fmt.Fprintf(&g.ops, "\t\tfor _, v := range %s {\n\t\t\tvalues = append(values, %s)\n\t\t}\n", field, g.format("v", p.goType[2:]))
+			fmt.Fprintf(&g.ops, "\t\treq.WithHeader(%q, strings.Join(values, \",\"))\n\t}\n", p.Name)
+			return
+		}
+		fmt.Fprintf(&g.ops, "\tfor _, v := range %s {\n\t\t%s(%q, %s)\n\t}\n", field, set, p.Name, g.format("v", p.goType[2:]))
+	case strings.HasPrefix(p.goType, "*"):
+		fmt.Fprintf(&g.ops, "\tif %s != nil {\n\t\t%s(%q, %s)\n\t}\n", field, set, p.Name, g.format("*"+field, p.goType[1:]))
+	default:
+		fmt.Fprintf(&g.ops, "\t%s(%q, %s)\n", set, p.Name, g.format(field, p.goType))
+	}
+}
+
+// errorCase is a declared error response of an operation
+type errorCase struct {
+	status string
+	field  string
+	goType string
+}
+
+// responses returns the type of the first 2xx JSON response, empty if there is none,
+// and the declared error responses ordered by status, the ranges and default last
+func (g *generator) responses(opName string, op *Operation) (string, []errorCase, error) {
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statusOrder(statuses[i]) < statusOrder(statuses[j])
+	})
+
+	var respType string
+	var cases []errorCase
+	for _, status := range statuses {
+		resp, err := g.spec.response(op.Responses[status])
+		if err != nil {
+			return "", nil, err
+		}
+		schema := jsonSchema(resp.Content)
+		if strings.HasPrefix(status, "2") {
+			if len(respType) == 0 && schema != nil {
+				if respType, err = g.goType(schema, opName+"Response"); err != nil {
+					return "", nil, err
+				}
+			}
+			continue
+		}
+		if schema == nil || strings.HasPrefix(status, "1") || strings.HasPrefix(status, "3") {
+			continue
+		}
+		field := statusField(status)
+		t, err := g.goType(schema, opName+field+"Body")
+		if err != nil {
+			return "", nil, err
+		}
+		cases = append(cases, errorCase{status: status, field: field, goType: t})
+	}
+	return respType, cases, nil
+}
+
+// statusOrder sorts the numeric statuses first, then the ranges and default
+func statusOrder(status string) int {
+	if code, err := strconv.Atoi(status); err == nil {
+		return code
+	}
+	if len(status) == 3 && strings.HasSuffix(strings.ToUpper(status), "XX") {
+		return 1000 + int(status[0]-'0')
+	}
+	return 2000
+}
+
+// statusField returns the error type field of a response status
+func statusField(status string) string {
+	if code, err := strconv.Atoi(status); err == nil {
+		if text := http.StatusText(code); len(text) > 0 {
+			return goName(text)
+		}
+		return "Status" + status
+	}
+	switch strings.ToUpper(status) {
+	case "4XX":
+		return "ClientError"
+	case "5XX":
+		return "ServerError"
+	}
+	return "Default"
+}
+
+// writeErrorType writes the error of an operation, it holds the decoded body of the declared error responses
+func (g *generator) writeErrorType(name string, cases []errorCase) {
+	g.imports["encoding/json"] = true
+
+	fmt.Fprintf(&g.ops, "// %sError is the error of %s, the field of the response status holds the decoded body\n", name, name)
+	fmt.Fprintf(&g.ops, "type %sError struct {\n\te.IError\n", name)
+	for _, c := range cases {
+		switch {
+		case c.field == "Default":
+			g.ops.WriteString("\t// Default is the body of the undeclared error statuses\n")
+		case strings.HasSuffix(strings.ToUpper(c.status), "XX"):
+			fmt.Fprintf(&g.ops, "\t// %s is the body of the undeclared %s statuses\n", c.field, c.status)
+		default:
+			fmt.Fprintf(&g.ops, "\t// %s is the body of the %s responses\n", c.field, c.status)
+		}
+		fmt.Fprintf(&g.ops, "\t%s *%s\n", c.field, c.goType)
+	}
+	g.ops.WriteString("}\n\n")
+
+	fmt.Fprintf(&g.ops, "func new%sError(result *restclient.Result, err e.IError) e.IError {\n", name)
+	fmt.Fprintf(&g.ops, "\toe := &%sError{IError: err}\n", name)
+	g.ops.WriteString("\tif result == nil || len(result.ErrorBody) == 0 {\n\t\treturn oe\n\t}\n")
+	if len(cases) == 1 && cases[0].field == "Default" {
+		writeDecode(&g.ops, cases[0], "\t")
+		g.ops.WriteString("\treturn oe\n}\n\n")
+		return
+	}
+
+	g.ops.WriteString("\tswitch code := result.StatusCode; {\n")
+	for _, c := range cases {
+		switch {
+		case c.field == "Default":
+			g.ops.WriteString("\tdefault:\n")
+		case strings.HasSuffix(strings.ToUpper(c.status), "XX"):
+			low := int(c.status[0]-'0') * 100
+			fmt.Fprintf(&g.ops, "\tcase code >= %d && code < %d:\n", low, low+100)
+		default:
+			code, _ := strconv.Atoi(c.status)
+			if constant, ok := statusConstants[code]; ok {
+				fmt.Fprintf(&g.ops, "\tcase code == int(e.%s):\n", constant)
+			} else {
+				fmt.Fprintf(&g.ops, "\tcase code == %d:\n", code)
+			}
+		}
+		writeDecode(&g.ops, c, "\t\t")
+	}
+	g.ops.WriteString("\t}\n\treturn oe\n}\n\n")
+}
+
+// writeDecode writes the decoding of an error body in its field
+func writeDecode(buf *bytes.Buffer, c errorCase, indent string) {
+	fmt.Fprintf(buf, "%svar body %s\n", indent, c.goType)
+	fmt.Fprintf(buf, "%sif json.Unmarshal(result.ErrorBody, &body) == nil {\n%s\toe.%s = &body\n%s}\n", indent, indent, c.field, indent)
+}
+
+// writeDoc writes a comment, summary then the description lines
+func writeDoc(buf *bytes.Buffer, summary, description string) {
+	if len(summary) > 0 {
+		fmt.Fprintf(buf, "// %s\n", summary)
+	}
+	description = strings.TrimSpace(description)
+	if len(description) == 0 {
+		return
+	}
+	if len(summary) > 0 {
+		buf.WriteString("//\n")
+	}
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(buf, "// %s\n", strings.TrimRight(line, " \t"))
+	}
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 1 && unicode.IsUpper(r[1]) {
+		// an initialism
+		return s
+	}
+	if len(r) > 0 {
+		r[0] = unicode.ToLower(r[0])
+	}
+	return string(r)
+}
+
+var initialisms = map[string]bool{
+	"API": true, "CPU": true, "DNS": true, "HTML": true, "HTTP": true, "HTTPS": true,
+	"ID": true, "IP": true, "JSON": true, "SQL": true, "TLS": true, "TTL": true,
+	"UI": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// goName returns the exported Go name of an OpenAPI name, petId is PetID
+func goName(s string) string {
+	var b strings.Builder
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, part := range parts {
+		for _, word := range splitCamel(part) {
+			if upper := strings.ToUpper(word); initialisms[upper] {
+				b.WriteString(upper)
+				continue
+			}
+			r := []rune(word)
+			r[0] = unicode.ToUpper(r[0])
+			b.WriteString(string(r))
+		}
+	}
+	name := b.String()
+	if len(name) > 0 && unicode.IsDigit(rune(name[0])) {
+		name = "N" + name
+	}
+	return name
+}
+
+// splitCamel splits petId in pet, Id and HTTPServer in HTTP, Server
+func splitCamel(s string) []string {
+	r := []rune(s)
+	var words []string
+	start := 0
+	for i := 1; i < len(r); i++ {
+		lowerToUpper := unicode.IsLower(r[i-1]) && unicode.IsUpper(r[i])
+		acronymEnd := unicode.IsUpper(r[i-1]) && unicode.IsUpper(r[i]) && i+1 < len(r) && unicode.IsLower(r[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(r[start:]))
+}
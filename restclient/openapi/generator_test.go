@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_generate_matches_the_committed_petstore_client(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	spec, err := LoadSpec("petstore/petstore.yaml")
+	tests.MaybeFail("load_spec", err)
+	src, err := Generate(spec, Config{Package: "petstore", Source: "petstore.yaml"})
+	tests.MaybeFail("generate", err)
+	committed, err := os.ReadFile("petstore/client.gen.go")
+	tests.MaybeFail("read_client", err)
+
+	// a difference means the generator changed without go generate being run
+	tests.MaybeFail("generate_matches_the_committed_petstore_client",
+		tests.Expect(string(src), string(committed)))
+}
+
+func Test_go_name(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	tests.MaybeFail("go_name",
+		tests.Expect(goName("petId"), "PetID"),
+		tests.Expect(goName("X-Request-ID"), "XRequestID"),
+		tests.Expect(goName("error_code"), "ErrorCode"),
+		tests.Expect(goName("HTTPServer"), "HTTPServer"),
+		tests.Expect(goName("get /pets/{petId}/url"), "GetPetsPetIDURL"),
+		tests.Expect(goName("2fa"), "N2fa"),
+		tests.Expect(goName("Unprocessable Entity"), "UnprocessableEntity"))
+}
+
+func Test_generate_rejects_unsupported_specs(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	_, err := ParseSpec([]byte(`{"swagger": "2.0"}`))
+	tests.MaybeFail("swagger_2", tests.Expect(err != nil, true))
+
+	generate := func(doc string) error {
+		spec, err := ParseSpec([]byte(doc))
+		if err != nil {
+			return err
+		}
+		_, err = Generate(spec, Config{Package: "api"})
+		return err
+	}
+
+	cookie := generate(`
+openapi: 3.0.0
+paths:
+  /items:
+    get:
+      parameters:
+        - {name: session, in: cookie, schema: {type: string}}
+      responses: {"200": {description: ok}}
+`)
+	undeclared := generate(`
+openapi: 3.0.0
+paths:
+  /items/{id}:
+    get:
+      responses: {"200": {description: ok}}
+`)
+	unknownRef := generate(`
+openapi: 3.0.0
+paths:
+  /items:
+    get:
+      responses:
+        "200":
+          description: ok
+          content: {application/json: {schema: {$ref: "#/components/schemas/Item"}}}
+`)
+
+	tests.MaybeFail("generate_rejects_unsupported_specs",
+		tests.Expect(strings.Contains(cookie.Error(), "the cookie parameters are not supported"), true),
+		tests.Expect(strings.Contains(undeclared.Error(), "GET /items/{id}: the path parameter id is not declared"), true),
+		tests.Expect(strings.Contains(unknownRef.Error(), "unknown schema #/components/schemas/Item"), true))
+}
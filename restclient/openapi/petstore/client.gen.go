@@ -0,0 +1,239 @@
+// Code generated by openapigen from petstore.yaml. DO NOT EDIT.
+
+package petstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/restclient"
+)
+
+// Client is the typed client of Petstore 1.0.0
+type Client struct {
+	rs restclient.Requester
+}
+
+// NewClient returns a client sending the requests through rs
+func NewClient(rs restclient.Requester) *Client {
+	return &Client{rs: rs}
+}
+
+// Error is the Error schema
+type Error struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// NewPetOwner is the NewPetOwner schema
+type NewPetOwner struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// NewPet is the NewPet schema
+type NewPet struct {
+	Name   string       `json:"name"`
+	Owner  *NewPetOwner `json:"owner,omitempty"`
+	Status PetStatus    `json:"status,omitempty"`
+	Tag    string       `json:"tag,omitempty"`
+}
+
+// Pet is the Pet schema
+//
+// A pet of the store.
+type Pet struct {
+	NewPet
+	CreatedAt *time.Time        `json:"createdAt,omitempty"`
+	ID        int64             `json:"id"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// PetStatus is the PetStatus enumeration
+type PetStatus string
+
+const (
+	PetStatusAvailable PetStatus = "available"
+	PetStatusPending   PetStatus = "pending"
+	PetStatusSold      PetStatus = "sold"
+)
+
+// ValidationErrorFields is the ValidationErrorFields schema
+type ValidationErrorFields struct {
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ValidationError is the ValidationError schema
+type ValidationError struct {
+	Fields  []ValidationErrorFields `json:"fields,omitempty"`
+	Message string                  `json:"message,omitempty"`
+}
+
+// ListPetsRequest holds the parameters of ListPets
+type ListPetsRequest struct {
+	// maximum number of pets returned
+	Limit  *int32
+	Status *PetStatus
+	Tags   []string
+}
+
+// ListPetsError is the error of ListPets, the field of the response status holds the decoded body
+type ListPetsError struct {
+	e.IError
+	// Default is the body of the undeclared error statuses
+	Default *Error
+}
+
+func newListPetsError(result *restclient.Result, err e.IError) e.IError {
+	oe := &ListPetsError{IError: err}
+	if result == nil || len(result.ErrorBody) == 0 {
+		return oe
+	}
+	var body Error
+	if json.Unmarshal(result.ErrorBody, &body) == nil {
+		oe.Default = &body
+	}
+	return oe
+}
+
+// ListPets sends GET /pets, list the pets
+func (c *Client) ListPets(ctx context.Context, r *ListPetsRequest) ([]Pet, e.IError) {
+	req := restclient.NewRequest("GET", "/pets", nil).WithContext(ctx)
+	query := url.Values{}
+	if r.Limit != nil {
+		query.Add("limit", fmt.Sprint(*r.Limit))
+	}
+	if r.Status != nil {
+		query.Add("status", string(*r.Status))
+	}
+	for _, v := range r.Tags {
+		query.Add("tags", v)
+	}
+	req.WithQuery(query)
+	var out []Pet
+	result, err := c.rs.HandleRequestWithResult(req, &out)
+	if err != nil {
+		return out, newListPetsError(result, err)
+	}
+	return out, nil
+}
+
+// CreatePetRequest holds the parameters of CreatePet
+type CreatePetRequest struct {
+	XRequestID string
+	// Body is the request body, it is required
+	Body *NewPet
+}
+
+// CreatePetError is the error of CreatePet, the field of the response status holds the decoded body
+type CreatePetError struct {
+	e.IError
+	// BadRequest is the body of the 400 responses
+	BadRequest *ValidationError
+	// Conflict is the body of the 409 responses
+	Conflict *Error
+}
+
+func newCreatePetError(result *restclient.Result, err e.IError) e.IError {
+	oe := &CreatePetError{IError: err}
+	if result == nil || len(result.ErrorBody) == 0 {
+		return oe
+	}
+	switch code := result.StatusCode; {
+	case code == int(e.StatusBadRequest):
+		var body ValidationError
+		if json.Unmarshal(result.ErrorBody, &body) == nil {
+			oe.BadRequest = &body
+		}
+	case code == int(e.StatusConflict):
+		var body Error
+		if json.Unmarshal(result.ErrorBody, &body) == nil {
+			oe.Conflict = &body
+		}
+	}
+	return oe
+}
+
+// CreatePet sends POST /pets, create a pet
+func (c *Client) CreatePet(ctx context.Context, r *CreatePetRequest) (*Pet, e.IError) {
+	var body interface{}
+	if r.Body != nil {
+		body = r.Body
+	}
+	req := restclient.NewRequest("POST", "/pets", body).WithContext(ctx)
+	req.WithHeader("X-Request-ID", r.XRequestID)
+	var out Pet
+	result, err := c.rs.HandleRequestWithResult(req, &out)
+	if err != nil {
+		return nil, newCreatePetError(result, err)
+	}
+	return &out, nil
+}
+
+// GetPetRequest holds the parameters of GetPet
+type GetPetRequest struct {
+	// the pet identifier
+	PetID int64
+}
+
+// GetPetError is the error of GetPet, the field of the response status holds the decoded body
+type GetPetError struct {
+	e.IError
+	// NotFound is the body of the 404 responses
+	NotFound *Error
+	// ServerError is the body of the undeclared 5XX statuses
+	ServerError *Error
+}
+
+func newGetPetError(result *restclient.Result, err e.IError) e.IError {
+	oe := &GetPetError{IError: err}
+	if result == nil || len(result.ErrorBody) == 0 {
+		return oe
+	}
+	switch code := result.StatusCode; {
+	case code == int(e.StatusNotFound):
+		var body Error
+		if json.Unmarshal(result.ErrorBody, &body) == nil {
+			oe.NotFound = &body
+		}
+	case code >= 500 && code < 600:
+		var body Error
+		if json.Unmarshal(result.ErrorBody, &body) == nil {
+			oe.ServerError = &body
+		}
+	}
+	return oe
+}
+
+// GetPet sends GET /pets/{petId}, info for a specific pet
+func (c *Client) GetPet(ctx context.Context, r *GetPetRequest) (*Pet, e.IError) {
+	req := restclient.NewRequest("GET", "/pets/%s", nil, url.PathEscape(fmt.Sprint(r.PetID))).WithContext(ctx)
+	var out Pet
+	result, err := c.rs.HandleRequestWithResult(req, &out)
+	if err != nil {
+		return nil, newGetPetError(result, err)
+	}
+	return &out, nil
+}
+
+// DeletePetRequest holds the parameters of DeletePet
+type DeletePetRequest struct {
+	// the pet identifier
+	PetID int64
+}
+
+// DeletePet sends DELETE /pets/{petId}
+//
+// Deprecated: the operation is deprecated by the API
+func (c *Client) DeletePet(ctx context.Context, r *DeletePetRequest) e.IError {
+	req := restclient.NewRequest("DELETE", "/pets/%s", nil, url.PathEscape(fmt.Sprint(r.PetID))).WithContext(ctx)
+	if _, err := c.rs.HandleRequestWithResult(req, nil); err != nil {
+		return err
+	}
+	return nil
+}
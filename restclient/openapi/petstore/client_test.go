@@ -0,0 +1,103 @@
+package petstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/grpasr/common/restclient"
+	"gitlab.com/grpasr/common/tests"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	rs, err := restclient.NewRestService(restclient.NewConfig(srv.URL), restclient.MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	return NewClient(rs)
+}
+
+func Test_generated_client_sends_the_parameters(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var query string
+	var created NewPet
+	var requestID string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", restclient.MediaTypeJSON)
+		switch r.Method {
+		case http.MethodGet:
+			query = r.URL.RawQuery
+			w.Write([]byte(`[{"id":1,"name":"rex","status":"sold","labels":{"color":"brown"}}]`))
+		case http.MethodPost:
+			requestID = r.Header.Get("X-Request-ID")
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":2,"name":"tom","createdAt":"2024-01-02T03:04:05Z"}`))
+		}
+	})
+
+	limit, status := int32(10), PetStatusSold
+	pets, err := client.ListPets(context.Background(), &ListPetsRequest{
+		Limit:  &limit,
+		Status: &status,
+		Tags:   []string{"dog", "brown"},
+	})
+	tests.MaybeFail("list_pets", err)
+
+	pet, err := client.CreatePet(context.Background(), &CreatePetRequest{
+		XRequestID: "req-1",
+		Body:       &NewPet{Name: "tom", Owner: &NewPetOwner{Name: "ann"}},
+	})
+	tests.MaybeFail("create_pet", err)
+
+	tests.MaybeFail("generated_client_sends_the_parameters",
+		tests.Expect(query, "limit=10&status=sold&tags=dog&tags=brown"),
+		tests.Expect(pets, []Pet{{NewPet: NewPet{Name: "rex", Status: PetStatusSold}, ID: 1, Labels: map[string]string{"color": "brown"}}}),
+		tests.Expect(requestID, "req-1"),
+		tests.Expect(created, NewPet{Name: "tom", Owner: &NewPetOwner{Name: "ann"}}),
+		tests.Expect(pet.ID, int64(2)),
+		tests.Expect(pet.CreatedAt.Year(), 2024))
+}
+
+func Test_generated_client_decodes_the_error_responses(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var paths []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", restclient.MediaTypeJSON)
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"invalid pet","fields":[{"field":"name","reason":"empty"}]}`))
+		case r.URL.Path == "/pets/404":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":404,"message":"pet not found"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error_code":502,"message":"upstream down"}`))
+		}
+	})
+
+	_, err := client.CreatePet(context.Background(), &CreatePetRequest{Body: &NewPet{}})
+	createErr, _ := err.(*CreatePetError)
+	_, err = client.GetPet(context.Background(), &GetPetRequest{PetID: 404})
+	notFound, _ := err.(*GetPetError)
+	_, err = client.GetPet(context.Background(), &GetPetRequest{PetID: 1})
+	serverErr, _ := err.(*GetPetError)
+
+	tests.MaybeFail("generated_client_decodes_the_error_responses",
+		tests.Expect(createErr.GetCode(), http.StatusBadRequest),
+		tests.Expect(createErr.BadRequest.Fields, []ValidationErrorFields{{Field: "name", Reason: "empty"}}),
+		tests.Expect(notFound.GetCode(), http.StatusNotFound),
+		tests.Expect(notFound.NotFound, &Error{ErrorCode: 404, Message: "pet not found"}),
+		tests.Expect(notFound.ServerError == nil, true),
+		tests.Expect(serverErr.ServerError.Message, "upstream down"),
+		tests.Expect(paths[1:], []string{"/pets/404", "/pets/1"}))
+}
@@ -0,0 +1,4 @@
+// Package petstore is the client generated from petstore.yaml, it shows and tests the generator output
+package petstore
+
+//go:generate go run gitlab.com/grpasr/common/restclient/cmd/openapigen -spec petstore.yaml -out client.gen.go
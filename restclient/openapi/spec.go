@@ -0,0 +1,218 @@
+package openapi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the subset of an OpenAPI 3 document the generator reads,
+// the JSON documents are read as YAML
+type Spec struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Info       Info                 `yaml:"info"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+type Info struct {
+	Title   string `yaml:"title"`
+	Version string `yaml:"version"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Responses     map[string]*Response    `yaml:"responses"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Options    *Operation   `yaml:"options"`
+	Head       *Operation   `yaml:"head"`
+	Patch      *Operation   `yaml:"patch"`
+}
+
+type methodOperation struct {
+	method string
+	op     *Operation
+}
+
+// operations returns the operations of the path, in a stable order
+func (p *PathItem) operations() []methodOperation {
+	var ops []methodOperation
+	for _, m := range []methodOperation{
+		{"GET", p.Get}, {"PUT", p.Put}, {"POST", p.Post}, {"DELETE", p.Delete},
+		{"OPTIONS", p.Options}, {"HEAD", p.Head}, {"PATCH", p.Patch},
+	} {
+		if m.op != nil {
+			ops = append(ops, m)
+		}
+	}
+	return ops
+}
+
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Summary     string               `yaml:"summary"`
+	Description string               `yaml:"description"`
+	Deprecated  bool                 `yaml:"deprecated"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+type Parameter struct {
+	Ref         string  `yaml:"$ref"`
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"`
+	Description string  `yaml:"description"`
+	Required    bool    `yaml:"required"`
+	Schema      *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string               `yaml:"$ref"`
+	Description string               `yaml:"description"`
+	Required    bool                 `yaml:"required"`
+	Content     map[string]MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref         string               `yaml:"$ref"`
+	Description string               `yaml:"description"`
+	Content     map[string]MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	Enum                 []string           `yaml:"enum"`
+	Nullable             bool               `yaml:"nullable"`
+	AllOf                []*Schema          `yaml:"allOf"`
+	OneOf                []*Schema          `yaml:"oneOf"`
+	AnyOf                []*Schema          `yaml:"anyOf"`
+	AdditionalProperties *AdditionalProps   `yaml:"additionalProperties"`
+}
+
+// AdditionalProps is the additionalProperties keyword, a boolean or a schema
+type AdditionalProps struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (a *AdditionalProps) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return node.Decode(&a.Schema)
+}
+
+// LoadSpec reads an OpenAPI 3 document, YAML or JSON
+func LoadSpec(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(b)
+}
+
+// ParseSpec parses an OpenAPI 3 document, YAML or JSON
+func ParseSpec(b []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, 3.x is expected", spec.OpenAPI)
+	}
+	return &spec, nil
+}
+
+// refName returns the component name of a local reference
+func refName(ref, section string) (string, error) {
+	prefix := "#/components/" + section + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %s, only %s... are resolved", ref, prefix)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+func (s *Spec) parameter(p *Parameter) (*Parameter, error) {
+	if len(p.Ref) == 0 {
+		return p, nil
+	}
+	name, err := refName(p.Ref, "parameters")
+	if err != nil {
+		return nil, err
+	}
+	if resolved, ok := s.Components.Parameters[name]; ok {
+		return resolved, nil
+	}
+	return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+}
+
+func (s *Spec) requestBody(rb *RequestBody) (*RequestBody, error) {
+	if len(rb.Ref) == 0 {
+		return rb, nil
+	}
+	name, err := refName(rb.Ref, "requestBodies")
+	if err != nil {
+		return nil, err
+	}
+	if resolved, ok := s.Components.RequestBodies[name]; ok {
+		return resolved, nil
+	}
+	return nil, fmt.Errorf("unknown request body %s", rb.Ref)
+}
+
+func (s *Spec) response(r *Response) (*Response, error) {
+	if len(r.Ref) == 0 {
+		return r, nil
+	}
+	name, err := refName(r.Ref, "responses")
+	if err != nil {
+		return nil, err
+	}
+	if resolved, ok := s.Components.Responses[name]; ok {
+		return resolved, nil
+	}
+	return nil, fmt.Errorf("unknown response %s", r.Ref)
+}
+
+// jsonSchema returns the schema of the JSON media type of content, nil if there is none
+func jsonSchema(content map[string]MediaType) *Schema {
+	if mt, ok := content["application/json"]; ok {
+		return mt.Schema
+	}
+	cts := make([]string, 0, len(content))
+	for ct := range content {
+		cts = append(cts, ct)
+	}
+	sort.Strings(cts)
+	for _, ct := range cts {
+		if strings.HasSuffix(ct, "+json") {
+			return content[ct].Schema
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package restclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	e "gitlab.com/grpasr/common/errors/json"
+)
+
+// PaginationStrategy moves a request from a page to the following one
+type PaginationStrategy interface {
+	// First prepares the request of the first page
+	First(request *Api)
+	// Next prepares the request of the page following the received one,
+	// page is the decoded page and received its number of items,
+	// it returns false when the received page is the last one
+	Next(request *Api, result *Result, page interface{}, received int) bool
+}
+
+// LinkPagination follows the Link rel="next" header (RFC 8288),
+// a link to another origin than the service's fails with 502 Bad Gateway
+type LinkPagination struct{}
+
+func (LinkPagination) First(*Api) {}
+
+func (LinkPagination) Next(request *Api, result *Result, _ interface{}, _ int) bool {
+	link := nextLink(result.Header)
+	if len(link) == 0 {
+		return false
+	}
+	next, err := result.URL.Parse(link)
+	if err != nil {
+		return false
+	}
+	request.rawURL = next
+	return true
+}
+
+// nextLink returns the target of the rel="next" link, empty if none
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(v), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// CursorPagination sends the cursor found in the page body as the Param query parameter,
+// an empty cursor ends the pagination
+type CursorPagination[P any] struct {
+	Param  string
+	Cursor func(page *P) string
+}
+
+func (c CursorPagination[P]) First(*Api) {}
+
+func (c CursorPagination[P]) Next(request *Api, _ *Result, page interface{}, _ int) bool {
+	p, ok := page.(*P)
+	if !ok {
+		return false
+	}
+	cursor := c.Cursor(p)
+	if len(cursor) == 0 {
+		return false
+	}
+	setQuery(request, c.Param, cursor)
+	return true
+}
+
+// OffsetPagination sends the OffsetParam and LimitParam query parameters,
+// a page shorter than Limit ends the pagination
+type OffsetPagination struct {
+	OffsetParam string
+	LimitParam  string
+	Limit       int
+}
+
+func NewOffsetPagination(limit int) OffsetPagination {
+	return OffsetPagination{OffsetParam: "offset", LimitParam: "limit", Limit: limit}
+}
+
+func (o OffsetPagination) First(request *Api) {
+	if len(request.query.Get(o.OffsetParam)) == 0 {
+		setQuery(request, o.OffsetParam, "0")
+	}
+	setQuery(request, o.LimitParam, strconv.Itoa(o.Limit))
+}
+
+func (o OffsetPagination) Next(request *Api, _ *Result, _ interface{}, received int) bool {
+	if received < o.Limit {
+		return false
+	}
+	offset, _ := strconv.Atoi(request.query.Get(o.OffsetParam))
+	setQuery(request, o.OffsetParam, strconv.Itoa(offset+received))
+	return true
+}
+
+// setQuery sets a query parameter on a copy of the query,
+// the pages' requests do not share it
+func setQuery(request *Api, key, value string) {
+	query := make(url.Values, len(request.query)+1)
+	for k, v := range request.query {
+		query[k] = v
+	}
+	query.Set(key, value)
+	request.query = query
+}
+
+// PagerConfig guards the pagination, zero means no limit
+type PagerConfig struct {
+	MaxPages int
+	MaxItems int
+	// Prefetch requests the next page while the current one is consumed
+	Prefetch bool
+}
+
+// pageResult is a fetched page
+type pageResult[P any] struct {
+	page   *P
+	result *Result
+	err    e.IError
+}
+
+// Pager iterates over the items of a paginated endpoint, P is the page
+// decoded from the response body and T the item type
+//
+//	pager := NewPager(rs, NewRequest("GET", "/users", nil), LinkPagination{}, SliceItems[User], PagerConfig{})
+//	for pager.Next(ctx) {
+//		user := pager.Item()
+//	}
+//	if err := pager.Err(); err != nil {
+type Pager[P any, T any] struct {
+	rs       Requester
+	request  *Api
+	strategy PaginationStrategy
+	items    func(page *P) []T
+	conf     PagerConfig
+
+	buffer  []T
+	current T
+	pages   int
+	yielded int
+	done    bool
+	err     e.IError
+	pending chan pageResult[P]
+}
+
+// NewPager returns a pager starting at request, items extracts the items of a page
+func NewPager[P any, T any](rs Requester, request *Api, strategy PaginationStrategy, items func(page *P) []T, conf PagerConfig) *Pager[P, T] {
+	first := *request
+	strategy.First(&first)
+	return &Pager[P, T]{
+		rs:       rs,
+		request:  &first,
+		strategy: strategy,
+		items:    items,
+		conf:     conf,
+	}
+}
+
+// SliceItems is the items extractor of the endpoints returning a JSON array
+func SliceItems[T any](page *[]T) []T {
+	return *page
+}
+
+// Next advances to the next item, fetching the pages as needed,
+// it returns false at the end of the pagination, on error or when a guard is reached
+func (p *Pager[P, T]) Next(ctx context.Context) bool {
+	for {
+		if p.err != nil {
+			return false
+		}
+		if p.conf.MaxItems > 0 && p.yielded >= p.conf.MaxItems {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			p.err = e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable)
+			return false
+		}
+		if len(p.buffer) > 0 {
+			p.current = p.buffer[0]
+			p.buffer = p.buffer[1:]
+			p.yielded++
+			return true
+		}
+		if p.done {
+			return false
+		}
+		p.fetch(ctx)
+	}
+}
+
+// Item returns the current item
+func (p *Pager[P, T]) Item() T {
+	return p.current
+}
+
+// Err returns the error which stopped the pagination
+func (p *Pager[P, T]) Err() e.IError {
+	return p.err
+}
+
+// Pages returns the number of pages received
+func (p *Pager[P, T]) Pages() int {
+	return p.pages
+}
+
+// All collects the remaining items
+func (p *Pager[P, T]) All(ctx context.Context) ([]T, e.IError) {
+	var all []T
+	for p.Next(ctx) {
+		all = append(all, p.Item())
+	}
+	return all, p.Err()
+}
+
+// fetch receives the current page and prepares the request of the next one
+func (p *Pager[P, T]) fetch(ctx context.Context) {
+	var pr pageResult[P]
+	if p.pending != nil {
+		select {
+		case pr = <-p.pending:
+		case <-ctx.Done():
+			pr.err = e.WrapHTTPStatusContext(ctx, ctx.Err(), e.StatusServiceUnavailable)
+		}
+		p.pending = nil
+	} else {
+		pr = p.fetchPage(ctx, p.request)
+	}
+	if pr.err != nil {
+		p.err = pr.err
+		return
+	}
+
+	p.pages++
+	p.buffer = p.items(pr.page)
+
+	// an empty page ends the pagination, it protects from the endless cursors
+	if len(p.buffer) == 0 ||
+		(p.conf.MaxPages > 0 && p.pages >= p.conf.MaxPages) ||
+		(p.conf.MaxItems > 0 && p.yielded+len(p.buffer) >= p.conf.MaxItems) {
+		p.done = true
+		return
+	}
+
+	next := *p.request
+	if !p.strategy.Next(&next, pr.result, pr.page, len(p.buffer)) {
+		p.done = true
+		return
+	}
+	p.request = &next
+
+	if p.conf.Prefetch {
+		// buffered so the goroutine never blocks when the pager is abandoned
+		pending := make(chan pageResult[P], 1)
+		go func() {
+			pending <- p.fetchPage(ctx, &next)
+		}()
+		p.pending = pending
+	}
+}
+
+func (p *Pager[P, T]) fetchPage(ctx context.Context, request *Api) pageResult[P] {
+	req := *request
+	req.ctx = ctx
+	page := new(P)
+	result, err := p.rs.HandleRequestWithResult(&req, page)
+	return pageResult[P]{page, result, err}
+}
@@ -0,0 +1,187 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/tests"
+)
+
+// newPagedServer serves total items, paged by the query offset and limit,
+// with a Link header and a cursor in the body
+func newPagedServer(total int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		if cursor := q.Get("cursor"); cursor != "" {
+			offset, _ = strconv.Atoi(cursor)
+		}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit == 0 {
+			limit = 2
+		}
+
+		page := cursorPage{}
+		for i := offset; i < offset+limit && i < total; i++ {
+			page.Items = append(page.Items, codecItem{Name: fmt.Sprintf("item-%d", i), Count: i})
+		}
+		if offset+limit < total {
+			page.Next = strconv.Itoa(offset + limit)
+			w.Header().Set("Link", fmt.Sprintf(`<items?offset=%d&limit=%d>; rel="next", </items?offset=0>; rel="first"`, offset+limit, limit))
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		json.NewEncoder(w).Encode(page)
+	}))
+}
+
+type cursorPage struct {
+	Items []codecItem `json:"items"`
+	Next  string      `json:"next"`
+}
+
+func pageItems(p *cursorPage) []codecItem {
+	return p.Items
+}
+
+func Test_pager_strategies(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var count int32
+	srv := newPagedServer(5, &count)
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL+"/api"), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	ctx := context.Background()
+
+	linkPager := NewPager(rs, NewRequest("GET", "/items", nil), LinkPagination{}, pageItems, PagerConfig{})
+	linkItems, errLink := linkPager.All(ctx)
+
+	cursor := CursorPagination[cursorPage]{Param: "cursor", Cursor: func(p *cursorPage) string { return p.Next }}
+	cursorItems, errCursor := NewPager(rs, NewRequest("GET", "/items", nil), cursor, pageItems, PagerConfig{Prefetch: true}).All(ctx)
+
+	offsetPager := NewPager(rs, NewRequest("GET", "/items", nil), NewOffsetPagination(3), pageItems, PagerConfig{})
+	offsetItems, errOffset := offsetPager.All(ctx)
+
+	tests.MaybeFail("pager_strategies",
+		tests.Expect(errLink, nil),
+		tests.Expect(len(linkItems), 5),
+		tests.Expect(linkItems[4].Name, "item-4"),
+		tests.Expect(linkPager.Pages(), 3),
+		tests.Expect(errCursor, nil),
+		tests.Expect(len(cursorItems), 5),
+		tests.Expect(cursorItems[2].Count, 2),
+		tests.Expect(errOffset, nil),
+		tests.Expect(len(offsetItems), 5),
+		tests.Expect(offsetPager.Pages(), 2))
+}
+
+func Test_pager_guards_and_cancellation(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var count int32
+	srv := newPagedServer(100, &count)
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	ctx := context.Background()
+
+	maxPages, errPages := NewPager(rs, NewRequest("GET", "/items", nil), LinkPagination{}, pageItems, PagerConfig{MaxPages: 2}).All(ctx)
+	pagesRequests := atomic.LoadInt32(&count)
+
+	maxItems, errItems := NewPager(rs, NewRequest("GET", "/items", nil), LinkPagination{}, pageItems, PagerConfig{MaxItems: 3}).All(ctx)
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pager := NewPager(rs, NewRequest("GET", "/items", nil), LinkPagination{}, pageItems, PagerConfig{Prefetch: true})
+	received := 0
+	for pager.Next(cctx) {
+		received++
+		if received == 3 {
+			cancel()
+		}
+	}
+
+	tests.MaybeFail("pager_guards_and_cancellation",
+		tests.Expect(errPages, nil),
+		tests.Expect(len(maxPages), 4),
+		tests.Expect(pagesRequests, int32(2)),
+		tests.Expect(errItems, nil),
+		tests.Expect(len(maxItems), 3),
+		tests.Expect(received, 3),
+		tests.Expect(pager.Err().GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(errors.Is(pager.Err(), context.Canceled), true))
+}
+
+func Test_next_link(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	header := http.Header{}
+	header.Add("Link", `<https://api/items?page=1>; rel="prev"`)
+	header.Add("Link", `<https://api/items?page=3>; rel="last", <https://api/items?page=2>; rel="next nofollow"`)
+
+	tests.MaybeFail("next_link",
+		tests.Expect(nextLink(header), "https://api/items?page=2"),
+		tests.Expect(nextLink(http.Header{}), ""))
+}
+
+func Test_pager_refuses_cross_origin_links(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var leaked int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&leaked, 1)
+	}))
+	defer other.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, other.URL))
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"items":[{"name":"item-0"}]}`))
+	}))
+	defer srv.Close()
+
+	conf := NewConfig(srv.URL)
+	conf.Authenticator = NewBearerAuthenticator("secret")
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	items, ierr := NewPager(rs, NewRequest("GET", "/items", nil), LinkPagination{}, pageItems, PagerConfig{}).All(context.Background())
+
+	tests.MaybeFail("pager_refuses_cross_origin_links",
+		tests.Expect(len(items), 1),
+		tests.Expect(ierr.GetCode(), http.StatusBadGateway),
+		tests.Expect(atomic.LoadInt32(&leaked), int32(0)))
+}
+
+// fakeRequester serves the pages of a slice, two items per page
+type fakeRequester struct {
+	items []codecItem
+}
+
+func (f *fakeRequester) HandleRequestWithResult(request *Api, response interface{}) (*Result, e.IError) {
+	offset, _ := strconv.Atoi(request.query.Get("offset"))
+	end := min(offset+2, len(f.items))
+	*response.(*[]codecItem) = f.items[offset:end]
+	return &Result{StatusCode: http.StatusOK}, nil
+}
+
+func Test_pager_with_a_fake_requester(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	fake := &fakeRequester{items: []codecItem{{Name: "a"}, {Name: "b"}, {Name: "c"}}}
+	items, ierr := NewPager(fake, NewRequest("GET", "/items", nil), NewOffsetPagination(2), SliceItems[codecItem], PagerConfig{}).All(context.Background())
+
+	tests.MaybeFail("pager_with_a_fake_requester", ierr,
+		tests.Expect(items, fake.items))
+}
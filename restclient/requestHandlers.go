@@ -3,7 +3,6 @@ package restclient
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	e "gitlab.com/grpasr/common/errors/json"
 	"io"
@@ -12,6 +11,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -26,30 +26,44 @@ const (
 	THandleRequest         RequestType = "THandleRequest"
 )
 
-// HandleRetryRequest is a generic func that add retry logic to the requests' handlers
+// HandleRetryRequest is a generic func that add retry logic to the requests' handlers,
+// the attempts are sent with a copy of request so the caller's Api can be shared
 func (rs *restService) HandleRetryRequest(ctx context.Context, request *Api, response interface{}, retries int8, delay int8, requestType RequestType, arguments ...string) e.IError {
+	switch requestType {
+	case THandleMultipartWriter:
+		if len(arguments) == 0 {
+			return e.NewCustomHTTPStatusContext(ctx, e.StatusBadRequest, "", "path to write is missing")
+		}
+	case THandleRequest:
+	default:
+		return e.NewCustomHTTPStatusContext(ctx, e.StatusBadRequest, "", "invalid requestType")
+	}
+
+	call := *request
+	if call.ctx == nil {
+		call.ctx = ctx
+	}
+	idempotencyKey := rs.idempotencyKey(&call)
+
+	return retry(ctx, retries, delay, func(attempt int) e.IError {
+		call.attempt = attempt
+		if requestType == THandleMultipartWriter {
+			return rs.HandleMultipartWriter(&call, arguments[0], response)
+		}
+		return rs.handleRequest(&call, response, nil, idempotencyKey)
+	})
+}
+
+// retry calls send until it succeeds or the retries are exhausted,
+// the delay, in seconds, is multiplied by the attempt number after each failure
+func retry(ctx context.Context, retries int8, delay int8, send func(attempt int) e.IError) e.IError {
 
 	baseDelay, _ := time.ParseDuration(fmt.Sprintf("%vs", delay))
 
-	var err e.IError
 	for r := int8(0); ; r++ {
-		switch requestType {
-		case THandleMultipartWriter:
-			if len(arguments) > 0 {
-				err = rs.HandleMultipartWriter(request, arguments[0], response)
-				if err == nil || r >= retries {
-					return err
-				}
-			} else {
-				return e.NewCustomHTTPStatus(e.StatusBadRequest, "", "path to write is missing")
-			}
-		case THandleRequest:
-			err = rs.HandleRequest(request, response)
-			if err == nil || r >= retries {
-				return err
-			}
-		default:
-			return e.NewCustomHTTPStatus(e.StatusBadRequest, "", "invalid requestType")
+		err := send(int(r))
+		if err == nil || r >= retries {
+			return err
 		}
 
 		baseDelay = time.Duration(int64(baseDelay) * int64(r+1))
@@ -65,37 +79,77 @@ func (rs *restService) HandleRetryRequest(ctx context.Context, request *Api, res
 
 // HandleMultipartWriter handle the multipart requests and write parts to the defined path
 func (rs *restService) HandleMultipartWriter(request *Api, pathToWrite string, response interface{}) e.IError {
+	ctx := request.context()
 	if err := os.MkdirAll(pathToWrite, os.ModePerm); err != nil {
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 	}
 
-	urlPath := path.Join(rs.url.Path, fmt.Sprintf(request.endpoint, request.arguments...))
-	endpoint, err := rs.url.Parse(urlPath)
+	endpoint, err := rs.requestURL(request)
 	if err != nil {
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 	}
 
 	req := &http.Request{
 		Method: request.method,
 		URL:    endpoint,
-		Header: rs.headers,
+		Header: rs.headers.Clone(),
+	}
+	result := &Result{URL: &url.URL{}}
+	*result.URL = *endpoint
+
+	if err := rs.authenticate(request, req, nil); err != nil {
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusUnauthorized)
 	}
 
+	return rs.intercept(&Exchange{
+		Api:         request,
+		Request:     req,
+		Result:      result,
+		pathToWrite: pathToWrite,
+	}, rs.sendMultipart)
+}
+
+// sendMultipart is the innermost handler of the multipart chain
+func (rs *restService) sendMultipart(ex *Exchange) e.IError {
+	request, req, pathToWrite := ex.Api, ex.Request, ex.pathToWrite
+
+	call, req := rs.instr.start(request, req)
+	ctx := req.Context()
+	start := time.Now()
 	resp, err := rs.Do(req)
 	if err != nil {
-		return e.NewCustomHTTPStatus(e.StatusServiceUnavailable, "", err.Error())
+		call.end(err)
+		ex.Result.Timings = call.timings
+		rs.logger.log(req.Context(), &exchange{req: req, auth: rs.authenticator(request), elapsed: time.Since(start), timings: call.timings, err: err})
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable)
 	}
+	call.statusCode = resp.StatusCode
+	ex.Result.StatusCode, ex.Result.Header = resp.StatusCode, resp.Header
+	defer func() {
+		call.end(nil)
+		ex.Result.Timings = call.timings
+		rs.logger.log(req.Context(), &exchange{
+			req:         req,
+			auth:        rs.authenticator(request),
+			statusCode:  resp.StatusCode,
+			respHeader:  resp.Header,
+			respSize:    call.responseSize,
+			elapsed:     time.Since(start),
+			timings:     call.timings,
+			skipRespLog: true,
+		})
+	}()
 	defer resp.Body.Close()
 
 	// Check if the response is successful
 	if resp.StatusCode != http.StatusOK {
-		return e.NewCustomHTTPStatus(e.StatusCode(resp.StatusCode))
+		return e.NewCustomHTTPStatusContext(ctx, e.StatusCode(resp.StatusCode))
 	}
 
 	// Check if the response is multipart
 	contentType := resp.Header.Get("Content-Type")
 	if !isMultipart(contentType) {
-		return e.NewCustomHTTPStatus(e.StatusBadRequest, "", "content-type is not multipart")
+		return e.NewCustomHTTPStatusContext(ctx, e.StatusBadRequest, "", "content-type is not multipart")
 	}
 
 	// Create a multipart reader
@@ -112,14 +166,15 @@ func (rs *restService) HandleMultipartWriter(request *Api, pathToWrite string, r
 		clientFilePath := filepath.Join(pathToWrite, part.FileName())
 		file, err := os.Create(clientFilePath)
 		if err != nil {
-			return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+			return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 		}
 		defer file.Close()
 
 		// Copy the part content to the client file
-		_, err = io.Copy(file, part)
+		n, err := io.Copy(file, part)
+		call.responseSize += n
 		if err != nil {
-			return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+			return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 		}
 
 		log.Printf("file %s created successfully on the client server\n", part.FileName())
@@ -143,46 +198,267 @@ func boundaryFromContentType(contentType string) string {
 
 // handleRequest sends a HTTP(S), placing results into the response object
 func (rs *restService) HandleRequest(request *Api, response interface{}) e.IError {
+	return rs.handleRequest(request, response, nil, rs.idempotencyKey(request))
+}
+
+// HandleRequestWithResult is HandleRequest also returning the request URL, the response status and headers
+func (rs *restService) HandleRequestWithResult(request *Api, response interface{}) (*Result, e.IError) {
+	result := &Result{}
+	err := rs.handleRequest(request, response, result, rs.idempotencyKey(request))
+	return result, err
+}
+
+// requestURL builds the request URL against the service URL
+func (rs *restService) requestURL(request *Api) (*url.URL, error) {
+	if request.rawURL != nil {
+		u := *request.rawURL
+		return &u, nil
+	}
+
 	urlPath := path.Join(rs.url.Path, fmt.Sprintf(request.endpoint, request.arguments...))
 	endpoint, err := rs.url.Parse(urlPath)
 	if err != nil {
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+		return nil, err
+	}
+	if len(request.query) > 0 {
+		q := endpoint.Query()
+		for k, v := range request.query {
+			q[k] = v
+		}
+		endpoint.RawQuery = q.Encode()
+	}
+	return endpoint, nil
+}
+
+// isServiceOrigin tells if u has the scheme and host of the service URL or of a balanced endpoint
+func (rs *restService) isServiceOrigin(u *url.URL) bool {
+	sameOrigin := func(o *url.URL) bool {
+		return strings.EqualFold(o.Scheme, u.Scheme) && strings.EqualFold(o.Host, u.Host)
+	}
+	if sameOrigin(rs.url) {
+		return true
+	}
+	if rs.balancer != nil {
+		for _, ep := range rs.balancer.endpoints {
+			if sameOrigin(ep.url) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rs *restService) handleRequest(request *Api, response interface{}, result *Result, idempotencyKey string) e.IError {
+	ex, err := rs.prepare(request, result, idempotencyKey)
+	if err != nil {
+		return err
+	}
+	ex.response = response
+	return rs.intercept(ex, rs.send)
+}
+
+// prepare builds the authenticated HTTP request of an Api, idempotencyKey is sent when not empty
+func (rs *restService) prepare(request *Api, result *Result, idempotencyKey string) (*Exchange, e.IError) {
+	ctx := request.context()
+	// the followed links must stay on the origin of the service, they receive its credentials
+	if request.rawURL != nil && !rs.isServiceOrigin(request.rawURL) {
+		return nil, e.NewCustomHTTPStatusContext(ctx, e.StatusBadGateway, "",
+			fmt.Sprintf("the link to %s://%s leaves the origin of the service", request.rawURL.Scheme, request.rawURL.Host))
+	}
+	endpoint, err := rs.requestURL(request)
+	if err != nil {
+		return nil, e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
+	}
+
+	contentType := rs.contentType
+	if len(request.contentType) > 0 {
+		contentType = request.contentType
+	}
+
+	header := rs.headers.Clone()
+	for k, v := range request.header {
+		header[k] = v
 	}
 
+	var outbuf []byte
 	var readCloser io.ReadCloser
 	if request.body != nil {
-		outbuf, err := json.Marshal(request.body)
+		codec, ok := rs.codecs.Get(contentType)
+		if !ok {
+			return nil, e.NewCustomHTTPStatusContext(ctx, e.StatusInternalServerError, "", fmt.Sprintf("no codec registered for %s", contentType))
+		}
+		outbuf, err = codec.Marshal(request.body)
 		if err != nil {
-			return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+			return nil, e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 		}
 		readCloser = ioutil.NopCloser(bytes.NewBuffer(outbuf))
+		header.Set("Content-Type", contentType)
+	}
+
+	accept := request.accept
+	if len(accept) == 0 {
+		accept = rs.codecs.Accept(contentType)
+	}
+	header.Set("Accept", accept)
+	if len(idempotencyKey) > 0 {
+		header.Set(IdempotencyKeyHeader, idempotencyKey)
 	}
 
 	req := &http.Request{
-		Method: request.method,
-		URL:    endpoint,
-		Body:   readCloser,
-		Header: rs.headers,
+		Method:        request.method,
+		URL:           endpoint,
+		Body:          readCloser,
+		ContentLength: int64(len(outbuf)),
+		Header:        header,
+	}
+	if outbuf != nil {
+		// lets the balancer send the body again to another endpoint
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(outbuf)), nil
+		}
+	}
+
+	if result == nil {
+		result = &Result{}
+	}
+	// copied before the authenticator may add credentials to the query
+	u := *endpoint
+	result.URL = &u
+
+	if err := rs.authenticate(request, req, outbuf); err != nil {
+		return nil, e.WrapHTTPStatusContext(ctx, err, e.StatusUnauthorized)
 	}
 
+	return &Exchange{
+		Api:            request,
+		Request:        req,
+		Result:         result,
+		IdempotencyKey: idempotencyKey,
+		reqBody:        outbuf,
+		accept:         accept,
+		contentType:    contentType,
+	}, nil
+}
+
+// send is the innermost handler of the chain, it serves from the cache
+// or performs the round trip, then decodes the response
+func (rs *restService) send(ex *Exchange) e.IError {
+	request, req, response, result := ex.Api, ex.Request, ex.response, ex.Result
+	outbuf, accept, contentType := ex.reqBody, ex.accept, ex.contentType
+
+	// GET responses are served from the cache while fresh, revalidated otherwise,
+	// the requests with their own authenticator bypass it
+	var cacheKey string
+	var cached *CachedResponse
+	if rs.cache != nil && req.Method == http.MethodGet && request.auth == nil {
+		var fresh bool
+		cacheKey = rs.cache.key(req, rs.auth)
+		cached, fresh = rs.cache.lookup(cacheKey, req)
+		if fresh {
+			return rs.decodeResponse(request.context(), cached.StatusCode, cached.Header, cached.Body, response, result, accept, contentType)
+		}
+	}
+
+	call, req := rs.instr.start(request, req)
+	ctx := req.Context()
+	call.requestSize = int64(len(outbuf))
+	start := time.Now()
 	resp, err := rs.Do(req)
 	if err != nil {
-		return e.NewCustomHTTPStatus(e.StatusServiceUnavailable, "", err.Error())
+		call.end(err)
+		result.Timings = call.timings
+		rs.logger.log(req.Context(), &exchange{req: req, auth: rs.authenticator(request), reqBody: outbuf, elapsed: time.Since(start), timings: call.timings, err: err})
+		if cached != nil && rs.cache.canServeStale(cached) {
+			return rs.decodeResponse(ctx, cached.StatusCode, cached.Header, cached.Body, response, result, accept, contentType)
+		}
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable)
 	}
-
+	call.statusCode = resp.StatusCode
 	defer resp.Body.Close()
-	if resp.StatusCode == 200 {
-		if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
-			return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+
+	body, err := io.ReadAll(resp.Body)
+	call.responseSize = int64(len(body))
+	call.end(err)
+	result.Timings = call.timings
+	rs.logger.log(req.Context(), &exchange{
+		req:        req,
+		auth:       rs.authenticator(request),
+		reqBody:    outbuf,
+		statusCode: resp.StatusCode,
+		respHeader: resp.Header,
+		respBody:   body,
+		respSize:   call.responseSize,
+		elapsed:    time.Since(start),
+		timings:    call.timings,
+		err:        err,
+	})
+	if err != nil {
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
+	}
+
+	statusCode, respHeader := resp.StatusCode, resp.Header
+	if len(cacheKey) > 0 {
+		statusCode, respHeader, body = rs.cache.update(cacheKey, cached, req.Header, statusCode, respHeader, body)
+	}
+
+	return rs.decodeResponse(ctx, statusCode, respHeader, body, response, result, accept, contentType)
+}
+
+// decodeResponse places a successful body into the response object,
+// or turns a failed one into an IError
+func (rs *restService) decodeResponse(ctx context.Context, statusCode int, header http.Header, body []byte, response interface{}, result *Result, accept, contentType string) e.IError {
+	if result != nil {
+		result.StatusCode = statusCode
+		result.Header = header
+	}
+
+	codec, cerr := rs.responseCodec(ctx, header, accept, contentType)
+
+	if statusCode >= 200 && statusCode < 300 {
+		if response == nil || len(body) == 0 {
+			return nil
+		}
+		if cerr != nil {
+			return cerr
+		}
+		if err := codec.Unmarshal(body, response); err != nil {
+			return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
 		}
 		return nil
 	}
 
+	if result != nil {
+		result.ErrorBody = body
+	}
+
+	if e.IsProblem(header.Get("Content-Type")) && len(body) > 0 {
+		if problem, err := e.ParseProblem(body); err == nil {
+			return problem
+		}
+	}
+
 	var failure RestError
-	failure.Code = 200
-	if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil {
-		return e.NewCustomHTTPStatus(e.StatusInternalServerError, "", err.Error())
+	if cerr == nil && len(body) > 0 {
+		_ = codec.Unmarshal(body, &failure)
 	}
 
-	return nil
+	return e.NewCustomHTTPStatusContext(ctx, e.StatusCode(statusCode), "", failure.Message)
+}
+
+// responseCodec selects the codec from the response Content-Type,
+// falling back on the Accept negotiation when the server does not set it
+func (rs *restService) responseCodec(ctx context.Context, header http.Header, accept, contentType string) (Codec, e.IError) {
+	if ct := header.Get("Content-Type"); len(ct) > 0 {
+		if codec, ok := rs.codecs.Get(ct); ok {
+			return codec, nil
+		}
+		return nil, e.NewCustomHTTPStatusContext(ctx, e.StatusInternalServerError, "", fmt.Sprintf("no codec registered for %s", ct))
+	}
+	if codec, ok := rs.codecs.Negotiate(accept); ok {
+		return codec, nil
+	}
+	if codec, ok := rs.codecs.Get(contentType); ok {
+		return codec, nil
+	}
+	return nil, e.NewCustomHTTPStatusContext(ctx, e.StatusInternalServerError, "", "response content-type is missing")
 }
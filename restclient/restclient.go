@@ -1,18 +1,18 @@
 package restclient
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
+
+	"gitlab.com/grpasr/common/configloader"
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/faultinjection"
 )
 
 // target registry
@@ -20,10 +20,22 @@ const ()
 
 // REST API request
 type Api struct {
-	method    string
-	endpoint  string
-	arguments []interface{}
-	body      interface{}
+	method       string
+	endpoint     string
+	arguments    []interface{}
+	body         interface{}
+	contentType  string
+	accept       string
+	query        url.Values
+	header       http.Header
+	ctx          context.Context
+	auth         Authenticator
+	interceptors []Interceptor
+	// rawURL overwrites the endpoint, used to follow the absolute links
+	rawURL *url.URL
+	// attempt is the retry number set by HandleRetryRequest
+	attempt        int
+	idempotencyKey string
 }
 
 // newRequest returns new restClient API request */
@@ -38,7 +50,99 @@ func NewRequest(method string, endpoint string, body interface{}, arguments ...i
 	}
 }
 
-// RestError represents a Schema Registry HTTP Error response
+// WithContentType sets the media type used to encode the request body,
+// it overwrites the restService's default content type
+func (a *Api) WithContentType(contentType string) *Api {
+	a.contentType = contentType
+	return a
+}
+
+// WithInterceptors appends interceptors running after the restService's ones
+func (a *Api) WithInterceptors(interceptors ...Interceptor) *Api {
+	a.interceptors = append(a.interceptors, interceptors...)
+	return a
+}
+
+// Method returns the HTTP method of the request
+func (a *Api) Method() string {
+	return a.method
+}
+
+// Endpoint returns the endpoint of the request, before the arguments are applied
+func (a *Api) Endpoint() string {
+	return a.endpoint
+}
+
+// Attempt returns the retry attempt of the request, 0 for the first one
+func (a *Api) Attempt() int {
+	return a.attempt
+}
+
+// WithHeader sets a header of the request, it overwrites the restService's one
+func (a *Api) WithHeader(key, value string) *Api {
+	if a.header == nil {
+		a.header = http.Header{}
+	}
+	a.header.Set(key, value)
+	return a
+}
+
+// WithQuery sets the query parameters of the request,
+// they overwrite the ones of the endpoint with the same key
+func (a *Api) WithQuery(query url.Values) *Api {
+	a.query = query
+	return a
+}
+
+// WithContext sets the context the request is bound to,
+// it carries the parent span and the cancellation
+func (a *Api) WithContext(ctx context.Context) *Api {
+	a.ctx = ctx
+	return a
+}
+
+// context returns the request context, context.Background() if none is set
+func (a *Api) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// WithAuthenticator sets the authenticator of the request,
+// it overwrites the restService's one
+func (a *Api) WithAuthenticator(auth Authenticator) *Api {
+	a.auth = auth
+	return a
+}
+
+// WithAccept sets the Accept header of the request,
+// by default the registered media types are sent with the request content type preferred
+func (a *Api) WithAccept(accept string) *Api {
+	a.accept = accept
+	return a
+}
+
+// Result holds the response metadata of a request
+type Result struct {
+	URL        *url.URL
+	StatusCode int
+	Header     http.Header
+	// Timings is the phases breakdown of the last round trip
+	Timings *Timings
+	// ErrorBody is the raw body of the non 2xx responses
+	ErrorBody []byte
+}
+
+// Requester sends the requests, the restService implements it,
+// the clients generated by openapigen, the Pager and Batch depend on it
+type Requester interface {
+	HandleRequestWithResult(request *Api, response interface{}) (*Result, e.IError)
+}
+
+var _ Requester = (*restService)(nil)
+
+// RestError represents an HTTP Error response in the error_code/message format of the Schema Registry
 type RestError struct {
 	Code    int    `json:"error_code"`
 	Message string `json:"message"`
@@ -50,149 +154,242 @@ func (err *RestError) Error() string {
 }
 
 type restService struct {
-	url     *url.URL
-	headers http.Header
+	url         *url.URL
+	headers     http.Header
+	contentType string
+	codecs      *CodecRegistry
+	instr       *clientInstrumentation
+	logger      *requestLogger
+	cache       *responseCache
+	balancer    *balancer
+	tlsReloader *tlsReloader
+	auth        Authenticator
+	// idempotencyKeys sends an Idempotency-Key with the POST and PATCH requests
+	idempotencyKeys bool
+	// interceptors wrap every request, in order
+	interceptors []Interceptor
 	*http.Client
 }
 
-// newRestService returns a new REST client
+// newRestService returns a new REST client,
+// contentType is the default media type of the requests' body
 func NewRestService(conf *Config, contentType string) (*restService, error) {
 	urlConf := conf.TargetURL
+	endpoints := conf.Endpoints
+	if len(urlConf) == 0 && len(endpoints) > 0 {
+		urlConf = endpoints[0].URL
+	} else if len(endpoints) > 0 {
+		endpoints = append([]Endpoint{{URL: urlConf}}, endpoints...)
+	}
 	u, err := url.Parse(urlConf)
 
 	if err != nil {
 		return nil, err
 	}
 
-	headers, err := newAuthHeader(u, conf)
+	authenticator, err := newAuthenticator(u, conf)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("In NewRestService, see the headers: ", headers)
+	headers := http.Header{}
 
-	headers.Add("Content-Type", contentType)
-	if err != nil {
-		return nil, err
+	if len(contentType) == 0 {
+		contentType = MediaTypeJSON
 	}
 
-	transport, err := configureTransport(conf)
+	transport, reloader, err := configureTransport(conf)
 	if err != nil {
 		return nil, err
 	}
+	if conf.FaultInjection != nil {
+		fic := *conf.FaultInjection
+		if len(fic.GOENV) == 0 {
+			fic.GOENV = conf.GOENV
+		}
+		injector, err := faultinjection.NewInjector(&fic)
+		if err != nil {
+			reloader.close()
+			return nil, err
+		}
+		transport = faultinjection.NewTransport(injector, transport)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	var lb *balancer
+	if len(endpoints) > 1 || conf.LoadBalancing != nil {
+		if len(endpoints) == 0 {
+			endpoints = []Endpoint{{URL: urlConf}}
+		}
+		lb, err = newBalancer(transport, u, endpoints, conf.LoadBalancing)
+		if err != nil {
+			reloader.close()
+			return nil, err
+		}
+		roundTripper = lb
+	}
+
+	if conf.Hedging != nil {
+		roundTripper = newHedger(roundTripper, conf.Hedging)
+	}
 
 	timeout := conf.RequestTimeoutMs
 
 	return &restService{
-		url:     u,
-		headers: headers,
+		url:             u,
+		headers:         headers,
+		contentType:     contentType,
+		codecs:          NewDefaultCodecRegistry(),
+		instr:           newClientInstrumentation(),
+		logger:          newRequestLogger(conf.Logging),
+		cache:           newResponseCache(conf.Cache),
+		balancer:        lb,
+		tlsReloader:     reloader,
+		auth:            authenticator,
+		idempotencyKeys: !conf.DisableIdempotencyKeys,
+		interceptors:    append([]Interceptor(nil), conf.Interceptors...),
 		Client: &http.Client{
-			Transport: transport,
+			Transport: roundTripper,
 			Timeout:   time.Duration(timeout) * time.Millisecond,
 		},
 	}, nil
 }
 
-// configureTransport returns a new Transport
-func configureTransport(conf *Config) (*http.Transport, error) {
+// Close stops the background health checks and TLS reloads, and closes the idle connections
+func (rs *restService) Close() {
+	if rs.balancer != nil {
+		rs.balancer.close()
+	}
+	rs.tlsReloader.close()
+	rs.CloseIdleConnections()
+}
+
+// authenticate applies the request authenticator, or the restService's one
+func (rs *restService) authenticate(request *Api, req *http.Request, body []byte) error {
+	auth := rs.authenticator(request)
+	if auth == nil {
+		return nil
+	}
+	return auth.Authenticate(req, body)
+}
+
+// authenticator is the authenticator of request, the one of the service when it has none
+func (rs *restService) authenticator(request *Api) Authenticator {
+	if request.auth != nil {
+		return request.auth
+	}
+	return rs.auth
+}
+
+// RegisterCodec adds a codec to the restService's registry
+func (rs *restService) RegisterCodec(c Codec, aliases ...string) {
+	rs.codecs.Register(c, aliases...)
+}
+
+// configureTransport returns a new Transport and the reloader of its TLS material, if any
+func configureTransport(conf *Config) (http.RoundTripper, *tlsReloader, error) {
 
 	// Exposed for testing purposes only. In production properly formed certificates should be used
 	// https://tools.ietf.org/html/rfc2818#section-3
 	tlsConfig := &tls.Config{}
-	if err := configureTLS(conf, tlsConfig); err != nil {
-		return nil, err
+	reloader, err := configureTLS(conf, tlsConfig)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	timeout := conf.ConnectionTimeoutMs
+	dial := configureDialer(conf)
 
-	return &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: time.Duration(timeout) * time.Millisecond,
-		}).Dial,
-		TLSClientConfig: tlsConfig,
-	}, nil
+	if conf.H2C {
+		return configureH2C(conf, dial), reloader, nil
+	}
+
+	proxy, err := configureProxy(conf)
+	if err != nil {
+		reloader.close()
+		return nil, nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     conf.ForceHTTP2,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(conf.IdleConnTimeoutMs) * time.Millisecond,
+		TLSHandshakeTimeout:   time.Duration(conf.TLSHandshakeTimeoutMs) * time.Millisecond,
+		ResponseHeaderTimeout: time.Duration(conf.ResponseHeaderTimeoutMs) * time.Millisecond,
+		ExpectContinueTimeout: time.Second,
+	}
+	if tlsConfig.VerifyConnection != nil {
+		// the direct connections verify the dialed host, the VerifyConnection of
+		// tlsConfig only applies to the connections through a proxy
+		transport.DialTLSContext = reloader.dialTLS(tlsConfig, dial, transport.TLSHandshakeTimeout)
+	}
+	return transport, reloader, nil
 }
 
-// configureTLS populates tlsConf
-func configureTLS(conf *Config, tlsConf *tls.Config) error {
+// configureTLS populates tlsConf, the certificate and the CA files are read
+// through a reloader so their rotation applies to the new connections
+func configureTLS(conf *Config, tlsConf *tls.Config) (*tlsReloader, error) {
 	certFile := conf.SslCertificateLocation
 	keyFile := conf.SslKeyLocation
 	caFile := conf.SslCaLocation
 	unsafe := conf.SslDisableEndpointVerification
 
-	var err error
-	if certFile != "" {
-		if keyFile == "" {
-			return errors.New(
-				"SslKeyLocation needs to be provided if using SslCertificateLocation")
-		}
-		var cert tls.Certificate
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-		if err != nil {
-			return err
-		}
-		tlsConf.Certificates = []tls.Certificate{cert}
+	if certFile != "" && keyFile == "" {
+		return nil, errors.New(
+			"SslKeyLocation needs to be provided if using SslCertificateLocation")
 	}
 
-	if caFile != "" {
-		if unsafe {
-			log.Println("WARN: endpoint verification is currently disabled. " +
-				"This feature should be configured for development purposes only")
-		}
-		var caCert []byte
-		caCert, err := ioutil.ReadFile(caFile)
-		if err != nil {
-			return err
-		}
-
-		tlsConf.RootCAs = x509.NewCertPool()
-		if !tlsConf.RootCAs.AppendCertsFromPEM(caCert) {
-			return fmt.Errorf("could not parse certificate from %s", caFile)
-		}
+	minVersion, err := parseTLSVersion(conf.SslMinVersion)
+	if err != nil {
+		return nil, err
 	}
+	tlsConf.MinVersion = minVersion
 
-	tlsConf.BuildNameToCertificate()
+	suites, err := parseCipherSuites(conf.SslCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf.CipherSuites = suites
 
-	return err
-}
+	tlsConf.ServerName = conf.SslServerName
 
-// newAuthHeader returns a base64 encoded userinfo string identified on the configured credentials source
-func newAuthHeader(service *url.URL, conf *Config) (http.Header, error) {
-	// Remove userinfo from url regardless of source to avoid confusion/conflicts
-	defer func() {
-		service.User = nil
-	}()
+	if unsafe {
+		if configloader.IsProductionEnv(conf.GOENV) {
+			return nil, errors.New(
+				"SslDisableEndpointVerification can not be enabled in production")
+		}
+		log.Println("WARN: endpoint verification is currently disabled. " +
+			"This feature should be configured for development purposes only")
+		tlsConf.InsecureSkipVerify = true
+	}
 
-	source := conf.BasicAuthCredentialsSource
+	if certFile == "" && caFile == "" {
+		return nil, nil
+	}
 
-	header := http.Header{}
+	reloader := newTLSReloader(certFile, keyFile, caFile)
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
 
-	var err error
-	switch strings.ToUpper(source) {
-	case "URL":
-		err = configureURLAuth(service, header)
-	case "BEARER":
-		err = configureSpecificAuth(conf, header)
-	default:
-		err = fmt.Errorf("unrecognized value for basic.auth.credentials.source %s", source)
+	if certFile != "" {
+		tlsConf.GetClientCertificate = reloader.getClientCertificate
 	}
-	return header, err
-}
 
-// configureURLAuth copies the url userinfo into a basic HTTP auth authorization header
-func configureURLAuth(service *url.URL, header http.Header) error {
-	header.Add("Authorization", fmt.Sprintf("Basic %s", encodeBasicAuth(service.User.String())))
-	return nil
-}
+	if caFile != "" && !unsafe {
+		// the standard verification is replaced by the same one run against
+		// the reloader's current CA bundle
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyConnection = reloader.verifyConnection(conf.SslServerName)
+	}
 
-func configureSpecificAuth(conf *Config, header http.Header) error {
-	token := strings.TrimSpace(string(conf.AuthCredentialsDatas.Token))
-	token = strings.Trim(token, `"`)
-	header.Add("Authorization", fmt.Sprintf("%s %s", string(conf.AuthCredentialsDatas.AuthType), token))
-	return nil
-}
+	if conf.SslReloadIntervalMs > 0 {
+		reloader.watch(time.Duration(conf.SslReloadIntervalMs) * time.Millisecond)
+	}
 
-// encodeBasicAuth adds a basic http authentication header to the provided header
-func encodeBasicAuth(userinfo string) string {
-	return base64.StdEncoding.EncodeToString([]byte(userinfo))
+	return reloader, nil
 }
@@ -0,0 +1,414 @@
+// Package schemaregistry is a Confluent compatible Schema Registry client built on the restclient
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	e "gitlab.com/grpasr/common/errors/json"
+	"gitlab.com/grpasr/common/restclient"
+)
+
+const (
+	// MediaTypeSchemaRegistry is the media type of the Schema Registry API v1
+	MediaTypeSchemaRegistry = "application/vnd.schemaregistry.v1+json"
+	// LatestVersion selects the latest version of a subject
+	LatestVersion = -1
+)
+
+// the Schema Registry error codes, the HTTP status is their 3 first digits
+const (
+	ErrCodeSubjectNotFound         = 40401
+	ErrCodeVersionNotFound         = 40402
+	ErrCodeSchemaNotFound          = 40403
+	ErrCodeSubjectSoftDeleted      = 40404
+	ErrCodeSubjectNotSoftDeleted   = 40405
+	ErrCodeVersionSoftDeleted      = 40406
+	ErrCodeVersionNotSoftDeleted   = 40407
+	ErrCodeSubjectConfigNotFound   = 40408
+	ErrCodeIncompatibleSchema      = 40901
+	ErrCodeInvalidSchema           = 42201
+	ErrCodeInvalidVersion          = 42202
+	ErrCodeInvalidCompatibility    = 42203
+	ErrCodeBackendStoreError       = 50001
+	ErrCodeOperationTimeout        = 50002
+	ErrCodeRequestForwardingFailed = 50003
+)
+
+// SchemaType is the format of a schema, AVRO when empty
+type SchemaType string
+
+const (
+	Avro     SchemaType = "AVRO"
+	Protobuf SchemaType = "PROTOBUF"
+	JSON     SchemaType = "JSON"
+)
+
+// Compatibility is a compatibility level
+type Compatibility string
+
+const (
+	None               Compatibility = "NONE"
+	Backward           Compatibility = "BACKWARD"
+	BackwardTransitive Compatibility = "BACKWARD_TRANSITIVE"
+	Forward            Compatibility = "FORWARD"
+	ForwardTransitive  Compatibility = "FORWARD_TRANSITIVE"
+	Full               Compatibility = "FULL"
+	FullTransitive     Compatibility = "FULL_TRANSITIVE"
+)
+
+// Reference is a schema imported by another one
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// SchemaInfo is a schema and its references
+type SchemaInfo struct {
+	Schema     string      `json:"schema"`
+	SchemaType SchemaType  `json:"schemaType,omitempty"`
+	References []Reference `json:"references,omitempty"`
+}
+
+// SchemaMetadata is a schema registered under a subject
+type SchemaMetadata struct {
+	SchemaInfo
+	ID      int    `json:"id"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Error is an error response of the registry, Code is the registry error code, e.g. 40401
+type Error struct {
+	e.IError
+	Code int
+}
+
+// ErrorCode returns the registry error code of err, 0 if err is not a registry error
+func ErrorCode(err e.IError) int {
+	if re, ok := err.(*Error); ok {
+		return re.Code
+	}
+	return 0
+}
+
+// service is the restService, it is not exported by the restclient
+type service interface {
+	restclient.Requester
+	Close()
+}
+
+// Client calls the Schema Registry, the schemas by ID and the IDs and versions
+// of the registered schemas are cached, they are immutable in the registry.
+// A deletion through the client evicts the subject from the cache.
+type Client struct {
+	rs service
+
+	mu sync.RWMutex
+	// schemas by ID
+	schemas map[int]*SchemaInfo
+	// ids and metadata of the schemas by subject then schema
+	ids      map[string]map[string]int
+	metadata map[string]map[string]*SchemaMetadata
+	// versions by subject then version
+	versions map[string]map[int]*SchemaMetadata
+}
+
+// NewClient returns a client of the registry at conf.TargetURL
+func NewClient(conf *restclient.Config) (*Client, error) {
+	rs, err := restclient.NewRestService(conf, MediaTypeSchemaRegistry)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		rs:       rs,
+		schemas:  map[int]*SchemaInfo{},
+		ids:      map[string]map[string]int{},
+		metadata: map[string]map[string]*SchemaMetadata{},
+		versions: map[string]map[int]*SchemaMetadata{},
+	}, nil
+}
+
+// Close releases the connections
+func (c *Client) Close() {
+	c.rs.Close()
+}
+
+// Register registers the schema under subject, it returns the schema ID,
+// normalize asks the registry to normalize the schema first
+func (c *Client) Register(ctx context.Context, subject string, schema SchemaInfo, normalize bool) (int, e.IError) {
+	key := schemaKey(schema)
+	c.mu.RLock()
+	id, ok := c.ids[subject][key]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	req := restclient.NewRequest("POST", "/subjects/%s/versions", schema, url.PathEscape(subject))
+	if normalize {
+		req.WithQuery(url.Values{"normalize": {"true"}})
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	setIn(c.ids, subject, key, resp.ID)
+	if _, ok := c.schemas[resp.ID]; !ok {
+		info := schema
+		c.schemas[resp.ID] = &info
+	}
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// LookupSchema returns the ID and version of a schema registered under subject
+func (c *Client) LookupSchema(ctx context.Context, subject string, schema SchemaInfo, normalize bool) (*SchemaMetadata, e.IError) {
+	key := schemaKey(schema)
+	c.mu.RLock()
+	md, ok := c.metadata[subject][key]
+	c.mu.RUnlock()
+	if ok {
+		return md, nil
+	}
+
+	md = &SchemaMetadata{}
+	req := restclient.NewRequest("POST", "/subjects/%s", schema, url.PathEscape(subject))
+	if normalize {
+		req.WithQuery(url.Values{"normalize": {"true"}})
+	}
+	if err := c.do(ctx, req, md); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	setIn(c.metadata, subject, key, md)
+	setIn(c.ids, subject, key, md.ID)
+	c.mu.Unlock()
+	return md, nil
+}
+
+// GetByID returns the schema of an ID
+func (c *Client) GetByID(ctx context.Context, id int) (*SchemaInfo, e.IError) {
+	c.mu.RLock()
+	info, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return info, nil
+	}
+
+	info = &SchemaInfo{}
+	if err := c.do(ctx, restclient.NewRequest("GET", "/schemas/ids/%d", nil, id), info); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.schemas[id] = info
+	c.mu.Unlock()
+	return info, nil
+}
+
+// GetBySubjectAndVersion returns a version of subject, LatestVersion is never cached
+func (c *Client) GetBySubjectAndVersion(ctx context.Context, subject string, version int) (*SchemaMetadata, e.IError) {
+	if version != LatestVersion {
+		c.mu.RLock()
+		md, ok := c.versions[subject][version]
+		c.mu.RUnlock()
+		if ok {
+			return md, nil
+		}
+	}
+
+	md := &SchemaMetadata{}
+	req := restclient.NewRequest("GET", "/subjects/%s/versions/%s", nil, url.PathEscape(subject), versionParam(version))
+	if err := c.do(ctx, req, md); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	setIn(c.versions, subject, md.Version, md)
+	if _, ok := c.schemas[md.ID]; !ok {
+		info := md.SchemaInfo
+		c.schemas[md.ID] = &info
+	}
+	c.mu.Unlock()
+	return md, nil
+}
+
+// GetLatest returns the latest version of subject
+func (c *Client) GetLatest(ctx context.Context, subject string) (*SchemaMetadata, e.IError) {
+	return c.GetBySubjectAndVersion(ctx, subject, LatestVersion)
+}
+
+// GetSubjects lists the subjects, with the soft deleted ones when deleted is true
+func (c *Client) GetSubjects(ctx context.Context, deleted bool) ([]string, e.IError) {
+	var subjects []string
+	req := restclient.NewRequest("GET", "/subjects", nil)
+	if deleted {
+		req.WithQuery(url.Values{"deleted": {"true"}})
+	}
+	if err := c.do(ctx, req, &subjects); err != nil {
+		return nil, err
+	}
+	return subjects, nil
+}
+
+// GetVersions lists the versions of subject
+func (c *Client) GetVersions(ctx context.Context, subject string) ([]int, e.IError) {
+	var versions []int
+	if err := c.do(ctx, restclient.NewRequest("GET", "/subjects/%s/versions", nil, url.PathEscape(subject)), &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// TestCompatibility checks the schema against a version of subject, the messages explain an incompatibility
+func (c *Client) TestCompatibility(ctx context.Context, subject string, version int, schema SchemaInfo) (bool, []string, e.IError) {
+	var resp struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	req := restclient.NewRequest("POST", "/compatibility/subjects/%s/versions/%s", schema, url.PathEscape(subject), versionParam(version)).
+		WithQuery(url.Values{"verbose": {"true"}})
+	if err := c.do(ctx, req, &resp); err != nil {
+		return false, nil, err
+	}
+	return resp.IsCompatible, resp.Messages, nil
+}
+
+// GetCompatibility returns the compatibility level of subject, the global one when subject is empty,
+// defaultToGlobal falls back on the global level when the subject has none
+func (c *Client) GetCompatibility(ctx context.Context, subject string, defaultToGlobal bool) (Compatibility, e.IError) {
+	var resp struct {
+		CompatibilityLevel Compatibility `json:"compatibilityLevel"`
+	}
+	req := configRequest("GET", subject, nil)
+	if defaultToGlobal && len(subject) > 0 {
+		req.WithQuery(url.Values{"defaultToGlobal": {"true"}})
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.CompatibilityLevel, nil
+}
+
+// UpdateCompatibility sets the compatibility level of subject, the global one when subject is empty
+func (c *Client) UpdateCompatibility(ctx context.Context, subject string, level Compatibility) (Compatibility, e.IError) {
+	var resp struct {
+		Compatibility Compatibility `json:"compatibility"`
+	}
+	body := map[string]Compatibility{"compatibility": level}
+	if err := c.do(ctx, configRequest("PUT", subject, body), &resp); err != nil {
+		return "", err
+	}
+	return resp.Compatibility, nil
+}
+
+// DeleteCompatibility removes the compatibility level of subject, it falls back on the global one
+func (c *Client) DeleteCompatibility(ctx context.Context, subject string) (Compatibility, e.IError) {
+	if len(subject) == 0 {
+		return "", e.NewCustomHTTPStatus(e.StatusBadRequest, "", "the global compatibility level can not be deleted")
+	}
+	var resp struct {
+		CompatibilityLevel Compatibility `json:"compatibilityLevel"`
+	}
+	if err := c.do(ctx, configRequest("DELETE", subject, nil), &resp); err != nil {
+		return "", err
+	}
+	return resp.CompatibilityLevel, nil
+}
+
+// DeleteSubject deletes the versions of subject and returns them, permanent deletes
+// the soft deleted subject for good, the registry refuses it for a subject not soft deleted
+func (c *Client) DeleteSubject(ctx context.Context, subject string, permanent bool) ([]int, e.IError) {
+	var versions []int
+	req := restclient.NewRequest("DELETE", "/subjects/%s", nil, url.PathEscape(subject))
+	if permanent {
+		req.WithQuery(url.Values{"permanent": {"true"}})
+	}
+	err := c.do(ctx, req, &versions)
+	c.evict(subject)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// DeleteSubjectVersion deletes a version of subject, see DeleteSubject for permanent
+func (c *Client) DeleteSubjectVersion(ctx context.Context, subject string, version int, permanent bool) (int, e.IError) {
+	var deleted int
+	req := restclient.NewRequest("DELETE", "/subjects/%s/versions/%s", nil, url.PathEscape(subject), versionParam(version))
+	if permanent {
+		req.WithQuery(url.Values{"permanent": {"true"}})
+	}
+	err := c.do(ctx, req, &deleted)
+	c.evict(subject)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// evict removes the subject from the cache, the schemas by ID are kept, they never change
+func (c *Client) evict(subject string) {
+	c.mu.Lock()
+	delete(c.ids, subject)
+	delete(c.metadata, subject)
+	delete(c.versions, subject)
+	c.mu.Unlock()
+}
+
+// do sends the request and converts the registry error responses
+func (c *Client) do(ctx context.Context, req *restclient.Api, response interface{}) e.IError {
+	result, err := c.rs.HandleRequestWithResult(req.WithContext(ctx), response)
+	if err == nil {
+		return nil
+	}
+	if result == nil || len(result.ErrorBody) == 0 {
+		return err
+	}
+	var failure restclient.RestError
+	if json.Unmarshal(result.ErrorBody, &failure) != nil || failure.Code == 0 {
+		return err
+	}
+	return &Error{IError: err, Code: failure.Code}
+}
+
+func configRequest(method, subject string, body interface{}) *restclient.Api {
+	if len(subject) == 0 {
+		return restclient.NewRequest(method, "/config", body)
+	}
+	return restclient.NewRequest(method, "/config/%s", body, url.PathEscape(subject))
+}
+
+func versionParam(version int) string {
+	if version == LatestVersion {
+		return "latest"
+	}
+	return strconv.Itoa(version)
+}
+
+// schemaKey identifies a schema in the cache
+func schemaKey(schema SchemaInfo) string {
+	key := string(schema.SchemaType) + "\x00" + schema.Schema
+	for _, ref := range schema.References {
+		key += fmt.Sprintf("\x00%s:%s:%d", ref.Name, ref.Subject, ref.Version)
+	}
+	return key
+}
+
+func setIn[K comparable, V any](m map[string]map[K]V, subject string, key K, value V) {
+	if m[subject] == nil {
+		m[subject] = map[K]V{}
+	}
+	m[subject][key] = value
+}
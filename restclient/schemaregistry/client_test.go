@@ -0,0 +1,170 @@
+package schemaregistry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"gitlab.com/grpasr/common/restclient"
+	"gitlab.com/grpasr/common/tests"
+)
+
+const (
+	userV1 = `{"type":"record","name":"User","fields":[{"name":"name","type":"string"}]}`
+	userV2 = `{"type":"record","name":"User","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":0}]}`
+	userV3 = `{"type":"record","name":"User","fields":[{"name":"name","type":"string"},{"name":"email","type":"string"}]}`
+)
+
+func newTestClient(t *testing.T) (*fakeRegistry, *Client) {
+	fr, srv := newFakeRegistry()
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(restclient.NewConfig(srv.URL))
+	tests.MaybeFail("new_client", err)
+	t.Cleanup(c.Close)
+	return fr, c
+}
+
+func Test_register_and_lookup_are_cached(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	fr, c := newTestClient(t)
+	ctx := context.Background()
+
+	id1, err := c.Register(ctx, "users-value", SchemaInfo{Schema: userV1}, false)
+	tests.MaybeFail("register_v1", err)
+	again, err := c.Register(ctx, "users-value", SchemaInfo{Schema: userV1}, false)
+	tests.MaybeFail("register_v1_again", err)
+	id2, err := c.Register(ctx, "users-value", SchemaInfo{Schema: userV2}, true)
+	tests.MaybeFail("register_v2", err)
+	shared, err := c.Register(ctx, "team/users", SchemaInfo{Schema: userV1}, false)
+	tests.MaybeFail("register_other_subject", err)
+
+	byID, err := c.GetByID(ctx, id2)
+	tests.MaybeFail("get_by_id", err)
+	md, err := c.LookupSchema(ctx, "users-value", SchemaInfo{Schema: userV2}, false)
+	tests.MaybeFail("lookup", err)
+	c.LookupSchema(ctx, "users-value", SchemaInfo{Schema: userV2}, false)
+	v1, err := c.GetBySubjectAndVersion(ctx, "users-value", 1)
+	tests.MaybeFail("get_version", err)
+	c.GetBySubjectAndVersion(ctx, "users-value", 1)
+	latest, err := c.GetLatest(ctx, "users-value")
+	tests.MaybeFail("get_latest", err)
+	_, unknown := c.GetByID(ctx, 42)
+
+	subjects, err := c.GetSubjects(ctx, false)
+	tests.MaybeFail("get_subjects", err)
+	versions, err := c.GetVersions(ctx, "team/users")
+	tests.MaybeFail("get_versions", err)
+
+	tests.MaybeFail("register_and_lookup_are_cached",
+		tests.Expect(id1, 1),
+		tests.Expect(again, 1),
+		tests.Expect(id2, 2),
+		tests.Expect(shared, 1),
+		// the registrations of a cached schema and the second lookup are not sent
+		tests.Expect(fr.count("POST subjects"), 4),
+		tests.Expect(byID.Schema, userV2),
+		// only the unknown ID is sent, the registered schemas are cached
+		tests.Expect(fr.count("GET schemas"), 1),
+		tests.Expect(*md, SchemaMetadata{SchemaInfo: SchemaInfo{Schema: userV2}, ID: 2, Subject: "users-value", Version: 2}),
+		tests.Expect(v1.ID, 1),
+		tests.Expect(latest.Version, 2),
+		// version 1, latest, the subjects and the versions, the second read of version 1 is cached
+		tests.Expect(fr.count("GET subjects"), 4),
+		tests.Expect(ErrorCode(unknown), ErrCodeSchemaNotFound),
+		tests.Expect(subjects, []string{"team/users", "users-value"}),
+		tests.Expect(versions, []int{1}))
+}
+
+func Test_registry_errors_and_compatibility(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := c.Register(ctx, "users-value", SchemaInfo{Schema: userV1}, false)
+	tests.MaybeFail("register_v1", err)
+
+	_, invalid := c.Register(ctx, "users-value", SchemaInfo{Schema: "{not json"}, false)
+	_, incompatible := c.Register(ctx, "users-value", SchemaInfo{Schema: userV3}, false)
+	_, notFound := c.GetLatest(ctx, "orders-value")
+
+	compatible, _, err := c.TestCompatibility(ctx, "users-value", LatestVersion, SchemaInfo{Schema: userV2})
+	tests.MaybeFail("test_compatibility_v2", err)
+	notCompatible, messages, err := c.TestCompatibility(ctx, "users-value", 1, SchemaInfo{Schema: userV3})
+	tests.MaybeFail("test_compatibility_v3", err)
+
+	global, err := c.GetCompatibility(ctx, "", false)
+	tests.MaybeFail("get_global", err)
+	_, unset := c.GetCompatibility(ctx, "users-value", false)
+	fallback, err := c.GetCompatibility(ctx, "users-value", true)
+	tests.MaybeFail("get_default_to_global", err)
+	updated, err := c.UpdateCompatibility(ctx, "users-value", None)
+	tests.MaybeFail("update_subject", err)
+	id3, err := c.Register(ctx, "users-value", SchemaInfo{Schema: userV3}, false)
+	tests.MaybeFail("register_v3_without_compatibility", err)
+	_, badLevel := c.UpdateCompatibility(ctx, "", "SIDEWAYS")
+	removed, err := c.DeleteCompatibility(ctx, "users-value")
+	tests.MaybeFail("delete_subject_config", err)
+
+	tests.MaybeFail("registry_errors_and_compatibility",
+		tests.Expect(ErrorCode(invalid), ErrCodeInvalidSchema),
+		tests.Expect(invalid.GetCode(), 422),
+		tests.Expect(ErrorCode(incompatible), ErrCodeIncompatibleSchema),
+		tests.Expect(incompatible.GetCode(), http.StatusConflict),
+		tests.Expect(ErrorCode(notFound), ErrCodeSubjectNotFound),
+		tests.Expect(notFound.GetCode(), http.StatusNotFound),
+		tests.Expect(compatible, true),
+		tests.Expect(notCompatible, false),
+		tests.Expect(messages, []string{"READER_FIELD_MISSING_DEFAULT_VALUE: email"}),
+		tests.Expect(global, Backward),
+		tests.Expect(ErrorCode(unset), ErrCodeSubjectConfigNotFound),
+		tests.Expect(fallback, Backward),
+		tests.Expect(updated, None),
+		tests.Expect(id3, 2),
+		tests.Expect(ErrorCode(badLevel), ErrCodeInvalidCompatibility),
+		tests.Expect(removed, None))
+}
+
+func Test_soft_and_hard_delete(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	c.Register(ctx, "users-value", SchemaInfo{Schema: userV1}, false)
+	c.Register(ctx, "users-value", SchemaInfo{Schema: userV2}, false)
+	c.Register(ctx, "orders-value", SchemaInfo{Schema: userV1}, false)
+
+	_, notSoftDeleted := c.DeleteSubjectVersion(ctx, "users-value", 2, true)
+	deletedVersion, err := c.DeleteSubjectVersion(ctx, "users-value", 2, false)
+	tests.MaybeFail("soft_delete_version", err)
+	latest, err := c.GetLatest(ctx, "users-value")
+	tests.MaybeFail("latest_after_version_delete", err)
+	hardVersion, err := c.DeleteSubjectVersion(ctx, "users-value", 2, true)
+	tests.MaybeFail("hard_delete_version", err)
+
+	_, mustSoftDelete := c.DeleteSubject(ctx, "orders-value", true)
+	softDeleted, err := c.DeleteSubject(ctx, "orders-value", false)
+	tests.MaybeFail("soft_delete_subject", err)
+	live, _ := c.GetSubjects(ctx, false)
+	withDeleted, _ := c.GetSubjects(ctx, true)
+	_, cachedVersion := c.GetBySubjectAndVersion(ctx, "orders-value", 1)
+	hardDeleted, err := c.DeleteSubject(ctx, "orders-value", true)
+	tests.MaybeFail("hard_delete_subject", err)
+	afterHard, _ := c.GetSubjects(ctx, true)
+	stillByID, err := c.GetByID(ctx, 1)
+	tests.MaybeFail("schema_by_id_after_delete", err)
+
+	tests.MaybeFail("soft_and_hard_delete",
+		tests.Expect(ErrorCode(notSoftDeleted), ErrCodeVersionNotSoftDeleted),
+		tests.Expect(deletedVersion, 2),
+		tests.Expect(latest.Version, 1),
+		tests.Expect(hardVersion, 2),
+		tests.Expect(ErrorCode(mustSoftDelete), ErrCodeSubjectNotSoftDeleted),
+		tests.Expect(softDeleted, []int{1}),
+		tests.Expect(live, []string{"users-value"}),
+		tests.Expect(withDeleted, []string{"orders-value", "users-value"}),
+		tests.Expect(ErrorCode(cachedVersion), ErrCodeSubjectNotFound),
+		tests.Expect(hardDeleted, []int{1}),
+		tests.Expect(afterHard, []string{"users-value"}),
+		tests.Expect(stillByID.Schema, userV1))
+}
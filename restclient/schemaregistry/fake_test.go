@@ -0,0 +1,364 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeRegistry is an in-process Schema Registry keeping the schemas in memory,
+// its compatibility check only knows the Avro records: with BACKWARD, a field
+// added by the new schema needs a default
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []SchemaInfo // by ID - 1
+	subjects map[string][]*fakeVersion
+	deleted  map[string]bool
+	global   Compatibility
+	configs  map[string]Compatibility
+	requests map[string]int
+}
+
+type fakeVersion struct {
+	id      int
+	version int
+	deleted bool
+}
+
+func newFakeRegistry() (*fakeRegistry, *httptest.Server) {
+	fr := &fakeRegistry{
+		subjects: map[string][]*fakeVersion{},
+		deleted:  map[string]bool{},
+		global:   Backward,
+		configs:  map[string]Compatibility{},
+		requests: map[string]int{},
+	}
+	return fr, httptest.NewServer(fr)
+}
+
+func (fr *fakeRegistry) count(key string) int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.requests[key]
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+	fr.requests[r.Method+" "+parts[0]]++
+
+	var body SchemaInfo
+	if r.Body != nil && r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		fr.register(w, parts[1], body)
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "subjects":
+		fr.lookup(w, parts[1], body)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, _ := strconv.Atoi(parts[2])
+		if id < 1 || id > len(fr.schemas) {
+			fr.fail(w, ErrCodeSchemaNotFound, "Schema not found")
+			return
+		}
+		fr.reply(w, fr.schemas[id-1])
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "subjects":
+		subjects := []string{}
+		for s := range fr.subjects {
+			if len(fr.live(s, q.Get("deleted") == "true")) > 0 {
+				subjects = append(subjects, s)
+			}
+		}
+		sort.Strings(subjects)
+		fr.reply(w, subjects)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		live := fr.live(parts[1], false)
+		if len(live) == 0 {
+			fr.fail(w, ErrCodeSubjectNotFound, "Subject not found")
+			return
+		}
+		versions := []int{}
+		for _, v := range live {
+			versions = append(versions, v.version)
+		}
+		fr.reply(w, versions)
+	case r.Method == "GET" && len(parts) == 4 && parts[0] == "subjects" && parts[2] == "versions":
+		v, code := fr.version(parts[1], parts[3])
+		if code != 0 {
+			fr.fail(w, code, "Version not found")
+			return
+		}
+		fr.reply(w, fr.metadata(parts[1], v))
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "subjects":
+		fr.deleteSubject(w, parts[1], q.Get("permanent") == "true")
+	case r.Method == "DELETE" && len(parts) == 4 && parts[0] == "subjects" && parts[2] == "versions":
+		fr.deleteVersion(w, parts[1], parts[3], q.Get("permanent") == "true")
+	case r.Method == "POST" && len(parts) == 5 && parts[0] == "compatibility":
+		v, code := fr.version(parts[2], parts[4])
+		if code != 0 {
+			fr.fail(w, code, "Version not found")
+			return
+		}
+		messages := fr.incompatibilities(fr.level(parts[2]), fr.schemas[v.id-1], body)
+		fr.reply(w, map[string]interface{}{"is_compatible": len(messages) == 0, "messages": messages})
+	case parts[0] == "config":
+		fr.config(w, r, parts)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (fr *fakeRegistry) register(w http.ResponseWriter, subject string, schema SchemaInfo) {
+	if !json.Valid([]byte(schema.Schema)) && schema.SchemaType != Protobuf {
+		fr.fail(w, ErrCodeInvalidSchema, "Invalid schema")
+		return
+	}
+	live := fr.live(subject, false)
+	for _, v := range live {
+		if fr.same(fr.schemas[v.id-1], schema) {
+			fr.reply(w, map[string]int{"id": v.id})
+			return
+		}
+	}
+	if len(live) > 0 {
+		latest := fr.schemas[live[len(live)-1].id-1]
+		if messages := fr.incompatibilities(fr.level(subject), latest, schema); len(messages) > 0 {
+			fr.fail(w, ErrCodeIncompatibleSchema, "Schema being registered is incompatible with an earlier schema")
+			return
+		}
+	}
+
+	id := 0
+	for i, s := range fr.schemas {
+		if fr.same(s, schema) {
+			id = i + 1
+		}
+	}
+	if id == 0 {
+		fr.schemas = append(fr.schemas, schema)
+		id = len(fr.schemas)
+	}
+	all := fr.subjects[subject]
+	version := 1
+	if len(all) > 0 {
+		version = all[len(all)-1].version + 1
+	}
+	fr.subjects[subject] = append(all, &fakeVersion{id: id, version: version})
+	delete(fr.deleted, subject)
+	fr.reply(w, map[string]int{"id": id})
+}
+
+func (fr *fakeRegistry) lookup(w http.ResponseWriter, subject string, schema SchemaInfo) {
+	live := fr.live(subject, false)
+	if len(live) == 0 {
+		fr.fail(w, ErrCodeSubjectNotFound, "Subject not found")
+		return
+	}
+	for _, v := range live {
+		if fr.same(fr.schemas[v.id-1], schema) {
+			fr.reply(w, fr.metadata(subject, v))
+			return
+		}
+	}
+	fr.fail(w, ErrCodeSchemaNotFound, "Schema not found")
+}
+
+func (fr *fakeRegistry) deleteSubject(w http.ResponseWriter, subject string, permanent bool) {
+	all := fr.subjects[subject]
+	if len(all) == 0 {
+		fr.fail(w, ErrCodeSubjectNotFound, "Subject not found")
+		return
+	}
+	if permanent && !fr.deleted[subject] {
+		fr.fail(w, ErrCodeSubjectNotSoftDeleted, "Subject was not deleted first before being permanently deleted")
+		return
+	}
+	if !permanent && fr.deleted[subject] {
+		fr.fail(w, ErrCodeSubjectSoftDeleted, "Subject was soft deleted")
+		return
+	}
+	versions := []int{}
+	for _, v := range all {
+		versions = append(versions, v.version)
+		v.deleted = true
+	}
+	if permanent {
+		delete(fr.subjects, subject)
+		delete(fr.deleted, subject)
+	} else {
+		fr.deleted[subject] = true
+	}
+	fr.reply(w, versions)
+}
+
+func (fr *fakeRegistry) deleteVersion(w http.ResponseWriter, subject, version string, permanent bool) {
+	all := fr.subjects[subject]
+	for i, v := range all {
+		if strconv.Itoa(v.version) != version && !(version == "latest" && i == len(all)-1) {
+			continue
+		}
+		switch {
+		case permanent && !v.deleted:
+			fr.fail(w, ErrCodeVersionNotSoftDeleted, "Version not deleted first before being permanently deleted")
+		case permanent:
+			fr.subjects[subject] = append(all[:i:i], all[i+1:]...)
+			fr.reply(w, v.version)
+		case v.deleted:
+			fr.fail(w, ErrCodeVersionSoftDeleted, "Version was soft deleted")
+		default:
+			v.deleted = true
+			fr.reply(w, v.version)
+		}
+		return
+	}
+	fr.fail(w, ErrCodeVersionNotFound, "Version not found")
+}
+
+func (fr *fakeRegistry) config(w http.ResponseWriter, r *http.Request, parts []string) {
+	subject := ""
+	if len(parts) > 1 {
+		subject = parts[1]
+	}
+	switch r.Method {
+	case "GET":
+		level, ok := fr.configs[subject]
+		switch {
+		case len(subject) == 0:
+			level = fr.global
+		case !ok && r.URL.Query().Get("defaultToGlobal") == "true":
+			level = fr.global
+		case !ok:
+			fr.fail(w, ErrCodeSubjectConfigNotFound, "Subject level compatibility not configured")
+			return
+		}
+		fr.reply(w, map[string]Compatibility{"compatibilityLevel": level})
+	case "PUT":
+		var body map[string]Compatibility
+		json.NewDecoder(r.Body).Decode(&body)
+		level := body["compatibility"]
+		switch level {
+		case None, Backward, BackwardTransitive, Forward, ForwardTransitive, Full, FullTransitive:
+		default:
+			fr.fail(w, ErrCodeInvalidCompatibility, "Invalid compatibility level")
+			return
+		}
+		if len(subject) == 0 {
+			fr.global = level
+		} else {
+			fr.configs[subject] = level
+		}
+		fr.reply(w, map[string]Compatibility{"compatibility": level})
+	case "DELETE":
+		level, ok := fr.configs[subject]
+		if !ok {
+			fr.fail(w, ErrCodeSubjectConfigNotFound, "Subject level compatibility not configured")
+			return
+		}
+		delete(fr.configs, subject)
+		fr.reply(w, map[string]Compatibility{"compatibilityLevel": level})
+	}
+}
+
+// live returns the versions of subject, the soft deleted ones only with deleted
+func (fr *fakeRegistry) live(subject string, deleted bool) []*fakeVersion {
+	var live []*fakeVersion
+	for _, v := range fr.subjects[subject] {
+		if deleted || !v.deleted {
+			live = append(live, v)
+		}
+	}
+	return live
+}
+
+func (fr *fakeRegistry) version(subject, version string) (*fakeVersion, int) {
+	live := fr.live(subject, false)
+	if len(live) == 0 {
+		return nil, ErrCodeSubjectNotFound
+	}
+	if version == "latest" {
+		return live[len(live)-1], 0
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return nil, ErrCodeInvalidVersion
+	}
+	for _, v := range live {
+		if v.version == n {
+			return v, 0
+		}
+	}
+	return nil, ErrCodeVersionNotFound
+}
+
+func (fr *fakeRegistry) metadata(subject string, v *fakeVersion) SchemaMetadata {
+	return SchemaMetadata{SchemaInfo: fr.schemas[v.id-1], ID: v.id, Subject: subject, Version: v.version}
+}
+
+func (fr *fakeRegistry) level(subject string) Compatibility {
+	if level, ok := fr.configs[subject]; ok {
+		return level
+	}
+	return fr.global
+}
+
+func (fr *fakeRegistry) same(a, b SchemaInfo) bool {
+	typeOf := func(s SchemaInfo) SchemaType {
+		if len(s.SchemaType) == 0 {
+			return Avro
+		}
+		return s.SchemaType
+	}
+	return a.Schema == b.Schema && typeOf(a) == typeOf(b)
+}
+
+// incompatibilities checks the Avro record fields added by the new schema have a default
+func (fr *fakeRegistry) incompatibilities(level Compatibility, old, new SchemaInfo) []string {
+	if level == None {
+		return nil
+	}
+	type record struct {
+		Fields []struct {
+			Name    string           `json:"name"`
+			Default *json.RawMessage `json:"default"`
+		} `json:"fields"`
+	}
+	var o, n record
+	json.Unmarshal([]byte(old.Schema), &o)
+	json.Unmarshal([]byte(new.Schema), &n)
+	known := map[string]bool{}
+	for _, f := range o.Fields {
+		known[f.Name] = true
+	}
+	var messages []string
+	for _, f := range n.Fields {
+		if !known[f.Name] && f.Default == nil {
+			messages = append(messages, fmt.Sprintf("READER_FIELD_MISSING_DEFAULT_VALUE: %s", f.Name))
+		}
+	}
+	return messages
+}
+
+func (fr *fakeRegistry) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", MediaTypeSchemaRegistry)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (fr *fakeRegistry) fail(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", MediaTypeSchemaRegistry)
+	w.WriteHeader(code / 100)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error_code": code, "message": message})
+}
@@ -0,0 +1,451 @@
+package restclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	e "gitlab.com/grpasr/common/errors/json"
+)
+
+const (
+	MediaTypeEventStream = "text/event-stream"
+	MediaTypeNDJSON      = "application/x-ndjson"
+
+	lastEventIDHeader     = "Last-Event-ID"
+	defaultMaxEventSize   = 1 << 20
+	defaultReconnectDelay = 3 * time.Second
+)
+
+// StreamConfig configures the consumption of a stream
+type StreamConfig struct {
+	// MaxEventSize is the maximum size of an event or a line, default to 1MiB
+	MaxEventSize int
+	// ReconnectDelay is the SSE reconnection delay until the server sends a retry field
+	ReconnectDelay time.Duration
+	// MaxReconnects limits the consecutive SSE reconnections without event, 0 disables them
+	MaxReconnects int
+}
+
+func NewStreamConfig() StreamConfig {
+	return StreamConfig{
+		MaxEventSize:   defaultMaxEventSize,
+		ReconnectDelay: defaultReconnectDelay,
+		MaxReconnects:  5,
+	}
+}
+
+// Event is a Server-Sent Event
+type Event struct {
+	ID    string
+	Event string
+	Data  []byte
+	// Retry is the reconnection delay requested by the server, 0 if none
+	Retry time.Duration
+}
+
+// Streamer opens the streamed responses, the restService implements it
+type Streamer interface {
+	OpenStream(request *Api) (*http.Response, e.IError)
+}
+
+var _ Streamer = (*restService)(nil)
+
+// Stream iterates over the items of a text/event-stream or application/x-ndjson response,
+// the items are read from the connection on demand so a slow consumer slows the server down
+//
+//	stream := NewSSEStream[Progress](rs, NewRequest("GET", "/jobs/%s/progress", nil, id), NewStreamConfig())
+//	defer stream.Close()
+//	for stream.Next(ctx) {
+//		progress := stream.Item()
+//	}
+//	if err := stream.Err(); err != nil {
+type Stream[T any] struct {
+	rs      Streamer
+	request *Api
+	conf    StreamConfig
+	sse     bool
+
+	resp    *http.Response
+	scanner *bufio.Scanner
+
+	current     T
+	event       *Event
+	lastEventID string
+	// idBuffer is the id of the event being parsed, committed to lastEventID when it is dispatched
+	idBuffer   string
+	reconnects int
+	// connected tells the stream was opened once, the SSE connection failures are retried from then on
+	connected bool
+	closed    bool
+	err       e.IError
+}
+
+// NewSSEStream returns a stream of the events data, decoded from JSON unless T is string or []byte,
+// the connection is established again on failure, with the Last-Event-ID header
+func NewSSEStream[T any](rs Streamer, request *Api, conf StreamConfig) *Stream[T] {
+	return newStream[T](rs, request, conf, true)
+}
+
+// NewNDJSONStream returns a stream of the JSON lines
+func NewNDJSONStream[T any](rs Streamer, request *Api, conf StreamConfig) *Stream[T] {
+	return newStream[T](rs, request, conf, false)
+}
+
+func newStream[T any](rs Streamer, request *Api, conf StreamConfig, sse bool) *Stream[T] {
+	if conf.MaxEventSize <= 0 {
+		conf.MaxEventSize = defaultMaxEventSize
+	}
+	if conf.ReconnectDelay <= 0 {
+		conf.ReconnectDelay = defaultReconnectDelay
+	}
+	req := *request
+	if len(req.accept) == 0 {
+		req.accept = MediaTypeNDJSON
+		if sse {
+			req.accept = MediaTypeEventStream
+		}
+	}
+	return &Stream[T]{rs: rs, request: &req, conf: conf, sse: sse}
+}
+
+// Item returns the current item
+func (s *Stream[T]) Item() T {
+	return s.current
+}
+
+// Event returns the current Server-Sent Event, nil for the NDJSON streams
+func (s *Stream[T]) Event() *Event {
+	return s.event
+}
+
+// LastEventID returns the id of the latest Server-Sent Event received
+func (s *Stream[T]) LastEventID() string {
+	return s.lastEventID
+}
+
+// Err returns the error which stopped the stream
+func (s *Stream[T]) Err() e.IError {
+	return s.err
+}
+
+// Close releases the connection, Next returns false afterward
+func (s *Stream[T]) Close() {
+	s.closed = true
+	s.disconnect()
+}
+
+// Next reads the next item, it returns false at the end of the stream, on error,
+// once ctx is done or the stream is closed
+func (s *Stream[T]) Next(ctx context.Context) bool {
+	for !s.closed && s.err == nil {
+		if err := ctx.Err(); err != nil {
+			s.fail(e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable))
+			return false
+		}
+
+		if s.resp == nil {
+			if err := s.connect(ctx); err != nil {
+				if !s.canReconnect(ctx, err) {
+					s.fail(err)
+					return false
+				}
+				if !s.wait(ctx) {
+					if s.err == nil {
+						s.fail(err)
+					}
+					return false
+				}
+				continue
+			}
+			if s.closed {
+				return false
+			}
+		}
+
+		ok, err := s.read(ctx)
+		if ok {
+			return true
+		}
+		s.disconnect()
+		if s.err != nil {
+			return false
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		if !s.sse {
+			if err != nil {
+				s.fail(e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError))
+			}
+			return false
+		}
+		if !s.wait(ctx) {
+			return false
+		}
+	}
+	return false
+}
+
+// canReconnect tells whether the connection failure err is retried as a read failure is,
+// that is for a SSE stream already connected once, unless the server refused the request with a 4xx
+func (s *Stream[T]) canReconnect(ctx context.Context, err e.IError) bool {
+	return s.sse && s.connected && ctx.Err() == nil && err.GetCode() >= 500
+}
+
+// connect opens the stream, sending the Last-Event-ID of the events already received,
+// the stream is closed without error when the server ends it with 204 No Content
+func (s *Stream[T]) connect(ctx context.Context) e.IError {
+	req := *s.request
+	req.ctx = ctx
+	if len(s.lastEventID) > 0 {
+		req.header = req.header.Clone()
+		if req.header == nil {
+			req.header = http.Header{}
+		}
+		req.header.Set(lastEventIDHeader, s.lastEventID)
+	}
+
+	resp, err := s.rs.OpenStream(&req)
+	if err != nil {
+		return err
+	}
+	// the server ends a SSE stream with 204 No Content
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		s.closed = true
+		return nil
+	}
+
+	s.connected = true
+	s.resp = resp
+	s.idBuffer = s.lastEventID
+	s.scanner = bufio.NewScanner(resp.Body)
+	s.scanner.Buffer(make([]byte, 0, 4096), s.conf.MaxEventSize)
+	s.scanner.Split(scanLines)
+	return nil
+}
+
+func (s *Stream[T]) disconnect() {
+	if s.resp != nil {
+		s.resp.Body.Close()
+		s.resp = nil
+	}
+}
+
+// wait sleeps the reconnection delay, it returns false when no reconnection is allowed
+func (s *Stream[T]) wait(ctx context.Context) bool {
+	if s.reconnects >= s.conf.MaxReconnects {
+		return false
+	}
+	s.reconnects++
+
+	timer := time.NewTimer(s.conf.ReconnectDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		s.fail(e.WrapHTTPStatusContext(ctx, ctx.Err(), e.StatusServiceUnavailable))
+		return false
+	}
+}
+
+func (s *Stream[T]) fail(err e.IError) {
+	s.err = err
+	s.disconnect()
+}
+
+// read reads the next item from the connection, the body is closed if ctx
+// is done while blocked so the read returns
+func (s *Stream[T]) read(ctx context.Context) (bool, error) {
+	body := s.resp.Body
+	stop := context.AfterFunc(ctx, func() {
+		body.Close()
+	})
+	defer stop()
+
+	if s.sse {
+		return s.readEvent(ctx)
+	}
+	return s.readLine(ctx)
+}
+
+func (s *Stream[T]) readLine(ctx context.Context) (bool, error) {
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item T
+		if err := decodeStreamItem(line, &item); err != nil {
+			s.fail(e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError))
+			return false, nil
+		}
+		s.current = item
+		return true, nil
+	}
+	return false, s.scanner.Err()
+}
+
+// readEvent parses the event stream as specified by the HTML Living Standard, section 9.2
+func (s *Stream[T]) readEvent(ctx context.Context) (bool, error) {
+	ev := &Event{}
+	var data bytes.Buffer
+	hasData := false
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if len(line) == 0 {
+			s.lastEventID = s.idBuffer
+			if !hasData {
+				ev = &Event{}
+				continue
+			}
+			ev.Data = bytes.TrimSuffix(data.Bytes(), []byte("\n"))
+			if len(ev.Event) == 0 {
+				ev.Event = "message"
+			}
+			ev.ID = s.lastEventID
+
+			var item T
+			if err := decodeStreamItem(ev.Data, &item); err != nil {
+				s.fail(e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError))
+				return false, nil
+			}
+			s.current, s.event = item, ev
+			s.reconnects = 0
+			return true, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.idBuffer = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+				s.conf.ReconnectDelay = ev.Retry
+			}
+		}
+	}
+	// an incomplete event at the end of the stream is discarded
+	return false, s.scanner.Err()
+}
+
+// decodeStreamItem decodes the JSON items, string and []byte receive the raw data
+func decodeStreamItem(data []byte, item interface{}) error {
+	switch v := item.(type) {
+	case *string:
+		*v = string(data)
+		return nil
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+		return nil
+	}
+	return json.Unmarshal(data, item)
+}
+
+// scanLines splits on \n, \r\n and \r
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				// a \n may follow
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// OpenStream sends the request through the interceptors and returns the response
+// once its headers are received, the body is left to the caller
+func (rs *restService) OpenStream(request *Api) (*http.Response, e.IError) {
+	ex, err := rs.prepare(request, nil, rs.idempotencyKey(request))
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.intercept(ex, rs.sendStream); err != nil {
+		return nil, err
+	}
+	if ex.stream == nil {
+		return nil, e.NewCustomHTTPStatusContext(request.context(), e.StatusInternalServerError, "", "the stream was not opened")
+	}
+	return ex.stream, nil
+}
+
+// sendStream is the innermost handler of the streams, the span ends once the response headers are received
+func (rs *restService) sendStream(ex *Exchange) e.IError {
+	call, req := rs.instr.start(ex.Api, ex.Request)
+	ctx := req.Context()
+	call.requestSize = int64(len(ex.reqBody))
+
+	// the client timeout would cut the long lived streams
+	client := *rs.Client
+	client.Timeout = 0
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		call.end(err)
+		ex.Result.Timings = call.timings
+		rs.logger.log(req.Context(), &exchange{req: req, auth: rs.authenticator(ex.Api), reqBody: ex.reqBody, elapsed: time.Since(start), timings: call.timings, err: err})
+		return e.WrapHTTPStatusContext(ctx, err, e.StatusServiceUnavailable)
+	}
+	call.statusCode = resp.StatusCode
+	call.end(nil)
+	ex.Result.Timings = call.timings
+	rs.logger.log(req.Context(), &exchange{
+		req:         req,
+		auth:        rs.authenticator(ex.Api),
+		reqBody:     ex.reqBody,
+		statusCode:  resp.StatusCode,
+		respHeader:  resp.Header,
+		elapsed:     time.Since(start),
+		timings:     call.timings,
+		skipRespLog: true,
+	})
+	ex.Result.StatusCode, ex.Result.Header = resp.StatusCode, resp.Header
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, defaultMaxEventSize))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return e.WrapHTTPStatusContext(ctx, err, e.StatusInternalServerError)
+		}
+		return rs.decodeResponse(ctx, resp.StatusCode, resp.Header, body, nil, ex.Result, ex.accept, ex.contentType)
+	}
+
+	ex.stream = resp
+	return nil
+}
@@ -0,0 +1,171 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func Test_sse_stream_reconnects_with_last_event_id(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var lastEventIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		switch len(lastEventIDs) {
+		case 1:
+			w.Header().Set("Content-Type", MediaTypeEventStream)
+			fmt.Fprint(w, "retry: 10\r\n: keep-alive\r\n\r\n")
+			fmt.Fprint(w, "id: 1\nevent: progress\ndata: {\"name\":\"step\",\ndata: \"count\":1}\n\n")
+			fmt.Fprint(w, "id: 2\ndata: {\"name\":\"step\",\"count\":2}\n\n")
+			fmt.Fprint(w, "id: 3\ndata: {\"name\":\"incomplete\"")
+		case 2:
+			w.Header().Set("Content-Type", MediaTypeEventStream)
+			fmt.Fprint(w, "data: {\"name\":\"done\",\"count\":3}\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	stream := NewSSEStream[codecItem](rs, NewRequest("GET", "/jobs/1/progress", nil), NewStreamConfig())
+	defer stream.Close()
+
+	var items []codecItem
+	var events []string
+	for stream.Next(context.Background()) {
+		items = append(items, stream.Item())
+		events = append(events, stream.Event().Event+"#"+stream.Event().ID)
+	}
+
+	tests.MaybeFail("sse_stream_reconnects_with_last_event_id",
+		tests.Expect(stream.Err(), nil),
+		tests.Expect(items, []codecItem{{"step", 1}, {"step", 2}, {"done", 3}}),
+		tests.Expect(events, []string{"progress#1", "message#2", "message#2"}),
+		tests.Expect(lastEventIDs, []string{"", "2", "2"}))
+}
+
+func Test_sse_stream_reconnects_after_a_refused_connection(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var lastEventIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		switch len(lastEventIDs) {
+		case 1:
+			w.Header().Set("Content-Type", MediaTypeEventStream)
+			fmt.Fprint(w, "retry: 10\nid: 1\ndata: {\"name\":\"step\",\"count\":1}\n\n")
+		case 2:
+			// the server restarts after the stream was dropped, the first reconnection is refused
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			w.Header().Set("Content-Type", MediaTypeEventStream)
+			fmt.Fprint(w, "id: 2\ndata: {\"name\":\"done\",\"count\":2}\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	stream := NewSSEStream[codecItem](rs, NewRequest("GET", "/jobs/1/progress", nil), NewStreamConfig())
+	defer stream.Close()
+
+	var items []codecItem
+	for stream.Next(context.Background()) {
+		items = append(items, stream.Item())
+	}
+
+	// the refused connections use the reconnection budget, they do not end the stream
+	conf := NewStreamConfig()
+	conf.MaxReconnects = 1
+	conf.ReconnectDelay = 10 * time.Millisecond
+	lastEventIDs = nil
+	exhausted := NewSSEStream[codecItem](rs, NewRequest("GET", "/jobs/1/progress", nil), conf)
+	defer exhausted.Close()
+	var exhaustedItems []codecItem
+	for exhausted.Next(context.Background()) {
+		exhaustedItems = append(exhaustedItems, exhausted.Item())
+	}
+
+	tests.MaybeFail("sse_stream_reconnects_after_a_refused_connection",
+		tests.Expect(stream.Err(), nil),
+		tests.Expect(items, []codecItem{{"step", 1}, {"done", 2}}),
+		tests.Expect(exhaustedItems, []codecItem{{"step", 1}}),
+		tests.Expect(exhausted.Err().GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(lastEventIDs, []string{"", "1"}))
+}
+
+func Test_ndjson_stream_and_cancellation(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeNDJSON)
+		fmt.Fprint(w, "{\"name\":\"a\",\"count\":1}\n\n{\"name\":\"b\",\"count\":2}\n")
+		if r.URL.Path == "/follow" {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	all := NewNDJSONStream[codecItem](rs, NewRequest("GET", "/items", nil), StreamConfig{})
+	var items []codecItem
+	for all.Next(context.Background()) {
+		items = append(items, all.Item())
+	}
+
+	raw := NewNDJSONStream[string](rs, NewRequest("GET", "/items", nil), StreamConfig{})
+	raw.Next(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	follow := NewNDJSONStream[codecItem](rs, NewRequest("GET", "/follow", nil), StreamConfig{})
+	received := 0
+	start := time.Now()
+	for follow.Next(ctx) {
+		received++
+	}
+
+	tests.MaybeFail("ndjson_stream_and_cancellation",
+		tests.Expect(all.Err(), nil),
+		tests.Expect(items, []codecItem{{"a", 1}, {"b", 2}}),
+		tests.Expect(raw.Item(), `{"name":"a","count":1}`),
+		tests.Expect(received, 2),
+		tests.Expect(time.Since(start) < time.Second, true),
+		tests.Expect(follow.Err().GetCode(), http.StatusServiceUnavailable))
+}
+
+func Test_stream_error_status(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_code":404,"message":"job not found"}`))
+	}))
+	defer srv.Close()
+
+	rs, err := NewRestService(NewConfig(srv.URL), MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+
+	stream := NewSSEStream[codecItem](rs, NewRequest("GET", "/jobs/2/progress", nil), NewStreamConfig())
+	next := stream.Next(context.Background())
+
+	tests.MaybeFail("stream_error_status",
+		tests.Expect(next, false),
+		tests.Expect(stream.Err().GetCode(), http.StatusNotFound))
+}
@@ -0,0 +1,125 @@
+package restclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	phaseKey      = attribute.Key("http.phase")
+	connReusedKey = attribute.Key("http.connection.reused")
+)
+
+// Timings is the breakdown of a request, the phases which did not happen,
+// like DNS and Connect on a reused connection, are zero
+type Timings struct {
+	// DNS is the host lookup duration
+	DNS time.Duration
+	// Connect is the TCP connection duration
+	Connect time.Duration
+	// TLSHandshake is the TLS handshake duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte runs from the connection obtained to the first response byte, the server time
+	TimeToFirstByte time.Duration
+	// Total runs from the request start to the end of the response reading
+	Total time.Duration
+	// ConnReused tells if the connection came from the pool
+	ConnReused bool
+}
+
+// phaseTimer collects the httptrace hooks, they can run concurrently
+// when several addresses are dialed
+type phaseTimer struct {
+	mu                               sync.Mutex
+	start                            time.Time
+	dnsStart, dnsDone                time.Time
+	connectStart, connectDone        time.Time
+	tlsStart, tlsDone                time.Time
+	gotConn, wroteRequest, firstByte time.Time
+	reused                           bool
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{start: time.Now()}
+}
+
+// withClientTrace returns ctx carrying the hooks
+func (pt *phaseTimer) withClientTrace(ctx context.Context) context.Context {
+	set := func(t *time.Time) {
+		pt.mu.Lock()
+		if t.IsZero() {
+			*t = time.Now()
+		}
+		pt.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { set(&pt.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { set(&pt.dnsDone) },
+		ConnectStart:      func(string, string) { set(&pt.connectStart) },
+		ConnectDone:       func(string, string, error) { set(&pt.connectDone) },
+		TLSHandshakeStart: func() { set(&pt.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&pt.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			pt.mu.Lock()
+			pt.reused = info.Reused
+			pt.mu.Unlock()
+			set(&pt.gotConn)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&pt.wroteRequest) },
+		GotFirstResponseByte: func() { set(&pt.firstByte) },
+	})
+}
+
+// timings returns the breakdown, measured until now
+func (pt *phaseTimer) timings() *Timings {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return &Timings{
+		DNS:             between(pt.dnsStart, pt.dnsDone),
+		Connect:         between(pt.connectStart, pt.connectDone),
+		TLSHandshake:    between(pt.tlsStart, pt.tlsDone),
+		TimeToFirstByte: between(pt.gotConn, pt.firstByte),
+		Total:           time.Since(pt.start),
+		ConnReused:      pt.reused,
+	}
+}
+
+// addSpanEvents adds an event per phase, at the phase end
+func (pt *phaseTimer) addSpanEvents(span trace.Span, t *Timings) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	for _, p := range []struct {
+		name     string
+		end      time.Time
+		duration time.Duration
+	}{
+		{"dns", pt.dnsDone, t.DNS},
+		{"connect", pt.connectDone, t.Connect},
+		{"tls", pt.tlsDone, t.TLSHandshake},
+		{"first_byte", pt.firstByte, t.TimeToFirstByte},
+	} {
+		if p.end.IsZero() {
+			continue
+		}
+		span.AddEvent("http."+p.name, trace.WithTimestamp(p.end), trace.WithAttributes(
+			attribute.Float64("duration_ms", durationMs(p.duration))))
+	}
+	span.SetAttributes(connReusedKey.Bool(t.ConnReused))
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,254 @@
+package restclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsReloader keeps the client certificate and the CA bundle up to date with their files,
+// new connections use the current ones
+type tlsReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	roots  *x509.CertPool
+	stamps map[string]fileStamp
+
+	cancel context.CancelFunc
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newTLSReloader(certFile, keyFile, caFile string) *tlsReloader {
+	return &tlsReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		stamps:   make(map[string]fileStamp),
+	}
+}
+
+// reload reads the files, the current material is kept on error
+func (r *tlsReloader) reload() error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		caCert, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("could not parse certificate from %s", r.caFile)
+		}
+	}
+
+	stamps := r.currentStamps()
+
+	r.mu.Lock()
+	r.cert = cert
+	r.roots = roots
+	r.stamps = stamps
+	r.mu.Unlock()
+	return nil
+}
+
+// currentStamps stats the files, symlinks are followed so the kubernetes
+// atomic writer swaps are detected
+func (r *tlsReloader) currentStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil {
+			stamps[f] = fileStamp{fi.ModTime(), fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// changed tells if a file has been modified since the last reload
+func (r *tlsReloader) changed() bool {
+	current := r.currentStamps()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(current) != len(r.stamps) {
+		return true
+	}
+	for f, s := range current {
+		if r.stamps[f] != s {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the files until close is called
+func (r *tlsReloader) watch(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.reload(); err != nil {
+					log.Printf("WARN: TLS material reload failed, keeping the previous one: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *tlsReloader) close() {
+	if r != nil && r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// getClientCertificate implements tls.Config.GetClientCertificate
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return r.cert, nil
+}
+
+// verifyConnection returns a tls.Config.VerifyConnection running the standard verification
+// against the current CA bundle for serverName, the negotiated one when empty.
+// The TLS client does not report the IP targets, a connection without name to verify is refused
+func (r *tlsReloader) verifyConnection(serverName string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		name := serverName
+		if name == "" {
+			name = cs.ServerName
+		}
+		if name == "" {
+			return errors.New("no server name to verify the peer certificate against")
+		}
+
+		r.mu.RLock()
+		roots := r.roots
+		r.mu.RUnlock()
+
+		intermediates := x509.NewCertPool()
+		for _, c := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       name,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+// dialTLS returns the DialTLSContext of the transport, each connection verifies the peer
+// certificate against the ServerName of tlsConf or the dialed host, IP addresses included
+func (r *tlsReloader) dialTLS(tlsConf *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error), handshakeTimeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		// cloned on each dial, the transport adds the h2 protocol to tlsConf when HTTP/2 is enabled
+		conf := tlsConf.Clone()
+		if conf.ServerName == "" {
+			conf.ServerName = host
+		}
+		conf.VerifyConnection = r.verifyConnection(conf.ServerName)
+
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if handshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, conf)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// parseTLSVersion maps "1.0" to "1.3" to the tls constants, TLS 1.2 is the default
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "TLS") {
+	case "":
+		return tls.VersionTLS12, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %s", v)
+}
+
+// parseCipherSuites maps the IANA names to their ids, insecure suites are refused
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, n := range names {
+		id, ok := known[strings.TrimSpace(n)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %s", n)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,250 @@
+package restclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+// testCA is a throwaway certificate authority
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA, for the name cn and the ips
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage, ips ...net.IP) ([]byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issue certificate failed: %v", err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func newTLSTestServer(t *testing.T, ca *testCA, clientCAs *x509.CertPool) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth, net.ParseIP("127.0.0.1"))
+	cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	return srv
+}
+
+func writeFile(t *testing.T, path string, b []byte) {
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatalf("write %s failed: %v", path, err)
+	}
+}
+
+func Test_mutual_tls_with_certificate_rotation(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	serverCA, clientCA := newTestCA(t, "server-ca"), newTestCA(t, "client-ca")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	srv := newTLSTestServer(t, serverCA, clientCAs)
+	defer srv.Close()
+
+	certPEM, keyPEM := clientCA.issue(t, "client-v1", x509.ExtKeyUsageClientAuth)
+	writeFile(t, caFile, serverCA.pem)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	conf := NewConfig(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	conf.SslCaLocation = caFile
+	conf.SslCertificateLocation = certFile
+	conf.SslKeyLocation = keyFile
+	conf.SslReloadIntervalMs = 0
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	defer rs.Close()
+
+	var first codecItem
+	err1 := rs.HandleRequest(NewRequest("GET", "/", nil), &first)
+
+	// rotate the client certificate
+	certPEM, keyPEM = clientCA.issue(t, "client-v2", x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	tests.MaybeFail("reload", rs.tlsReloader.reload())
+	rs.CloseIdleConnections()
+
+	var second codecItem
+	err2 := rs.HandleRequest(NewRequest("GET", "/", nil), &second)
+
+	// a CA bundle which does not match the server is refused
+	writeFile(t, caFile, newTestCA(t, "other-ca").pem)
+	tests.MaybeFail("reload", rs.tlsReloader.reload())
+	rs.CloseIdleConnections()
+	err3 := rs.HandleRequest(NewRequest("GET", "/", nil), &second)
+
+	tests.MaybeFail("mutual_tls_with_certificate_rotation",
+		tests.Expect(err1, nil),
+		tests.Expect(first.Name, "client-v1"),
+		tests.Expect(err2, nil),
+		tests.Expect(second.Name, "client-v2"),
+		tests.Expect(err3.GetCode(), http.StatusServiceUnavailable))
+}
+
+func Test_tls_verifies_ip_targets(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	ca := newTestCA(t, "server-ca")
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeFile(t, caFile, ca.pem)
+
+	// the certificate is issued by the trusted CA for another host
+	certPEM, keyPEM := ca.issue(t, "other.internal", x509.ExtKeyUsageServerAuth)
+	cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"served"}`))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	conf := NewConfig(srv.URL)
+	conf.SslCaLocation = caFile
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	defer rs.Close()
+	errIP := rs.HandleRequest(NewRequest("GET", "/", nil), nil)
+
+	conf.SslServerName = "other.internal"
+	rsNamed, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	defer rsNamed.Close()
+	var out codecItem
+	errNamed := rsNamed.HandleRequest(NewRequest("GET", "/", nil), &out)
+
+	tests.MaybeFail("tls_verifies_ip_targets", errNamed,
+		tests.Expect(strings.HasPrefix(srv.URL, "https://127.0.0.1:"), true),
+		tests.Expect(errIP != nil && errIP.GetCode() == http.StatusServiceUnavailable, true),
+		tests.Expect(strings.Contains(errIP.Error(), "127.0.0.1"), true),
+		tests.Expect(out.Name, "served"))
+}
+
+func Test_tls_reloader_detects_changes(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, newTestCA(t, "ca-v1").pem)
+
+	r := newTLSReloader("", "", caFile)
+	err := r.reload()
+	unchanged := r.changed()
+
+	writeFile(t, caFile, append(newTestCA(t, "ca-v2").pem, '\n'))
+	changed := r.changed()
+
+	writeFile(t, caFile, []byte("malformed"))
+	errMalformed := r.reload()
+
+	tests.MaybeFail("tls_reloader_detects_changes", err,
+		tests.Expect(unchanged, false),
+		tests.Expect(changed, true),
+		tests.Expect(errMalformed.Error(), "could not parse certificate from "+caFile),
+		tests.Expect(r.roots != nil, true))
+}
+
+func Test_configure_tls_settings(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	conf := NewConfig("https://localhost")
+	conf.SslMinVersion = "1.3"
+	conf.SslServerName = "api.internal"
+	conf.SslCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	conf.SslDisableEndpointVerification = true
+	conf.GOENV = "development"
+	tlsConf := &tls.Config{}
+	_, err := configureTLS(conf, tlsConf)
+
+	conf.SslCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+	_, errCipher := configureTLS(conf, &tls.Config{})
+
+	conf.SslCipherSuites = nil
+	conf.GOENV = "production"
+	_, errProd := configureTLS(conf, &tls.Config{})
+
+	// a localhost config does not lift the restriction in a production process
+	t.Setenv("GOENV", "production")
+	conf.GOENV = "localhost"
+	_, errProcessProd := configureTLS(conf, &tls.Config{})
+
+	conf.SslDisableEndpointVerification = false
+	conf.SslCertificateLocation = "client.crt"
+	_, errKey := configureTLS(conf, &tls.Config{})
+
+	tests.MaybeFail("configure_tls_settings", err,
+		tests.Expect(tlsConf.MinVersion, uint16(tls.VersionTLS13)),
+		tests.Expect(tlsConf.ServerName, "api.internal"),
+		tests.Expect(tlsConf.CipherSuites, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}),
+		tests.Expect(tlsConf.InsecureSkipVerify, true),
+		tests.Expect(errCipher.Error(), "unknown or insecure cipher suite TLS_RSA_WITH_RC4_128_SHA"),
+		tests.Expect(errProd.Error(), "SslDisableEndpointVerification can not be enabled in production"),
+		tests.Expect(errProcessProd.Error(), "SslDisableEndpointVerification can not be enabled in production"),
+		tests.Expect(errKey.Error(), "SslKeyLocation needs to be provided if using SslCertificateLocation"))
+}
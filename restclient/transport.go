@@ -0,0 +1,80 @@
+package restclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
+)
+
+// configureDialer returns the dial function of the transport,
+// every connection goes to UnixSocket when it is set
+func configureDialer(conf *Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(conf.ConnectionTimeoutMs) * time.Millisecond,
+		KeepAlive: time.Duration(conf.KeepAliveMs) * time.Millisecond,
+	}
+	if len(conf.UnixSocket) == 0 {
+		return dialer.DialContext
+	}
+	socket := conf.UnixSocket
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
+
+// configureProxy returns the proxy selection of the transport, ProxyURL is used for the
+// http and https targets not matching NoProxy, the environment is read with ProxyFromEnvironment
+func configureProxy(conf *Config) (func(*http.Request) (*url.URL, error), error) {
+	if len(conf.ProxyURL) == 0 {
+		if conf.ProxyFromEnvironment {
+			return http.ProxyFromEnvironment, nil
+		}
+		return nil, nil
+	}
+
+	u, err := url.Parse(conf.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ProxyURL: %v", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s, one of http, https, socks5", u.Scheme)
+	}
+
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  conf.ProxyURL,
+		HTTPSProxy: conf.ProxyURL,
+		NoProxy:    conf.NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// configureH2C returns a transport speaking HTTP/2 over cleartext TCP with prior knowledge,
+// the targets need to be http URLs
+func configureH2C(conf *Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) http.RoundTripper {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+		ReadIdleTimeout: time.Duration(conf.KeepAliveMs) * time.Millisecond,
+	}
+}
+
+// closeIdleConnections closes the idle connections of the wrapped transports
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,133 @@
+package restclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/grpasr/common/configloader"
+	"gitlab.com/grpasr/common/faultinjection"
+	"gitlab.com/grpasr/common/tests"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func Test_transport_proxy_and_no_proxy(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	conf := NewConfig("http://api.example.invalid/v1")
+	conf.ProxyURL = proxy.URL
+	conf.NoProxy = ".internal.invalid"
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	errProxied := rs.HandleRequest(NewRequest("GET", "/items", nil), nil)
+
+	conf.TargetURL = "http://db.internal.invalid"
+	rsNoProxy, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	errNoProxy := rsNoProxy.HandleRequest(NewRequest("GET", "/items", nil), nil)
+
+	conf.ProxyURL = "ftp://proxy"
+	_, errScheme := NewRestService(conf, MediaTypeJSON)
+
+	tests.MaybeFail("transport_proxy_and_no_proxy",
+		tests.Expect(errProxied, nil),
+		tests.Expect(proxied, "http://api.example.invalid/v1/items"),
+		tests.Expect(errNoProxy.GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(errScheme.Error(), "unsupported proxy scheme ftp, one of http, https, socks5"))
+}
+
+func Test_transport_unix_socket_and_h2c(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	listener, err := net.Listen("unix", socket)
+	tests.MaybeFail("listen", err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.Write([]byte(`{"name":"` + r.Proto + " " + r.Host + r.URL.Path + `"}`))
+	})
+	srv := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	conf := NewConfig("http://api.local")
+	conf.UnixSocket = socket
+	rs, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	var http1 codecItem
+	err1 := rs.HandleRequest(NewRequest("GET", "/items", nil), &http1)
+
+	conf.H2C = true
+	rsH2C, err := NewRestService(conf, MediaTypeJSON)
+	tests.MaybeFail("new_rest_service", err)
+	var h2 codecItem
+	err2 := rsH2C.HandleRequest(NewRequest("GET", "/items", nil), &h2)
+
+	tests.MaybeFail("transport_unix_socket_and_h2c", err1, err2,
+		tests.Expect(http1.Name, "HTTP/1.1 api.local/items"),
+		tests.Expect(h2.Name, "HTTP/2.0 api.local/items"))
+}
+
+func Test_transport_settings_from_configloader(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	lc := configloader.NewLoaderConfig("localhost")
+	err := lc.LDRLoadConfigs("configTests", "yaml", "../configloader/tests/loaderConfig/")
+	conf := NewConfig("https://api.example.invalid")
+	errUnmarshal := lc.LDRUnmarshalKey("restclient", conf)
+
+	transport, _, errTransport := configureTransport(conf)
+	tr := transport.(*http.Transport)
+	target, _ := url.Parse(conf.TargetURL)
+	proxy, errProxy := tr.Proxy(&http.Request{URL: target})
+
+	tests.MaybeFail("transport_settings_from_configloader", err, errUnmarshal, errTransport, errProxy,
+		tests.Expect(conf.RequestTimeoutMs, 5000),
+		tests.Expect(conf.ConnectionTimeoutMs, 10000),
+		tests.Expect(tr.MaxIdleConnsPerHost, 32),
+		tests.Expect(tr.MaxIdleConns, 100),
+		tests.Expect(tr.IdleConnTimeout, 90*time.Second),
+		tests.Expect(tr.ForceAttemptHTTP2, true),
+		tests.Expect(proxy.String(), "socks5://proxy.internal:1080"))
+}
+
+func Test_transport_fault_injection(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	newService := func(goenv string) *restService {
+		conf := NewConfig(srv.URL)
+		conf.GOENV = goenv
+		conf.FaultInjection = &faultinjection.Config{Rules: []faultinjection.Rule{
+			{Name: "items-down", Path: "/items/*", Probability: 1, Status: http.StatusServiceUnavailable},
+		}}
+		rs, err := NewRestService(conf, MediaTypeJSON)
+		tests.MaybeFail("new_rest_service", err)
+		return rs
+	}
+
+	injected := newService(configloader.StagingENV).HandleRequest(NewRequest("GET", "/items/1", nil), nil)
+	production := newService(configloader.ProductionENV).HandleRequest(NewRequest("GET", "/items/1", nil), nil)
+
+	tests.MaybeFail("transport_fault_injection",
+		tests.Expect(injected.GetCode(), http.StatusServiceUnavailable),
+		tests.Expect(injected.Error(), "503 : Service unavailable, Comment: fault injected by items-down"),
+		tests.Expect(production, nil))
+}
@@ -0,0 +1,366 @@
+package restclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+type RecorderMode string
+
+const (
+	// ModeRecord sends every request and records the interactions, the cassette is overwritten
+	ModeRecord RecorderMode = "record"
+	// ModeReplay serves the requests from the cassette only
+	ModeReplay RecorderMode = "replay"
+	// ModeReplayOrRecord serves the matching requests from the cassette, records the others
+	ModeReplayOrRecord RecorderMode = "replay_or_record"
+)
+
+// RecordedRequest is the request side of an interaction
+type RecordedRequest struct {
+	Method   string      `json:"method" yaml:"method"`
+	URL      string      `json:"url" yaml:"url"`
+	Header   http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body     string      `json:"body,omitempty" yaml:"body,omitempty"`
+	Encoding string      `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+}
+
+// RecordedResponse is the response side of an interaction
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code" yaml:"status_code"`
+	Header     http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       string      `json:"body,omitempty" yaml:"body,omitempty"`
+	Encoding   string      `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request" yaml:"request"`
+	Response RecordedResponse `json:"response" yaml:"response"`
+}
+
+// Cassette is a file of interactions, YAML unless its extension is .json
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+	path         string
+}
+
+// LoadCassette reads the cassette at path, a missing file is an empty cassette
+func LoadCassette(path string) (*Cassette, error) {
+	c := &Cassette{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isJSONCassette(path) {
+		err = json.Unmarshal(b, c)
+	} else {
+		err = yaml.Unmarshal(b, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette, creating its directory if needed
+func (c *Cassette) Save() error {
+	var b []byte
+	var err error
+	if isJSONCassette(c.path) {
+		b, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		b, err = yaml.Marshal(c)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, b, 0o644)
+}
+
+func isJSONCassette(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Matcher tells if the actual request matches a recorded one,
+// the actual request is redacted as the recorded ones are
+type Matcher func(actual, recorded *RecordedRequest) bool
+
+func MatchMethod(actual, recorded *RecordedRequest) bool {
+	return actual.Method == recorded.Method
+}
+
+func MatchURL(actual, recorded *RecordedRequest) bool {
+	return actual.URL == recorded.URL
+}
+
+// MatchBody compares the bodies, the JSON ones semantically
+func MatchBody(actual, recorded *RecordedRequest) bool {
+	if actual.Body == recorded.Body {
+		return true
+	}
+	var a, r interface{}
+	if json.Unmarshal([]byte(actual.Body), &a) != nil || json.Unmarshal([]byte(recorded.Body), &r) != nil {
+		return false
+	}
+	ab, _ := json.Marshal(a)
+	rb, _ := json.Marshal(r)
+	return bytes.Equal(ab, rb)
+}
+
+// MatchHeaders compares the values of the named headers
+func MatchHeaders(names ...string) Matcher {
+	return func(actual, recorded *RecordedRequest) bool {
+		for _, n := range names {
+			if strings.Join(actual.Header.Values(n), ",") != strings.Join(recorded.Header.Values(n), ",") {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// RecorderConfig configures the Recorder
+type RecorderConfig struct {
+	Mode RecorderMode
+	// Matchers all need to match, default to the method and the URL
+	Matchers []Matcher
+	// Strict fails the unmatched requests in replay mode instead of sending them,
+	// and does not replay an interaction twice
+	Strict bool
+	// RedactHeaders, RedactQueryParams and RedactJSONFields are redacted when recording,
+	// Authorization is always redacted
+	RedactHeaders     []string
+	RedactQueryParams []string
+	RedactJSONFields  []string
+}
+
+func NewRecorderConfig(mode RecorderMode) *RecorderConfig {
+	return &RecorderConfig{
+		Mode:          mode,
+		Matchers:      []Matcher{MatchMethod, MatchURL},
+		Strict:        true,
+		RedactHeaders: []string{"Cookie", "Set-Cookie"},
+	}
+}
+
+// Recorder is a record/replay http.RoundTripper, it is installed on a restService with
+//
+//	rec, err := NewRecorder("testdata/users.yaml", NewRecorderConfig(ModeReplay), rs.Transport)
+//	rs.Transport = rec
+//	defer rec.Stop()
+type Recorder struct {
+	conf     *RecorderConfig
+	next     http.RoundTripper
+	redactor *requestLogger
+
+	mu       sync.Mutex
+	cassette *Cassette
+	replayed map[*Interaction]bool
+	dirty    bool
+}
+
+func NewRecorder(cassettePath string, conf *RecorderConfig, next http.RoundTripper) (*Recorder, error) {
+	if conf == nil {
+		conf = NewRecorderConfig(ModeReplay)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	cassette := &Cassette{path: cassettePath}
+	switch conf.Mode {
+	case ModeRecord:
+	case ModeReplay, ModeReplayOrRecord:
+		var err error
+		if cassette, err = LoadCassette(cassettePath); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown recorder mode %s", conf.Mode)
+	}
+
+	return &Recorder{
+		conf: conf,
+		next: next,
+		redactor: newRequestLogger(&LoggingConfig{
+			RedactHeaders:     conf.RedactHeaders,
+			RedactQueryParams: conf.RedactQueryParams,
+			RedactJSONFields:  conf.RedactJSONFields,
+		}),
+		cassette: cassette,
+		replayed: make(map[*Interaction]bool),
+	}, nil
+}
+
+// Stop saves the cassette if interactions were recorded
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	return r.cassette.Save()
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	actual := r.recordRequest(req, body)
+
+	if r.conf.Mode != ModeRecord {
+		if i := r.match(actual); i != nil {
+			return replayResponse(req, &i.Response)
+		}
+		if r.conf.Mode == ModeReplay {
+			if r.conf.Strict {
+				return nil, fmt.Errorf("no recorded interaction matches %s %s", actual.Method, actual.URL)
+			}
+			return r.next.RoundTrip(req)
+		}
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recorded := RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     r.redactor.redactHeaders(resp.Header),
+	}
+	recorded.Body, recorded.Encoding = encodeRecordedBody(r.redactor.redactBody(respBody, resp.Header.Get("Content-Type")))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{Request: *actual, Response: recorded})
+	r.dirty = true
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// match returns the first matching interaction not replayed yet,
+// or when not strict, the first matching one
+func (r *Recorder) match(actual *RecordedRequest) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var replayed *Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.matches(actual, &i.Request) {
+			continue
+		}
+		if !r.replayed[i] {
+			r.replayed[i] = true
+			return i
+		}
+		if replayed == nil {
+			replayed = i
+		}
+	}
+	if r.conf.Strict {
+		return nil
+	}
+	return replayed
+}
+
+func (r *Recorder) matches(actual, recorded *RecordedRequest) bool {
+	matchers := r.conf.Matchers
+	if len(matchers) == 0 {
+		matchers = []Matcher{MatchMethod, MatchURL}
+	}
+	for _, m := range matchers {
+		if !m(actual, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordRequest returns the redacted request as it is stored in the cassette
+func (r *Recorder) recordRequest(req *http.Request, body []byte) *RecordedRequest {
+	rr := &RecordedRequest{
+		Method: req.Method,
+		URL:    r.redactor.redactURL(req.URL),
+		Header: r.redactor.redactHeaders(req.Header),
+	}
+	rr.Body, rr.Encoding = encodeRecordedBody(r.redactor.redactBody(body, req.Header.Get("Content-Type")))
+	return rr
+}
+
+// readRequestBody reads the request body and restores it for the next transport
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// encodeRecordedBody keeps the text bodies readable, the binary ones are base64 encoded
+func encodeRecordedBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeRecordedBody(body, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+func replayResponse(req *http.Request, rr *RecordedResponse) (*http.Response, error) {
+	body, err := decodeRecordedBody(rr.Body, rr.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	header := rr.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rr.StatusCode, http.StatusText(rr.StatusCode)),
+		StatusCode:    rr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
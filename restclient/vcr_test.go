@@ -0,0 +1,108 @@
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/grpasr/common/tests"
+)
+
+func newRecordedService(t *testing.T, target, cassette string, conf *RecorderConfig) (*restService, *Recorder) {
+	rsConf := NewConfig(target)
+	rsConf.Authenticator = NewBearerAuthenticator("s3cr3t")
+	rs, err := NewRestService(rsConf, MediaTypeJSON)
+	if err != nil {
+		t.Fatalf("new_rest_service failed: %v", err)
+	}
+	rec, err := NewRecorder(cassette, conf, rs.Transport)
+	if err != nil {
+		t.Fatalf("new_recorder failed: %v", err)
+	}
+	rs.Transport = rec
+	return rs, rec
+}
+
+func Test_recorder_record_then_replay(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	for _, name := range []string{"items.yaml", "items.json"} {
+		cassette := filepath.Join(t.TempDir(), "cassettes", name)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", MediaTypeJSON)
+			w.Header().Set("Set-Cookie", "session=abc")
+			w.Write([]byte(`{"name":"` + r.Method + r.URL.Path + `","count":1}`))
+		}))
+
+		conf := NewRecorderConfig(ModeRecord)
+		conf.RedactQueryParams = []string{"token"}
+		conf.RedactJSONFields = []string{"name"}
+		conf.Matchers = []Matcher{MatchMethod, MatchURL, MatchBody}
+		rs, rec := newRecordedService(t, srv.URL, cassette, conf)
+
+		var recorded codecItem
+		errGet := rs.HandleRequest(NewRequest("GET", "/items/1", nil).WithQuery(map[string][]string{"token": {"t1"}}), &recorded)
+		errPost := rs.HandleRequest(NewRequest("POST", "/items", codecItem{Name: "secret", Count: 2}), nil)
+		tests.MaybeFail("record", errGet, errPost, rec.Stop())
+		srv.Close()
+
+		stored, _ := os.ReadFile(cassette)
+
+		// replays offline, the server is closed
+		conf.Mode = ModeReplay
+		rs, _ = newRecordedService(t, srv.URL, cassette, conf)
+		var replayed codecItem
+		errReplayGet := rs.HandleRequest(NewRequest("GET", "/items/1", nil).WithQuery(map[string][]string{"token": {"t2"}}), &replayed)
+		errReplayPost := rs.HandleRequest(NewRequest("POST", "/items", codecItem{Name: "other", Count: 2}), nil)
+		errUnmatched := rs.HandleRequest(NewRequest("POST", "/items", codecItem{Name: "x", Count: 3}), nil)
+		errTwice := rs.HandleRequest(NewRequest("GET", "/items/1", nil).WithQuery(map[string][]string{"token": {"t2"}}), &replayed)
+
+		tests.MaybeFail("recorder_record_then_replay_"+name,
+			tests.Expect(recorded.Name, "GET/items/1"),
+			tests.Expect(strings.Contains(string(stored), "s3cr3t"), false),
+			tests.Expect(strings.Contains(string(stored), "session=abc"), false),
+			tests.Expect(strings.Contains(string(stored), "t1"), false),
+			tests.Expect(strings.Contains(string(stored), "secret"), false),
+			tests.Expect(strings.Contains(string(stored), "[REDACTED]"), true),
+			tests.Expect(errReplayGet, nil),
+			tests.Expect(replayed.Name, "[REDACTED]"),
+			tests.Expect(replayed.Count, 1),
+			tests.Expect(errReplayPost, nil),
+			tests.Expect(errUnmatched.GetCode(), http.StatusServiceUnavailable),
+			tests.Expect(errTwice.GetCode(), http.StatusServiceUnavailable))
+	}
+}
+
+func Test_recorder_replay_or_record(t *testing.T) {
+	tests.MaybeFail = tests.InitFailFunc(t)
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cassette := filepath.Join(t.TempDir(), "ping.yaml")
+	conf := NewRecorderConfig(ModeReplayOrRecord)
+	conf.Strict = false
+	rs, rec := newRecordedService(t, srv.URL, cassette, conf)
+
+	err1 := rs.HandleRequest(NewRequest("GET", "/ping", nil), nil)
+	err2 := rs.HandleRequest(NewRequest("GET", "/ping", nil), nil)
+	err3 := rs.HandleRequest(NewRequest("GET", "/ping", nil), nil)
+	tests.MaybeFail("stop", rec.Stop())
+
+	c, errLoad := LoadCassette(cassette)
+	_, errMode := NewRecorder(cassette, &RecorderConfig{Mode: "rewind"}, nil)
+
+	tests.MaybeFail("recorder_replay_or_record", err1, err2, err3, errLoad,
+		tests.Expect(hits, 1),
+		tests.Expect(len(c.Interactions), 1),
+		tests.Expect(c.Interactions[0].Response.StatusCode, http.StatusNoContent),
+		tests.Expect(errMode.Error(), "unknown recorder mode rewind"))
+}